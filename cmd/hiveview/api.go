@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	apiSuiteLimit = 200  // default number of suites returned
+	apiTestLimit  = 1000 // default number of tests returned
+)
+
+// resultAPI serves JSON queries against the result index.
+type resultAPI struct {
+	index *resultIndex
+}
+
+// suiteFilter selects suites by query parameters.
+type suiteFilter struct {
+	name    string // suite name
+	client  string // client name
+	version string // substring of the client version
+	since   time.Time
+	until   time.Time
+}
+
+func parseSuiteFilter(q url.Values) (f suiteFilter, err error) {
+	f.name = q.Get("name")
+	f.client = q.Get("client")
+	f.version = q.Get("version")
+	if f.since, err = parseTimeParam(q.Get("since")); err != nil {
+		return f, fmt.Errorf("invalid 'since': %v", err)
+	}
+	if f.until, err = parseTimeParam(q.Get("until")); err != nil {
+		return f, fmt.Errorf("invalid 'until': %v", err)
+	}
+	return f, nil
+}
+
+// parseTimeParam parses a date or RFC 3339 timestamp.
+func parseTimeParam(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func (f suiteFilter) match(s *indexSuite) bool {
+	if f.name != "" && s.Name != f.name {
+		return false
+	}
+	if f.client != "" && !contains(s.Clients, f.client) {
+		if _, ok := s.ClientVersions[f.client]; !ok {
+			return false
+		}
+	}
+	if f.version != "" {
+		found := false
+		for client, version := range s.ClientVersions {
+			if (f.client == "" || client == f.client) && strings.Contains(version, f.version) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if !f.since.IsZero() && s.Start.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && !s.Start.Before(f.until) {
+		return false
+	}
+	return true
+}
+
+// testFilter selects tests by query parameters.
+type testFilter struct {
+	status string // "pass" or "fail"
+	name   *regexp.Regexp
+	client string
+}
+
+func parseTestFilter(q url.Values) (f testFilter, err error) {
+	f.status = q.Get("status")
+	if f.status != "" && f.status != "pass" && f.status != "fail" {
+		return f, fmt.Errorf("invalid 'status': must be 'pass' or 'fail'")
+	}
+	if re := q.Get("test"); re != "" {
+		if f.name, err = regexp.Compile(re); err != nil {
+			return f, fmt.Errorf("invalid 'test' regular expression: %v", err)
+		}
+	}
+	f.client = q.Get("client")
+	return f, nil
+}
+
+func (f testFilter) match(t *indexTest) bool {
+	if f.status != "" && t.Pass != (f.status == "pass") {
+		return false
+	}
+	if f.name != nil && !f.name.MatchString(t.Name) {
+		return false
+	}
+	if f.client != "" && !contains(t.Clients, f.client) {
+		return false
+	}
+	return true
+}
+
+func parseLimit(q url.Values, def int) (int, error) {
+	s := q.Get("limit")
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid 'limit'")
+	}
+	return n, nil
+}
+
+// serveSuites handles /api/suites.
+func (api resultAPI) serveSuites(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter, err := parseSuiteFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := parseLimit(q, apiSuiteLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	result := []*indexSuite{}
+	for _, s := range api.index.list() {
+		if len(result) >= limit {
+			break
+		}
+		if filter.match(s) {
+			result = append(result, s)
+		}
+	}
+	serveJSON(w, result)
+}
+
+// serveTests handles /api/tests. Suites are selected like in /api/suites,
+// except that 'client' applies to the clients of each test.
+func (api resultAPI) serveTests(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	sfilter, err := parseSuiteFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sfilter.client = ""
+	tfilter, err := parseTestFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := parseLimit(q, apiTestLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	suiteFile := q.Get("file")
+
+	result := []*indexTest{}
+outer:
+	for _, s := range api.index.list() {
+		if (suiteFile != "" && s.FileName != suiteFile) || !sfilter.match(s) {
+			continue
+		}
+		for i := range s.tests {
+			if len(result) >= limit {
+				break outer
+			}
+			if tfilter.match(&s.tests[i]) {
+				result = append(result, &s.tests[i])
+			}
+		}
+	}
+	serveJSON(w, result)
+}
+
+// clientStats is the result of /api/clients.
+type clientStats struct {
+	Client   string  `json:"client"`
+	Version  string  `json:"version"`
+	Tests    int     `json:"tests"`
+	Passes   int     `json:"passes"`
+	Fails    int     `json:"fails"`
+	PassRate float64 `json:"passRate"`
+}
+
+// serveClients handles /api/clients. It computes the pass rate of tests
+// for each client and version, in the suites selected by the query.
+func (api resultAPI) serveClients(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseSuiteFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	type key struct{ client, version string }
+	stats := make(map[key]*clientStats)
+	for _, s := range api.index.list() {
+		if !filter.match(s) {
+			continue
+		}
+		for _, test := range s.tests {
+			for _, client := range test.Clients {
+				if filter.client != "" && client != filter.client {
+					continue
+				}
+				k := key{client, s.ClientVersions[client]}
+				st := stats[k]
+				if st == nil {
+					st = &clientStats{Client: k.client, Version: k.version}
+					stats[k] = st
+				}
+				st.Tests++
+				if test.Pass {
+					st.Passes++
+				} else {
+					st.Fails++
+				}
+			}
+		}
+	}
+
+	result := make([]*clientStats, 0, len(stats))
+	for _, st := range stats {
+		st.PassRate = float64(st.Passes) / float64(st.Tests)
+		result = append(result, st)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Client != result[j].Client {
+			return result[i].Client < result[j].Client
+		}
+		return result[i].Version < result[j].Version
+	})
+	serveJSON(w, result)
+}
+
+// historyQuery parses the query parameters of history requests. It also refreshes
+// the index, which updates the history.
+func (api resultAPI) historyQuery(w http.ResponseWriter, r *http.Request) (*historyDB, historyFilter, bool) {
+	if api.index.history == nil {
+		http.Error(w, "history is disabled", http.StatusNotFound)
+		return nil, historyFilter{}, false
+	}
+	q := r.URL.Query()
+	f := historyFilter{client: q.Get("client"), suite: q.Get("suite")}
+	if re := q.Get("test"); re != "" {
+		var err error
+		if f.test, err = regexp.Compile(re); err != nil {
+			http.Error(w, fmt.Sprintf("invalid 'test' regular expression: %v", err), http.StatusBadRequest)
+			return nil, f, false
+		}
+	}
+	api.index.list()
+	return api.index.history, f, true
+}
+
+// serveHistoryTrend handles /api/history/trend.
+func (api resultAPI) serveHistoryTrend(w http.ResponseWriter, r *http.Request) {
+	if db, filter, ok := api.historyQuery(w, r); ok {
+		serveJSON(w, db.trend(filter))
+	}
+}
+
+// serveHistoryFailing handles /api/history/failing.
+func (api resultAPI) serveHistoryFailing(w http.ResponseWriter, r *http.Request) {
+	if db, filter, ok := api.historyQuery(w, r); ok {
+		serveJSON(w, db.failing(filter))
+	}
+}
+
+// serveHistoryTest handles /api/history/test. Unlike the other history
+// queries, the 'test' parameter is the exact test name here.
+func (api resultAPI) serveHistoryTest(w http.ResponseWriter, r *http.Request) {
+	if api.index.history == nil {
+		http.Error(w, "history is disabled", http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query()
+	suite, test, client := q.Get("suite"), q.Get("test"), q.Get("client")
+	if suite == "" || test == "" || client == "" {
+		http.Error(w, "'suite', 'test' and 'client' are required", http.StatusBadRequest)
+		return
+	}
+	api.index.list()
+	serveJSON(w, api.index.history.testResults(suite, test, client))
+}
+
+// serveListing serves listing.jsonl from the index.
+func (api resultAPI) serveListing(w http.ResponseWriter, r *http.Request) {
+	enc := json.NewEncoder(w)
+	for i, s := range api.index.list() {
+		if i >= listLimit {
+			break
+		}
+		if err := enc.Encode(s.listingEntry); err != nil {
+			break
+		}
+	}
+}
+
+func serveJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
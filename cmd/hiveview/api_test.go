@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSuiteFilter(t *testing.T) {
+	suite := &indexSuite{
+		listingEntry: listingEntry{
+			Name:    "engine",
+			Clients: []string{"geth"},
+			Start:   testTime,
+		},
+		ClientVersions: map[string]string{"geth": "Geth/v1.11.0", "besu": "besu/v23.1"},
+	}
+	tests := []struct {
+		query string
+		match bool
+	}{
+		{"", true},
+		{"name=engine", true},
+		{"name=eng", false},
+		{"client=geth", true},
+		{"client=besu", true}, // known from the client versions
+		{"client=erigon", false},
+		{"version=v1.11", true},
+		{"version=v1.12", false},
+		{"client=besu&version=v1.11", false},
+		{"client=geth&version=v1.11", true},
+		{"since=2023-01-02", true},
+		{"since=2023-01-03", false},
+		{"until=2023-01-03", true},
+		{"until=2023-01-02", false},
+		{"until=" + url.QueryEscape(testTime.Format(time.RFC3339)), false},
+		{"until=" + url.QueryEscape(testTime.Add(time.Second).Format(time.RFC3339)), true},
+	}
+	for _, test := range tests {
+		q, _ := url.ParseQuery(test.query)
+		f, err := parseSuiteFilter(q)
+		if err != nil {
+			t.Errorf("%q: parse error %v", test.query, err)
+			continue
+		}
+		if m := f.match(suite); m != test.match {
+			t.Errorf("%q: match %t, want %t", test.query, m, test.match)
+		}
+	}
+
+	for _, query := range []string{"since=yesterday", "until=2023-13-01"} {
+		q, _ := url.ParseQuery(query)
+		if _, err := parseSuiteFilter(q); err == nil {
+			t.Errorf("%q: expected error", query)
+		}
+	}
+}
+
+func TestTestFilter(t *testing.T) {
+	test := &indexTest{Name: "sync (geth)", Pass: false, Clients: []string{"geth", "besu"}}
+	tests := []struct {
+		query string
+		match bool
+	}{
+		{"", true},
+		{"status=fail", true},
+		{"status=pass", false},
+		{"test=sync", true},
+		{"test=" + url.QueryEscape("^sync \\(geth\\)$"), true},
+		{"test=^geth", false},
+		{"client=besu", true},
+		{"client=erigon", false},
+		{"status=fail&test=sync&client=geth", true},
+	}
+	for _, tt := range tests {
+		q, _ := url.ParseQuery(tt.query)
+		f, err := parseTestFilter(q)
+		if err != nil {
+			t.Errorf("%q: parse error %v", tt.query, err)
+			continue
+		}
+		if m := f.match(test); m != tt.match {
+			t.Errorf("%q: match %t, want %t", tt.query, m, tt.match)
+		}
+	}
+
+	for _, query := range []string{"status=ok", "test=" + url.QueryEscape("(")} {
+		q, _ := url.ParseQuery(query)
+		if _, err := parseTestFilter(q); err == nil {
+			t.Errorf("%q: expected error", query)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// The run comparison page. It renders the result of /compare.json.
+
+var compare = {
+    sections: [
+        {key: "newFailures", title: "New failures", cls: "text-danger"},
+        {key: "fixed", title: "Fixed", cls: "text-success"},
+        {key: "appeared", title: "Appeared"},
+        {key: "disappeared", title: "Disappeared"},
+        {key: "slower", title: "Slower", duration: true},
+        {key: "faster", title: "Faster", duration: true},
+    ],
+
+    init: function() {
+        let params = new URLSearchParams(window.location.search);
+        $("#run-a").val(params.get("a") || "");
+        $("#run-b").val(params.get("b") || "");
+        $("#compare-form").on("submit", function(ev) {
+            ev.preventDefault();
+            let search = "?" + $.param({a: $("#run-a").val(), b: $("#run-b").val()});
+            history.pushState(null, null, search);
+            compare.load();
+        });
+        window.addEventListener("popstate", compare.init);
+        compare.load();
+    },
+
+    load: function() {
+        let params = new URLSearchParams(window.location.search);
+        if (!params.get("a") || !params.get("b")) {
+            return;
+        }
+        $("#status").text("Loading...");
+        $("#result").empty();
+        $.getJSON("/compare.json" + window.location.search, function(data) {
+            $("#status").text("");
+            compare.render(data);
+        }).fail(function(x) {
+            $("#status").text("Error: " + x.responseText);
+        });
+    },
+
+    render: function(data) {
+        let result = $("#result");
+        result.append($("<p>").text("A: " + data.a + " (" + data.testsA + " tests)"));
+        result.append($("<p>").text("B: " + data.b + " (" + data.testsB + " tests)"));
+
+        if (data.clientVersions.length > 0) {
+            result.append($("<h3>").text("Client versions"));
+            let table = $("<table class='table table-sm'>");
+            table.append("<tr><th>Client</th><th>A</th><th>B</th></tr>");
+            data.clientVersions.forEach(function(v) {
+                let row = $("<tr>");
+                row.append($("<td>").text(v.client));
+                row.append($("<td>").text(v.a || "(none)"));
+                row.append($("<td>").text(v.b || "(none)"));
+                table.append(row);
+            });
+            result.append(table);
+        }
+
+        compare.sections.forEach(function(section) {
+            let diffs = data[section.key];
+            if (diffs.length == 0) {
+                return;
+            }
+            let title = $("<h3>").text(section.title + " (" + diffs.length + ")");
+            if (section.cls) {
+                title.addClass(section.cls);
+            }
+            result.append(title);
+            let table = $("<table class='table table-sm table-hover'>");
+            let header = "<tr><th>Suite</th><th>Test</th><th>Clients</th><th>A</th><th>B</th></tr>";
+            table.append(header);
+            diffs.forEach(function(d) {
+                let row = $("<tr>");
+                row.append($("<td>").text(d.suite));
+                row.append($("<td>").text(d.test));
+                row.append($("<td>").text(d.clients));
+                row.append($("<td>").append(compare.testLink(d.a, section.duration)));
+                row.append($("<td>").append(compare.testLink(d.b, section.duration)));
+                table.append(row);
+            });
+            result.append(table);
+        });
+    },
+
+    // testLink creates a link to a test in the suite viewer.
+    testLink: function(ref, duration) {
+        if (!ref) {
+            return "-";
+        }
+        let text = ref.pass ? "pass" : "fail";
+        if (duration) {
+            text = ref.duration.toFixed(1) + "s";
+        }
+        let params = $.param({page: "v-pills-results-tab", suite: ref.file});
+        return $("<a>").attr("href", "/?" + params).text(text);
+    },
+};
+
+$(document).ready(compare.init);
@@ -0,0 +1,155 @@
+// The history page. It renders pass rate trends from /api/history/trend and
+// currently failing tests from /api/history/failing.
+
+var hist = {
+    chartWidth: 800,
+    chartHeight: 120,
+
+    init: function() {
+        let params = new URLSearchParams(window.location.search);
+        $("#client").val(params.get("client") || "");
+        $("#suite").val(params.get("suite") || "");
+        $("#test").val(params.get("test") || "");
+        $("#history-form").on("submit", function(ev) {
+            ev.preventDefault();
+            let query = {};
+            ["client", "suite", "test"].forEach(function(key) {
+                if ($("#" + key).val()) {
+                    query[key] = $("#" + key).val();
+                }
+            });
+            history.pushState(null, null, "?" + $.param(query));
+            hist.load();
+        });
+        window.addEventListener("popstate", hist.init);
+        hist.load();
+    },
+
+    load: function() {
+        let search = window.location.search;
+        if (!new URLSearchParams(search).get("client")) {
+            return;
+        }
+        $("#status").text("Loading...");
+        $("#trend").empty();
+        $("#failing tbody").empty();
+        $.getJSON("/api/history/trend" + search, function(data) {
+            $("#status").text("");
+            hist.renderTrend(data);
+        }).fail(function(x) {
+            $("#status").text("Error: " + x.responseText);
+        });
+        $.getJSON("/api/history/failing" + search, hist.renderFailing);
+    },
+
+    // renderTrend draws a pass rate chart for each suite.
+    renderTrend: function(points) {
+        let bySuite = {};
+        points.forEach(function(p) {
+            let key = p.suite + " / " + p.client;
+            (bySuite[key] = bySuite[key] || []).push(p);
+        });
+        Object.keys(bySuite).sort().forEach(function(key) {
+            $("#trend").append($("<h5>").text(key));
+            $("#trend").append(hist.chart(bySuite[key]));
+        });
+        if (points.length == 0) {
+            $("#trend").text("No results.");
+        }
+    },
+
+    // chart creates an SVG chart of pass rates. Points where the client version
+    // changed are marked with a vertical line.
+    chart: function(points) {
+        let ns = "http://www.w3.org/2000/svg";
+        let w = hist.chartWidth, h = hist.chartHeight;
+        let svg = document.createElementNS(ns, "svg");
+        svg.setAttribute("class", "chart");
+        svg.setAttribute("width", w);
+        svg.setAttribute("height", h);
+
+        let step = points.length > 1 ? (w - 10) / (points.length - 1) : 0;
+        let coords = [];
+        points.forEach(function(p, i) {
+            let x = 5 + i * step, y = 5 + (1 - p.passRate) * (h - 10);
+            coords.push(x + "," + y);
+            if (i > 0 && p.version != points[i-1].version) {
+                let line = document.createElementNS(ns, "line");
+                line.setAttribute("x1", x);
+                line.setAttribute("x2", x);
+                line.setAttribute("y1", 0);
+                line.setAttribute("y2", h);
+                line.setAttribute("stroke", "#adb5bd");
+                line.setAttribute("stroke-dasharray", "4");
+                svg.appendChild(line);
+            }
+            let link = document.createElementNS(ns, "a");
+            link.setAttribute("href", hist.suiteURL(p.file));
+            let dot = document.createElementNS(ns, "circle");
+            dot.setAttribute("cx", x);
+            dot.setAttribute("cy", y);
+            dot.setAttribute("r", 3);
+            dot.setAttribute("fill", p.passRate == 1 ? "#28a745" : "#dc3545");
+            let title = document.createElementNS(ns, "title");
+            title.textContent = p.time + "\n" + (p.version || "unknown version") + "\n" + p.passes + "/" + p.tests + " passed";
+            dot.appendChild(title);
+            link.appendChild(dot);
+            svg.appendChild(link);
+        });
+        let line = document.createElementNS(ns, "polyline");
+        line.setAttribute("points", coords.join(" "));
+        line.setAttribute("fill", "none");
+        line.setAttribute("stroke", "#007bff");
+        svg.insertBefore(line, svg.firstChild);
+        return svg;
+    },
+
+    renderFailing: function(tests) {
+        let tbody = $("#failing tbody");
+        tests.forEach(function(t) {
+            let row = $("<tr>");
+            row.append($("<td>").text(t.suite));
+            row.append($("<td>").text(t.test));
+            row.append($("<td>").text(t.client));
+            row.append($("<td>").text(t.failures));
+            row.append($("<td>").append(hist.resultLink(t.firstFailed)));
+            row.append($("<td>").append(t.lastPassed ? hist.resultLink(t.lastPassed) : "never"));
+            let cell = $("<td>");
+            let link = $("<a href='#'>").text("show").on("click", function(ev) {
+                ev.preventDefault();
+                hist.loadTest(t, cell);
+            });
+            row.append(cell.append(link));
+            tbody.append(row);
+        });
+    },
+
+    // loadTest shows the results of a single test as a row of boxes.
+    loadTest: function(t, cell) {
+        let query = $.param({suite: t.suite, test: t.test, client: t.client});
+        $.getJSON("/api/history/test?" + query, function(results) {
+            cell.empty();
+            results.forEach(function(r) {
+                let box = $("<a class='result'>").attr("href", hist.testURL(r));
+                box.addClass(r.pass ? "bg-success" : "bg-danger");
+                box.attr("title", r.time + "\n" + (r.version || "unknown version"));
+                cell.append(box);
+            });
+        });
+    },
+
+    resultLink: function(r) {
+        let text = (r.version || "unknown version") + " (" + new Date(r.time).toLocaleDateString() + ")";
+        return $("<a>").attr("href", hist.testURL(r)).text(text);
+    },
+
+    suiteURL: function(file) {
+        return "/?" + $.param({page: "v-pills-results-tab", suite: file});
+    },
+
+    testURL: function(r) {
+        return hist.suiteURL(r.file);
+    },
+};
+
+$(document).ready(hist.init);
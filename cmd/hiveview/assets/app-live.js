@@ -0,0 +1,126 @@
+// The live run page. It shows events of a running hive instance,
+// which are streamed from hive's --live.addr endpoint.
+
+var live = {
+    suites: {}, // suite ID -> name
+    tests: {},  // test ID -> {row, clients}
+    counts: {running: 0, pass: 0, fail: 0},
+
+    // streamURL returns the event stream location. It can be given in
+    // the 'stream' query parameter, and defaults to the hiveview proxy.
+    streamURL: function() {
+        let params = new URLSearchParams(window.location.search);
+        return params.get("stream") || "/live/events";
+    },
+
+    connect: function() {
+        let url = live.streamURL();
+        $("#stream").text(url);
+        let source = new EventSource(url);
+        source.onopen = function() {
+            live.setStatus("connected", "badge-success");
+            // The stream replays recent events, so start over.
+            live.reset();
+        };
+        source.onerror = function() {
+            live.setStatus("disconnected", "badge-danger");
+        };
+        let types = [
+            "simStart", "simEnd", "suiteStart", "suiteEnd", "testStart", "testEnd",
+            "clientQueued", "clientStart", "clientReady", "clientStarted", "clientStartFailed", "clientStop",
+            "clientCrash", "networkConnect", "networkDisconnect", "exec", "artifact",
+        ];
+        types.forEach(function(t) { source.addEventListener(t, live.handle); });
+    },
+
+    setStatus: function(text, cls) {
+        $("#status").text(text).attr("class", "badge " + cls);
+    },
+
+    reset: function() {
+        live.suites = {};
+        live.tests = {};
+        live.counts = {running: 0, pass: 0, fail: 0};
+        $("#tests tbody").empty();
+        $("#log tbody").empty();
+        live.showCounts();
+    },
+
+    showCounts: function() {
+        $("#count-running").text(live.counts.running);
+        $("#count-pass").text(live.counts.pass);
+        $("#count-fail").text(live.counts.fail);
+    },
+
+    handle: function(msg) {
+        let ev = JSON.parse(msg.data);
+        live.logEvent(ev);
+
+        switch (ev.type) {
+        case "simStart":
+            // IDs restart with every simulator.
+            live.suites = {};
+            live.tests = {};
+            $("#simulator").text(ev.simulator);
+            break;
+        case "suiteStart":
+            live.suites[ev.suite] = ev.name;
+            break;
+        case "testStart":
+            live.addTest(ev);
+            break;
+        case "clientStart":
+            let test = live.tests[ev.test];
+            if (test) {
+                test.clients++;
+                test.row.find(".clients").text(test.clients);
+            }
+            break;
+        case "testEnd":
+            live.endTest(ev);
+            break;
+        }
+    },
+
+    addTest: function(ev) {
+        let row = $("<tr>");
+        row.append($("<td>").text(new Date(ev.time).toLocaleTimeString()));
+        row.append($("<td>").text(live.suites[ev.suite] || ev.suite));
+        row.append($("<td>").text(ev.name));
+        row.append($("<td class='clients'>").text("0"));
+        row.append($("<td class='status'>").html('<span class="badge badge-info">running</span>'));
+        $("#tests tbody").prepend(row);
+        live.tests[ev.test] = {row: row, clients: 0};
+        live.counts.running++;
+        live.showCounts();
+    },
+
+    endTest: function(ev) {
+        let test = live.tests[ev.test];
+        if (!test) {
+            return;
+        }
+        let badge = ev.pass ? '<span class="badge badge-success">pass</span>' : '<span class="badge badge-danger">fail</span>';
+        test.row.find(".status").html(badge);
+        live.counts.running--;
+        live.counts[ev.pass ? "pass" : "fail"]++;
+        live.showCounts();
+        delete live.tests[ev.test];
+    },
+
+    logEvent: function(ev) {
+        let subject = ev.simulator || ev.name || "";
+        if (ev.test) {
+            subject = "test " + ev.test + (ev.name ? " " + ev.name : "");
+        }
+        let details = [ev.client ? ev.client.substring(0, 8) : "", ev.network || "", ev.details || ""];
+        let row = $("<tr>");
+        row.append($("<td>").text(new Date(ev.time).toLocaleTimeString()));
+        row.append($("<td>").text(ev.type));
+        row.append($("<td>").text(subject));
+        row.append($("<td>").text(details.filter(Boolean).join(" ")));
+        $("#log tbody").prepend(row);
+    },
+};
+
+$(document).ready(live.connect);
@@ -111,6 +111,99 @@ function fetchFile(line /* optional jump to line */ ) {
     });
 }
 
+// testEndMarker is printed by hivesim after the output of a test, tagged with the test ID.
+const testEndMarker = "--- end of test output";
+
+// testLogChunkSize is the amount of simulator output loaded per request.
+const testLogChunkSize = 1 << 20;
+
+// testLogMaxSize limits the amount of simulator output scanned for a single test.
+const testLogMaxSize = 64 << 20;
+
+// fetchTestLog loads the simulator output of a single test, starting at the offset where
+// the test began. Docker delivers container output with a delay, so the end offset of the
+// test may be too early. Output of tests run by hivesim is tagged with the test ID and ends
+// with a marker line, so loading continues until the marker is found. For simulators
+// without tagging, the output up to the recorded end offset is shown.
+function fetchTestLog(url, test) {
+    hacks.showSpinner(true);
+    let marker = "[test " + test.id + "] " + testEndMarker;
+    let decoder = new TextDecoder();
+    let chunks = [];
+    let text = "";
+    let loadChunk = function(offset) {
+        let headers = {"Range": "bytes=" + offset + "-" + (offset + testLogChunkSize - 1)};
+        return fetch(url, {headers: headers}).then(function(resp) {
+            // Static file servers reject ranges past the end of the file.
+            if (resp.status == 416) {
+                return {buf: new ArrayBuffer(0), eof: true};
+            }
+            if (!resp.ok) {
+                throw new Error("status " + resp.status);
+            }
+            return resp.arrayBuffer().then(function(buf) {
+                // Servers without range support send the whole file.
+                if (resp.status != 206) {
+                    return {buf: buf.slice(offset), eof: true};
+                }
+                return {buf: buf, eof: buf.byteLength < testLogChunkSize};
+            });
+        }).then(function(r) {
+            let searchFrom = Math.max(0, text.length - marker.length - 1);
+            chunks.push(r.buf);
+            text += decoder.decode(r.buf, {stream: !r.eof});
+            let size = offset + r.buf.byteLength - test.begin;
+            if (r.eof || size >= testLogMaxSize || text.indexOf(marker, searchFrom) >= 0) {
+                return;
+            }
+            return loadChunk(offset + r.buf.byteLength);
+        });
+    };
+    loadChunk(test.begin).then(function() {
+        hacks.showSpinner(false);
+        document.title = url + " (test " + test.id + ")";
+        hacks.setContent(filterTestLog(text, chunks, test), url);
+    }).catch(function(err) {
+        hacks.showSpinner(false);
+        alert("Failed to load " + url + "\nerror:" + err);
+    });
+}
+
+// filterTestLog selects the lines of the test from the simulator output, which starts
+// where the test began. Lines written by the test are tagged with its ID. If no line is
+// tagged, the simulator doesn't support tagging, and all output up to the end offset of
+// the test is shown.
+function filterTestLog(text, chunks, test) {
+    let tag = "[test " + test.id + "] ";
+    let isTagged = function(line) { return line.startsWith(tag); };
+    let lines = text.split("\n");
+    let end = lines.indexOf(tag + testEndMarker);
+    let last = -1;
+    lines.forEach(function(line, i) { if (isTagged(line)) { last = i; } });
+    if (end >= 0) {
+        lines = lines.slice(0, end);
+    } else if (last >= 0) {
+        // The marker is missing if the test output was written by an older hivesim.
+        lines = lines.slice(0, last + 1);
+    } else {
+        let bytes = new Uint8Array(test.end - test.begin);
+        let pos = 0;
+        for (let i = 0; i < chunks.length && pos < bytes.length; i++) {
+            let chunk = new Uint8Array(chunks[i], 0, Math.min(chunks[i].byteLength, bytes.length - pos));
+            bytes.set(chunk, pos);
+            pos += chunk.length;
+        }
+        lines = new TextDecoder().decode(bytes.subarray(0, pos)).split("\n");
+    }
+    if (!test.all && lines.some(isTagged)) {
+        lines = lines.filter(isTagged);
+    }
+    if (lines.length > 0 && lines[lines.length - 1] == "") {
+        lines.pop();
+    }
+    return lines.join("\n");
+}
+
 function navigate() {
     // Check for line number in hash.
     var num = null;
@@ -121,8 +214,24 @@ function navigate() {
     let params = new URLSearchParams(location.search);
     if (params) {
         let f = params.get("file");
+        if (f && params.get("test")) {
+            let test = {
+                id: params.get("test"),
+                begin: parseInt(params.get("begin")),
+                end: parseInt(params.get("end")),
+                all: params.get("all") == "1",
+            };
+            $("#fileload").val(f)
+            params.set("all", test.all ? "0" : "1");
+            $("#test-log-all").text(test.all ? "Only test output" : "All output during test");
+            $("#test-log-all").attr("href", "?" + params.toString()).show();
+            hacks.showText("viewer", "Loading file...");
+            fetchTestLog(f, test);
+            return true;
+        }
         if (f) {
             $("#fileload").val(f)
+            $("#test-log-all").hide();
             hacks.showText("viewer", "Loading file...");
             fetchFile(num);
             return true;
@@ -1,4 +1,4 @@
-const resultsRoot = "/results/"
+const resultsRoot = "results/"
 
 utils = {
     /*
@@ -345,7 +345,7 @@ function loadTestSuite(suitefile, doneFn) {
     //let filename = "results/"+suitefile
     let filename = suitefile
     progress("Loading " + filename);
-    var jqxhr = $.getJSON(resultsRoot + "/" + filename, function(data) {
+    var jqxhr = $.getJSON(resultsRoot + filename, function(data) {
         doneFn(true);
         onSuiteData(data, filename);
     }).fail(function(x, status, err) {
@@ -371,7 +371,7 @@ function logFolder(jsonsource, client) {
 }
 
 /* Formatting function for row details */
-function formatTestDetails(d) {
+function formatTestDetails(d, simLog) {
     // `d` is the original data object for the row
     var txt = '<div class="details-box">';
     txt += "<p><b>Name</b><br/>" + utils.html_encode(d.name) + "</p>";
@@ -387,10 +387,60 @@ function formatTestDetails(d) {
         txt += utils.urls_to_links(utils.html_encode(d.summaryResult.details));
         txt += "</code></pre></p>";
     }
+    for (let id in d.clientInfo) {
+        let info = d.clientInfo[id];
+        if (info.logExcerpt && info.logExcerpt.length > 0) {
+            let title = "Log excerpt: " + logview(resultsRoot + info.logFile, info.name + " (" + id + ")");
+            txt += "<p><b>" + title + "</b><pre><code>";
+            txt += utils.html_encode(info.logExcerpt.join("\n"));
+            txt += "</code></pre></p>";
+        }
+    }
+    if (d.simLogOffsets && simLog) {
+        let url = "viewer.html?file=" + escape(resultsRoot + simLog) + "&test=" + d.id +
+            "&begin=" + d.simLogOffsets.begin + "&end=" + d.simLogOffsets.end;
+        txt += "<p><b>Simulator output</b><br/>" + utils.get_link(url, "Show simulator output of this test") + "</p>";
+    }
+    if (d.artifacts) {
+        let links = [];
+        for (let name in d.artifacts) {
+            links.push(utils.get_link("results/" + d.artifacts[name], name));
+        }
+        txt += "<p><b>Artifacts</b><br/>" + links.join(", ") + "</p>";
+    }
+    if (d.events && d.events.length > 0) {
+        txt += "<p><b>Timeline</b>" + formatTestEvents(d) + "</p>";
+    }
     txt += "</div>";
     return txt;
 }
 
+// formatTestEvents renders the event timeline of a test case as a table.
+function formatTestEvents(d) {
+    let start = new Date(d.start);
+    let rows = d.events.map(function(ev) {
+        let offset = (new Date(ev.time) - start) / 1000;
+        let client = "";
+        if (ev.client) {
+            let info = d.clientInfo ? d.clientInfo[ev.client] : null;
+            if (info) {
+                client = logview("results/" + info.logFile, info.name + " (" + ev.client + ")");
+            } else {
+                client = utils.html_encode(ev.client);
+            }
+        }
+        let details = utils.html_encode(ev.details || "");
+        if (ev.network) {
+            details = "network " + utils.html_encode(ev.network) + (details ? ", " + details : "");
+        }
+        return "<tr><td>+" + offset.toFixed(3) + "s</td><td>" + utils.html_encode(ev.type) +
+            "</td><td>" + client + "</td><td>" + details + "</td></tr>";
+    });
+    return '<table class="table table-condensed timeline"><thead><tr>' +
+        "<th>Time</th><th>Event</th><th>Client</th><th>Details</th>" +
+        "</tr></thead><tbody>" + rows.join("") + "</tbody></table>";
+}
+
 function onSuiteData(data, jsonsource) {
     // data structure of suite data:
     /*
@@ -444,6 +494,7 @@ function onSuiteData(data, jsonsource) {
     // Convert to list
     let cases = []
     for (var k in data.testCases) {
+        data.testCases[k].id = k;
         cases.push(data.testCases[k])
     }
     progress("got " + cases.length + " testcases")
@@ -495,7 +546,11 @@ function onSuiteData(data, jsonsource) {
                     let logs = []
                     for (let instanceID in clientInfo) {
                         let instanceInfo = clientInfo[instanceID]
-                        logs.push(logview("results/" + instanceInfo.logFile, instanceInfo.name))
+                        let link = logview("results/" + instanceInfo.logFile, instanceInfo.name)
+                        if (instanceInfo.crash) {
+                            link += " (crashed)"
+                        }
+                        logs.push(link)
                     }
                     return logs.join(",")
                 },
@@ -515,7 +570,7 @@ function onSuiteData(data, jsonsource) {
             tr.removeClass('shown');
         } else {
             // Open this row
-            row.child(formatTestDetails(row.data())).show();
+            row.child(formatTestDetails(row.data(), data.simLog)).show();
             tr.addClass('shown');
         }
     });
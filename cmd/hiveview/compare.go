@@ -0,0 +1,365 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/hive/internal/libhive"
+)
+
+// Duration changes are reported when a test takes this much longer or shorter,
+// both relative to the duration in the first run and in absolute time.
+const (
+	compareMinDurationRatio  = 0.5
+	compareMinDurationChange = 5 * time.Second
+)
+
+// runResults is the set of suites belonging to a run.
+type runResults struct {
+	name   string
+	suites []*libhive.TestSuite
+	files  []string // suite file names, relative to the run root
+}
+
+// loadRun loads the test suites of a run. The name can refer to
+//
+//   - a suite file,
+//   - a simulator log file, selecting all suites produced by the simulator run,
+//   - a run manifest file in the 'manifests' directory, selecting all suites of the hive run,
+//   - a directory, selecting all suites in it.
+func loadRun(fsys fs.FS, name string) (*runResults, error) {
+	run := &runResults{name: name}
+	stat, err := fs.Stat(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	if stat.IsDir() {
+		err := walkSummaryFiles(fsys, name, func(suite *libhive.TestSuite, fi fs.FileInfo) error {
+			run.add(suite, path.Join(name, fi.Name()))
+			return nil
+		})
+		return run, err
+	}
+
+	// Find suites referencing a simulator log or manifest.
+	var match func(*libhive.TestSuite) bool
+	switch {
+	case strings.HasSuffix(name, ".log"):
+		match = func(s *libhive.TestSuite) bool { return s.SimulatorLog == name }
+	case path.Dir(name) == "manifests":
+		match = func(s *libhive.TestSuite) bool { return s.RunManifest == name }
+	default:
+		suite, _ := parseSuite(fsys, name)
+		if suite == nil {
+			return nil, fmt.Errorf("%s is not a valid suite file", name)
+		}
+		run.add(suite, name)
+		return run, nil
+	}
+	err = walkSummaryFiles(fsys, ".", func(suite *libhive.TestSuite, fi fs.FileInfo) error {
+		if match(suite) {
+			run.add(suite, fi.Name())
+		}
+		return nil
+	})
+	if err == nil && len(run.suites) == 0 {
+		err = fmt.Errorf("no test suites found for %s", name)
+	}
+	return run, err
+}
+
+func (r *runResults) add(suite *libhive.TestSuite, file string) {
+	r.suites = append(r.suites, suite)
+	r.files = append(r.files, file)
+}
+
+// runComparison is the result of comparing two runs.
+type runComparison struct {
+	A              string          `json:"a"`
+	B              string          `json:"b"`
+	TestsA         int             `json:"testsA"`
+	TestsB         int             `json:"testsB"`
+	ClientVersions []versionChange `json:"clientVersions"`
+	NewFailures    []testDiff      `json:"newFailures"`
+	Fixed          []testDiff      `json:"fixed"`
+	Appeared       []testDiff      `json:"appeared"`
+	Disappeared    []testDiff      `json:"disappeared"`
+	Slower         []testDiff      `json:"slower"`
+	Faster         []testDiff      `json:"faster"`
+}
+
+type versionChange struct {
+	Client string `json:"client"`
+	A      string `json:"a"`
+	B      string `json:"b"`
+}
+
+// testDiff describes a test case present in one or both runs.
+type testDiff struct {
+	Suite   string `json:"suite"`
+	Test    string `json:"test"`
+	Clients string `json:"clients"`
+
+	// These are set for the run(s) containing the test.
+	A *testRef `json:"a,omitempty"`
+	B *testRef `json:"b,omitempty"`
+}
+
+type testRef struct {
+	File     string  `json:"file"` // suite file
+	ID       string  `json:"id"`   // test ID within the suite
+	Pass     bool    `json:"pass"`
+	Duration float64 `json:"duration"` // in seconds
+}
+
+// testKey identifies a test case across runs.
+type testKey struct {
+	suite, test, clients string
+}
+
+func (d *testDiff) durationChange() time.Duration {
+	return time.Duration((d.B.Duration - d.A.Duration) * float64(time.Second))
+}
+
+// indexRun collects the test cases of a run by key. Tests with equal keys
+// are distinguished by a counter.
+func indexRun(run *runResults) map[testKey]*testRef {
+	index := make(map[testKey]*testRef)
+	for i, suite := range run.suites {
+		ids := make([]libhive.TestID, 0, len(suite.TestCases))
+		for id := range suite.TestCases {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+		for _, id := range ids {
+			test := suite.TestCases[id]
+			key := testKey{suite.Name, test.Name, strings.Join(testClients(test), ",")}
+			for n := 2; index[key] != nil; n++ {
+				key.test = fmt.Sprintf("%s (#%d)", test.Name, n)
+			}
+			ref := &testRef{File: run.files[i], ID: id.String(), Pass: test.SummaryResult.Pass}
+			if !test.End.IsZero() {
+				ref.Duration = test.End.Sub(test.Start).Seconds()
+			}
+			index[key] = ref
+		}
+	}
+	return index
+}
+
+// testClients returns the sorted client names of a test case.
+func testClients(test *libhive.TestCase) []string {
+	names := []string{}
+	for _, client := range test.ClientInfo {
+		if !contains(names, client.Name) {
+			names = append(names, client.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// runClientVersions merges the client versions of all suites in a run.
+func runClientVersions(run *runResults) map[string]string {
+	versions := make(map[string]string)
+	for _, suite := range run.suites {
+		for client, version := range suite.ClientVersions {
+			versions[client] = version
+		}
+	}
+	return versions
+}
+
+// compareRuns compares the test results of two runs.
+func compareRuns(a, b *runResults) *runComparison {
+	c := &runComparison{
+		A:              a.name,
+		B:              b.name,
+		ClientVersions: []versionChange{},
+		NewFailures:    []testDiff{},
+		Fixed:          []testDiff{},
+		Appeared:       []testDiff{},
+		Disappeared:    []testDiff{},
+		Slower:         []testDiff{},
+		Faster:         []testDiff{},
+	}
+
+	// Compare client versions.
+	va, vb := runClientVersions(a), runClientVersions(b)
+	for client, version := range va {
+		if vb[client] != version {
+			c.ClientVersions = append(c.ClientVersions, versionChange{client, version, vb[client]})
+		}
+	}
+	for client, version := range vb {
+		if _, ok := va[client]; !ok {
+			c.ClientVersions = append(c.ClientVersions, versionChange{client, "", version})
+		}
+	}
+	sort.Slice(c.ClientVersions, func(i, j int) bool {
+		return c.ClientVersions[i].Client < c.ClientVersions[j].Client
+	})
+
+	// Compare tests.
+	ia, ib := indexRun(a), indexRun(b)
+	c.TestsA, c.TestsB = len(ia), len(ib)
+	for key, ra := range ia {
+		d := testDiff{Suite: key.suite, Test: key.test, Clients: key.clients, A: ra, B: ib[key]}
+		switch {
+		case d.B == nil:
+			c.Disappeared = append(c.Disappeared, d)
+			continue
+		case ra.Pass && !d.B.Pass:
+			c.NewFailures = append(c.NewFailures, d)
+		case !ra.Pass && d.B.Pass:
+			c.Fixed = append(c.Fixed, d)
+		}
+		change := d.durationChange()
+		if ra.Duration == 0 {
+			continue
+		}
+		if change >= compareMinDurationChange && change.Seconds()/ra.Duration >= compareMinDurationRatio {
+			c.Slower = append(c.Slower, d)
+		} else if -change >= compareMinDurationChange && -change.Seconds()/ra.Duration >= compareMinDurationRatio {
+			c.Faster = append(c.Faster, d)
+		}
+	}
+	for key, rb := range ib {
+		if ia[key] == nil {
+			c.Appeared = append(c.Appeared, testDiff{Suite: key.suite, Test: key.test, Clients: key.clients, B: rb})
+		}
+	}
+
+	for _, list := range [][]testDiff{c.NewFailures, c.Fixed, c.Appeared, c.Disappeared} {
+		sortDiffs(list)
+	}
+	sort.Slice(c.Slower, func(i, j int) bool { return c.Slower[i].durationChange() > c.Slower[j].durationChange() })
+	sort.Slice(c.Faster, func(i, j int) bool { return c.Faster[i].durationChange() < c.Faster[j].durationChange() })
+	return c
+}
+
+func sortDiffs(list []testDiff) {
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Suite != b.Suite {
+			return a.Suite < b.Suite
+		}
+		if a.Test != b.Test {
+			return a.Test < b.Test
+		}
+		return a.Clients < b.Clients
+	})
+}
+
+// writeText writes a human-readable report of the comparison.
+func (c *runComparison) writeText(w io.Writer) {
+	fmt.Fprintf(w, "A: %s (%d tests)\n", c.A, c.TestsA)
+	fmt.Fprintf(w, "B: %s (%d tests)\n", c.B, c.TestsB)
+
+	if len(c.ClientVersions) > 0 {
+		fmt.Fprintf(w, "\nClient versions:\n")
+		for _, v := range c.ClientVersions {
+			fmt.Fprintf(w, "  %s: %s -> %s\n", v.Client, versionOrNone(v.A), versionOrNone(v.B))
+		}
+	}
+	writeDiffs(w, "New failures", c.NewFailures, "")
+	writeDiffs(w, "Fixed", c.Fixed, "")
+	writeDiffs(w, "Appeared", c.Appeared, "")
+	writeDiffs(w, "Disappeared", c.Disappeared, "")
+	writeDiffs(w, "Slower", c.Slower, "duration")
+	writeDiffs(w, "Faster", c.Faster, "duration")
+}
+
+func writeDiffs(w io.Writer, title string, diffs []testDiff, mode string) {
+	if len(diffs) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n%s (%d):\n", title, len(diffs))
+	for _, d := range diffs {
+		fmt.Fprintf(w, "  %s / %s", d.Suite, d.Test)
+		if d.Clients != "" {
+			fmt.Fprintf(w, " [%s]", d.Clients)
+		}
+		if mode == "duration" {
+			fmt.Fprintf(w, ": %v -> %v", seconds(d.A.Duration), seconds(d.B.Duration))
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second)).Round(time.Millisecond)
+}
+
+func versionOrNone(v string) string {
+	if v == "" {
+		return "(none)"
+	}
+	return v
+}
+
+// runCompare implements the -compare command.
+func runCompare(runA, runB string) error {
+	a, err := loadRunArg(runA)
+	if err != nil {
+		return err
+	}
+	b, err := loadRunArg(runB)
+	if err != nil {
+		return err
+	}
+	compareRuns(a, b).writeText(os.Stdout)
+	return nil
+}
+
+// loadRunArg loads a run given on the command line. Suites referencing simulator logs
+// and manifests are searched in the directory containing the file.
+func loadRunArg(arg string) (*runResults, error) {
+	root, name := filepath.Dir(arg), filepath.Base(arg)
+	if stat, err := os.Stat(arg); err == nil && stat.IsDir() {
+		root, name = arg, "."
+	} else if filepath.Base(root) == "manifests" {
+		root, name = filepath.Dir(root), "manifests/"+name
+	}
+	run, err := loadRun(os.DirFS(root), name)
+	if err != nil {
+		return nil, err
+	}
+	run.name = arg
+	return run, nil
+}
+
+type serveCompare struct{ fsys fs.FS }
+
+// ServeHTTP serves the comparison of runs given by the 'a' and 'b' query
+// parameters, which are relative to the log directory.
+func (h serveCompare) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var runs [2]*runResults
+	for i, param := range []string{"a", "b"} {
+		name := r.URL.Query().Get(param)
+		if name == "" || !fs.ValidPath(name) {
+			http.Error(w, "invalid run "+param, http.StatusBadRequest)
+			return
+		}
+		run, err := loadRun(h.fsys, name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		runs[i] = run
+	}
+	log.Printf("Comparing %s and %s", runs[0].name, runs[1].name)
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(compareRuns(runs[0], runs[1]))
+}
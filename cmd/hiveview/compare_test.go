@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/ethereum/hive/internal/libhive"
+)
+
+var testTime = time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// makeTest creates a test case with the given result, duration and clients.
+// A zero duration creates a test without end time.
+func makeTest(name string, pass bool, duration time.Duration, clients ...string) *libhive.TestCase {
+	test := &libhive.TestCase{
+		Name:          name,
+		Start:         testTime,
+		SummaryResult: libhive.TestResult{Pass: pass},
+		ClientInfo:    make(map[string]*libhive.ClientInfo),
+	}
+	if duration != 0 {
+		test.End = testTime.Add(duration)
+	}
+	for i, client := range clients {
+		id := string(rune('a' + i))
+		test.ClientInfo[id] = &libhive.ClientInfo{ID: id, Name: client}
+	}
+	return test
+}
+
+// makeSuite creates a suite containing the given tests.
+func makeSuite(name, simLog string, tests ...*libhive.TestCase) *libhive.TestSuite {
+	suite := &libhive.TestSuite{
+		Name:           name,
+		SimulatorLog:   simLog,
+		ClientVersions: make(map[string]string),
+		TestCases:      make(map[libhive.TestID]*libhive.TestCase),
+	}
+	for i, test := range tests {
+		suite.TestCases[libhive.TestID(i+1)] = test
+	}
+	return suite
+}
+
+// suiteFile encodes a suite as a file of a log directory.
+func suiteFile(t *testing.T, suite *libhive.TestSuite) *fstest.MapFile {
+	t.Helper()
+	data, err := json.Marshal(suite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fstest.MapFile{Data: data, ModTime: testTime}
+}
+
+func diffNames(diffs []testDiff) []string {
+	names := []string{}
+	for _, d := range diffs {
+		names = append(names, d.Test)
+	}
+	return names
+}
+
+func TestIndexRunDuplicates(t *testing.T) {
+	run := &runResults{files: []string{"1.json"}}
+	run.suites = append(run.suites, makeSuite("suite", "sim.log",
+		makeTest("test", true, 0),
+		makeTest("test", false, 0),
+		makeTest("test", true, 0, "geth"),
+		makeTest("test", true, 0),
+	))
+	index := indexRun(run)
+
+	want := map[testKey]string{
+		{"suite", "test", ""}:      "1",
+		{"suite", "test (#2)", ""}: "2",
+		{"suite", "test", "geth"}:  "3",
+		{"suite", "test (#3)", ""}: "4",
+	}
+	if len(index) != len(want) {
+		t.Fatalf("wrong number of tests %d, want %d", len(index), len(want))
+	}
+	for key, id := range want {
+		ref := index[key]
+		if ref == nil {
+			t.Errorf("missing test %+v", key)
+			continue
+		}
+		if ref.ID != id || ref.File != "1.json" {
+			t.Errorf("wrong ref for %+v: %+v", key, ref)
+		}
+	}
+}
+
+func TestCompareRuns(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     []*libhive.TestCase
+		newFail  []string
+		fixed    []string
+		appeared []string
+		gone     []string
+		slower   []string
+		faster   []string
+	}{
+		{
+			name: "results",
+			a: []*libhive.TestCase{
+				makeTest("unchanged", true, time.Second),
+				makeTest("breaks", true, time.Second),
+				makeTest("fixed", false, time.Second),
+				makeTest("removed", true, time.Second),
+				makeTest("clients", true, time.Second, "geth"),
+			},
+			b: []*libhive.TestCase{
+				makeTest("unchanged", true, time.Second),
+				makeTest("breaks", false, time.Second),
+				makeTest("fixed", true, time.Second),
+				makeTest("added", false, time.Second),
+				makeTest("clients", true, time.Second, "besu"),
+			},
+			newFail:  []string{"breaks"},
+			fixed:    []string{"fixed"},
+			appeared: []string{"added", "clients"},
+			gone:     []string{"clients", "removed"},
+		},
+		{
+			name: "durations",
+			a: []*libhive.TestCase{
+				makeTest("slower", true, 10*time.Second),
+				makeTest("much-slower", true, 10*time.Second),
+				makeTest("small-change", true, 10*time.Second),
+				makeTest("small-ratio", true, 100*time.Second),
+				makeTest("faster", true, 20*time.Second),
+				makeTest("no-end", true, 0),
+			},
+			b: []*libhive.TestCase{
+				makeTest("slower", true, 16*time.Second),
+				makeTest("much-slower", true, time.Minute),
+				makeTest("small-change", true, 14*time.Second),
+				makeTest("small-ratio", true, 110*time.Second),
+				makeTest("faster", true, 9*time.Second),
+				makeTest("no-end", true, time.Minute),
+			},
+			slower: []string{"much-slower", "slower"},
+			faster: []string{"faster"},
+		},
+		{
+			name: "duplicates",
+			a: []*libhive.TestCase{
+				makeTest("dup", true, time.Second),
+				makeTest("dup", true, time.Second),
+			},
+			b: []*libhive.TestCase{
+				makeTest("dup", true, time.Second),
+				makeTest("dup", false, time.Second),
+				makeTest("dup", true, time.Second),
+			},
+			newFail:  []string{"dup (#2)"},
+			appeared: []string{"dup (#3)"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &runResults{name: "a", files: []string{"a.json"}}
+			a.suites = append(a.suites, makeSuite("suite", "a.log", test.a...))
+			b := &runResults{name: "b", files: []string{"b.json"}}
+			b.suites = append(b.suites, makeSuite("suite", "b.log", test.b...))
+			c := compareRuns(a, b)
+
+			check := func(category string, diffs []testDiff, want []string) {
+				if want == nil {
+					want = []string{}
+				}
+				if names := diffNames(diffs); !reflect.DeepEqual(names, want) {
+					t.Errorf("wrong %s: %q, want %q", category, names, want)
+				}
+			}
+			check("new failures", c.NewFailures, test.newFail)
+			check("fixed", c.Fixed, test.fixed)
+			check("appeared", c.Appeared, test.appeared)
+			check("disappeared", c.Disappeared, test.gone)
+			check("slower", c.Slower, test.slower)
+			check("faster", c.Faster, test.faster)
+			if c.TestsA != len(test.a) || c.TestsB != len(test.b) {
+				t.Errorf("wrong test counts %d, %d", c.TestsA, c.TestsB)
+			}
+		})
+	}
+}
+
+func TestCompareClientVersions(t *testing.T) {
+	a := &runResults{files: []string{"a.json"}, suites: []*libhive.TestSuite{makeSuite("suite", "a.log")}}
+	a.suites[0].ClientVersions = map[string]string{"geth": "1.0", "besu": "2.0", "nethermind": "3.0"}
+	b := &runResults{files: []string{"b.json"}, suites: []*libhive.TestSuite{makeSuite("suite", "b.log")}}
+	b.suites[0].ClientVersions = map[string]string{"geth": "1.1", "besu": "2.0", "erigon": "4.0"}
+
+	want := []versionChange{
+		{"erigon", "", "4.0"},
+		{"geth", "1.0", "1.1"},
+		{"nethermind", "3.0", ""},
+	}
+	if c := compareRuns(a, b); !reflect.DeepEqual(c.ClientVersions, want) {
+		t.Fatalf("wrong version changes %+v", c.ClientVersions)
+	}
+}
+
+func TestLoadRun(t *testing.T) {
+	s1 := makeSuite("s1", "1-simulator-a.log", makeTest("t1", true, time.Second))
+	s1.RunManifest = "manifests/run1.json"
+	s2 := makeSuite("s2", "1-simulator-a.log", makeTest("t2", true, time.Second))
+	s2.RunManifest = "manifests/run1.json"
+	s3 := makeSuite("s3", "2-simulator-b.log", makeTest("t3", true, time.Second))
+	s3.RunManifest = "manifests/run2.json"
+	fsys := fstest.MapFS{
+		"1-s1.json":           suiteFile(t, s1),
+		"2-s2.json":           suiteFile(t, s2),
+		"3-s3.json":           suiteFile(t, s3),
+		"invalid.json":        &fstest.MapFile{Data: []byte("{")},
+		"1-simulator-a.log":   &fstest.MapFile{},
+		"manifests/run1.json": &fstest.MapFile{Data: []byte("{}")},
+		"old/4-s1.json":       suiteFile(t, s1),
+	}
+
+	tests := []struct {
+		name  string
+		files []string
+		err   bool
+	}{
+		{name: "3-s3.json", files: []string{"3-s3.json"}},
+		{name: "1-simulator-a.log", files: []string{"2-s2.json", "1-s1.json"}},
+		{name: "manifests/run1.json", files: []string{"2-s2.json", "1-s1.json"}},
+		{name: "old", files: []string{"old/4-s1.json"}},
+		{name: "invalid.json", err: true},
+		{name: "missing.json", err: true},
+		{name: "manifests/run3.json", err: true},
+	}
+	for _, test := range tests {
+		run, err := loadRun(fsys, test.name)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(run.files, test.files) {
+			t.Errorf("%s: wrong files %q, want %q", test.name, run.files, test.files)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Log files may be compressed by -gc. The compressed file has the same name as the
+// original, with compressedExt appended. Suite files keep referencing the original name.
+const compressedExt = ".gz"
+
+// openResultFile opens a file in the log directory. If the file does not exist, but
+// a compressed version does, the compressed file is opened and decompressed.
+func openResultFile(fsys fs.FS, name string) (io.ReadCloser, error) {
+	f, err := fsys.Open(name)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return f, err
+	}
+	cf, cerr := fsys.Open(name + compressedExt)
+	if cerr != nil {
+		return nil, err
+	}
+	zr, err := gzip.NewReader(cf)
+	if err != nil {
+		cf.Close()
+		return nil, err
+	}
+	return &gzipFile{zr, cf}, nil
+}
+
+type gzipFile struct {
+	*gzip.Reader
+	file fs.File
+}
+
+func (f *gzipFile) Close() error {
+	f.Reader.Close()
+	return f.file.Close()
+}
+
+// resultFileSize returns the size of a file in the log directory, or of its
+// compressed version.
+func resultFileSize(fsys fs.FS, name string) (int64, bool) {
+	for _, n := range []string{name, name + compressedExt} {
+		if stat, err := fs.Stat(fsys, n); err == nil && !stat.IsDir() {
+			return stat.Size(), true
+		}
+	}
+	return 0, false
+}
+
+// compressFile compresses a file in dir and deletes the original. It returns the size of
+// the compressed file.
+func compressFile(dir, name string) (int64, error) {
+	file := filepath.Join(dir, filepath.FromSlash(name))
+	src, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	stat, err := src.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	tmp := file + compressedExt + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	zw := gzip.NewWriter(out)
+	zw.Name = path.Base(name)
+	zw.ModTime = stat.ModTime()
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = out.Close()
+	} else {
+		out.Close()
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	cstat, err := os.Stat(tmp)
+	if err != nil {
+		return 0, err
+	}
+	os.Chtimes(tmp, stat.ModTime(), stat.ModTime())
+	if err := os.Rename(tmp, file+compressedExt); err != nil {
+		return 0, err
+	}
+	return cstat.Size(), os.Remove(file)
+}
+
+const (
+	compressionSampleFiles = 8       // number of files sampled by estimateCompressionRatio
+	compressionSampleSize  = 1 << 20 // bytes sampled from each file
+)
+
+// estimateCompressionRatio compresses the beginning of some of the given files,
+// and returns the average ratio of compressed to original size.
+func estimateCompressionRatio(fsys fs.FS, names []string) float64 {
+	var in, out int64
+	for i, sampled := 0, 0; i < len(names) && sampled < compressionSampleFiles; i++ {
+		f, err := fsys.Open(names[i])
+		if err != nil {
+			continue
+		}
+		var counter byteCounter
+		zw := gzip.NewWriter(&counter)
+		n, err := io.Copy(zw, io.LimitReader(f, compressionSampleSize))
+		f.Close()
+		if err != nil || zw.Close() != nil || n == 0 {
+			continue
+		}
+		in += n
+		out += int64(counter)
+		sampled++
+	}
+	if in == 0 {
+		return 1
+	}
+	return float64(out) / float64(in)
+}
+
+type byteCounter int64
+
+func (c *byteCounter) Write(b []byte) (int, error) {
+	*c += byteCounter(len(b))
+	return len(b), nil
+}
+
+// resultFileServer serves files in the log directory. Requests for files which
+// have been compressed are answered with the compressed file if the client
+// supports gzip encoding, and are decompressed otherwise.
+type resultFileServer struct {
+	fsys  fs.FS
+	files http.Handler
+}
+
+func newResultFileServer(fsys fs.FS) resultFileServer {
+	return resultFileServer{fsys: fsys, files: http.FileServer(http.FS(fsys))}
+}
+
+func (h resultFileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if stat, err := fs.Stat(h.fsys, name); name == "" || !errors.Is(err, fs.ErrNotExist) {
+		// Ranges past the end of the file are answered with an empty body, like for
+		// compressed files. The viewer reads the simulator log in chunks until the end.
+		if start, _, ok := parseByteRange(r.Header.Get("Range")); ok && err == nil && !stat.IsDir() && start >= stat.Size() {
+			w.Header().Set("Content-Length", "0")
+			w.WriteHeader(http.StatusPartialContent)
+			return
+		}
+		h.files.ServeHTTP(w, r)
+		return
+	}
+	cf, err := h.fsys.Open(name + compressedExt)
+	if err != nil {
+		h.files.ServeHTTP(w, r)
+		return
+	}
+	defer cf.Close()
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "text/plain; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Vary", "Accept-Encoding")
+	if start, end, ok := parseByteRange(r.Header.Get("Range")); ok {
+		serveCompressedRange(w, cf, start, end)
+		return
+	}
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		w.Header().Set("Content-Encoding", "gzip")
+		io.Copy(w, cf)
+		return
+	}
+	zr, err := gzip.NewReader(cf)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	io.Copy(w, zr)
+}
+
+// serveCompressedRange serves a byte range of the decompressed content of a file.
+// The viewer uses this to load the simulator output of a single test.
+func serveCompressedRange(w http.ResponseWriter, cf io.Reader, start, end int64) {
+	zr, err := gzip.NewReader(cf)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The content is read into memory first because the response header
+	// must contain the actual end of the range.
+	var content []byte
+	_, err = io.CopyN(io.Discard, zr, start)
+	if err == nil {
+		content, err = io.ReadAll(io.LimitReader(zr, end-start+1))
+	}
+	if err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// A range past the end of the content is answered with an empty body, since
+	// the size of the decompressed content isn't known.
+	if len(content) > 0 {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/*", start, start+int64(len(content))-1))
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.WriteHeader(http.StatusPartialContent)
+	w.Write(content)
+}
+
+// parseByteRange parses a Range header containing a single byte range
+// with start and end offset, e.g. "bytes=100-199".
+func parseByteRange(header string) (start, end int64, ok bool) {
+	spec := strings.TrimPrefix(header, "bytes=")
+	if spec == header || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	i := strings.IndexByte(spec, '-')
+	if i < 0 {
+		return 0, 0, false
+	}
+	start, err1 := strconv.ParseInt(strings.TrimSpace(spec[:i]), 10, 64)
+	end, err2 := strconv.ParseInt(strings.TrimSpace(spec[i+1:]), 10, 64)
+	if err1 != nil || err2 != nil || start < 0 || end < start {
+		return 0, 0, false
+	}
+	return start, end, true
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestResultFileServerRange(t *testing.T) {
+	content := "0123456789abcdefghij"
+	fsys := fstest.MapFS{
+		"plain.log":         &fstest.MapFile{Data: []byte(content)},
+		"compressed.log.gz": &fstest.MapFile{Data: gzipData(t, []byte(content))},
+	}
+	server := newResultFileServer(fsys)
+
+	tests := []struct {
+		file         string
+		rangeHeader  string
+		status       int
+		body         string
+		contentRange string
+	}{
+		{"compressed.log", "bytes=0-4", http.StatusPartialContent, "01234", "bytes 0-4/*"},
+		{"compressed.log", "bytes=10-14", http.StatusPartialContent, "abcde", "bytes 10-14/*"},
+		{"compressed.log", "bytes=15-99", http.StatusPartialContent, "fghij", "bytes 15-19/*"},
+		{"compressed.log", "bytes=20-29", http.StatusPartialContent, "", ""},
+		{"compressed.log", "", http.StatusOK, content, ""},
+		{"plain.log", "bytes=10-14", http.StatusPartialContent, "abcde", "bytes 10-14/20"},
+		{"plain.log", "bytes=15-99", http.StatusPartialContent, "fghij", "bytes 15-19/20"},
+		{"plain.log", "bytes=20-29", http.StatusPartialContent, "", ""},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/"+test.file, nil)
+		if test.rangeHeader != "" {
+			req.Header.Set("Range", test.rangeHeader)
+		}
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+
+		if rec.Code != test.status {
+			t.Errorf("%s %q: wrong status %d, want %d", test.file, test.rangeHeader, rec.Code, test.status)
+		}
+		if body := rec.Body.String(); body != test.body {
+			t.Errorf("%s %q: wrong body %q, want %q", test.file, test.rangeHeader, body, test.body)
+		}
+		if cr := rec.Header().Get("Content-Range"); cr != test.contentRange {
+			t.Errorf("%s %q: wrong Content-Range %q, want %q", test.file, test.rangeHeader, cr, test.contentRange)
+		}
+	}
+}
+
+func TestResultFileServerEncoding(t *testing.T) {
+	compressed := gzipData(t, []byte("log content"))
+	fsys := fstest.MapFS{"sim.log.gz": &fstest.MapFile{Data: compressed}}
+	server := newResultFileServer(fsys)
+
+	// Clients supporting gzip get the compressed file.
+	req := httptest.NewRequest("GET", "/sim.log", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if enc := rec.Header().Get("Content-Encoding"); enc != "gzip" {
+		t.Errorf("wrong Content-Encoding %q", enc)
+	}
+	if rec.Body.String() != string(compressed) {
+		t.Errorf("wrong compressed body")
+	}
+
+	// Others get the decompressed content.
+	req = httptest.NewRequest("GET", "/sim.log", nil)
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if enc := rec.Header().Get("Content-Encoding"); enc != "" {
+		t.Errorf("wrong Content-Encoding %q", enc)
+	}
+	if body := rec.Body.String(); body != "log content" {
+		t.Errorf("wrong body %q", body)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/ethereum/hive/internal/libhive"
+)
+
+// These pages need the hiveview server and are not exported.
+var serverOnlyPages = map[string]bool{
+	"live.html":      true,
+	"app-live.js":    true,
+	"compare.html":   true,
+	"app-compare.js": true,
+	"history.html":   true,
+	"app-history.js": true,
+}
+
+type exportConfig struct {
+	logDir     string
+	assetsDir  string
+	outputDir  string
+	maxLogSize int64 // client logs larger than this are trimmed, zero means no limit
+}
+
+// runExport writes the viewer, listing and results of the most recent suites
+// into a directory, which can be served by any static file server.
+func runExport(config exportConfig) error {
+	logDirFS := os.DirFS(config.logDir)
+	if err := os.MkdirAll(filepath.Join(config.outputDir, "results"), 0755); err != nil {
+		return err
+	}
+	if err := exportAssets(openAssets(config.assetsDir), config.outputDir); err != nil {
+		return err
+	}
+
+	// Collect the suites and the files they reference.
+	var (
+		stop       = errors.New("stop")
+		entries    []listingEntry
+		files      = make(map[string]bool)
+		clientLogs = make(map[string]bool)
+	)
+	err := walkSummaryFiles(logDirFS, ".", func(suite *libhive.TestSuite, fi fs.FileInfo) error {
+		entries = append(entries, suiteToEntry(suite, fi))
+		files[fi.Name()] = true
+		files[suite.SimulatorLog] = true
+		if suite.RunManifest != "" {
+			files[suite.RunManifest] = true
+		}
+		for _, test := range suite.TestCases {
+			for _, client := range test.ClientInfo {
+				if client.LogFile != "" {
+					clientLogs[client.LogFile] = true
+				}
+			}
+			for _, file := range test.Artifacts {
+				files[file] = true
+			}
+		}
+		if len(entries) >= listLimit {
+			return stop
+		}
+		return nil
+	})
+	if err != nil && err != stop {
+		return err
+	}
+
+	// Write the listing.
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].SimLog > entries[j].SimLog
+	})
+	var listing bytes.Buffer
+	enc := json.NewEncoder(&listing)
+	for _, e := range entries {
+		enc.Encode(e)
+	}
+	if err := os.WriteFile(filepath.Join(config.outputDir, "listing.jsonl"), listing.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	// Copy result files.
+	resultDir := filepath.Join(config.outputDir, "results")
+	for file := range files {
+		if err := exportFile(logDirFS, file, resultDir, 0); err != nil {
+			log.Printf("Can't export %s: %v", file, err)
+		}
+	}
+	for file := range clientLogs {
+		if err := exportFile(logDirFS, file, resultDir, config.maxLogSize); err != nil {
+			log.Printf("Can't export %s: %v", file, err)
+		}
+	}
+	log.Printf("Exported %d suites (%d files) to %s", len(entries), len(files)+len(clientLogs), config.outputDir)
+	return nil
+}
+
+// exportAssets copies the static files of the viewer.
+func exportAssets(assetFS fs.FS, outputDir string) error {
+	return fs.WalkDir(assetFS, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(outputDir, filepath.FromSlash(name))
+		if d.IsDir() {
+			return os.MkdirAll(dest, 0755)
+		}
+		if serverOnlyPages[path.Base(name)] {
+			return nil
+		}
+		content, err := fs.ReadFile(assetFS, name)
+		if err != nil {
+			return err
+		}
+		if name == "index.html" {
+			content = removeServerOnlyLinks(content)
+		}
+		return os.WriteFile(dest, content, 0644)
+	})
+}
+
+// removeServerOnlyLinks removes lines containing links to pages which are not exported.
+func removeServerOnlyLinks(html []byte) []byte {
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(html))
+	for scanner.Scan() {
+		if !bytes.Contains(scanner.Bytes(), []byte("server-only")) {
+			out.Write(scanner.Bytes())
+			out.WriteByte('\n')
+		}
+	}
+	return out.Bytes()
+}
+
+// exportFile copies a file from the log directory, decompressing it if necessary.
+// If maxSize is non-zero and the file is larger, only its beginning and end are copied.
+func exportFile(logDirFS fs.FS, name, outputDir string, maxSize int64) error {
+	if !fs.ValidPath(name) {
+		return fmt.Errorf("invalid file name")
+	}
+	src, err := openResultFile(logDirFS, name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dest := filepath.Join(outputDir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if maxSize == 0 {
+		_, err = io.Copy(out, src)
+		return err
+	}
+	// Copy the head, and keep the tail in memory while reading the rest.
+	half := maxSize / 2
+	if _, err := io.CopyN(out, src, half); err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	var (
+		tail    []byte
+		skipped int64
+		buf     = make([]byte, 32*1024)
+	)
+	for {
+		n, err := src.Read(buf)
+		tail = append(tail, buf[:n]...)
+		if int64(len(tail)) > 2*half {
+			drop := int64(len(tail)) - half
+			skipped += drop
+			tail = append(tail[:0], tail[drop:]...)
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	if skipped > 0 && int64(len(tail)) > half {
+		skipped += int64(len(tail)) - half
+		tail = tail[int64(len(tail))-half:]
+	}
+	if skipped > 0 {
+		fmt.Fprintf(out, "\n\n[... %d bytes omitted by hiveview -export ...]\n\n", skipped)
+	}
+	_, err = out.Write(tail)
+	return err
+}
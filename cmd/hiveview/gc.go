@@ -10,61 +10,241 @@ import (
 	"github.com/ethereum/hive/internal/libhive"
 )
 
-func logdirGC(dir string, cutoff time.Time, keepMin int) error {
+type gcConfig struct {
+	cutoff   time.Time // suites older than this are deleted
+	keepMin  int       // minimum number of suites to keep
+	maxSize  int64     // total size of kept files, zero means no limit
+	compress time.Time // logs of suites older than this are compressed, zero means never
+	dryRun   bool      // report only, don't change anything
+}
+
+// gcSuite holds the files referenced by a suite, including the suite file itself.
+type gcSuite struct {
+	start     time.Time
+	files     []string
+	logs      []string // files which may be compressed
+	reportDir string   // directory of run reports
+}
+
+func logdirGC(dir string, config gcConfig) error {
 	var (
 		fsys       = os.DirFS(dir)
-		usedFiles  = make(map[string]struct{})
+		suites     []gcSuite
+		usedFiles  = map[string]struct{}{historyFileName: {}}
+		usedDirs   = make(map[string]struct{})
 		keptSuites = 0
+		keptSize   int64
 		oldest     time.Time
 	)
 
-	// Walk all suite files and pouplate the usedFiles set.
+	// Walk all suite files and collect the files they reference.
+	// Note we rely on getting called in descending time order here.
 	err := walkSummaryFiles(fsys, ".", func(suite *libhive.TestSuite, fi fs.FileInfo) error {
-		// Skip when too old and when above the minimum.
-		// Note we rely on getting called in descending time order here.
-		if suiteStart(suite).Before(cutoff) && keptSuites >= keepMin {
-			return nil
+		s := gcSuite{start: suiteStart(suite), files: []string{fi.Name()}}
+		s.logs = append(s.logs, suite.SimulatorLog)
+		if suite.RunManifest != "" {
+			s.files = append(s.files, suite.RunManifest)
+			s.reportDir = libhive.ReportDir(suite.RunManifest)
 		}
-		if oldest.IsZero() || suiteStart(suite).Before(oldest) {
-			oldest = suiteStart(suite)
-		}
-
-		// Add suite files and client logs.
-		keptSuites++
-		usedFiles[fi.Name()] = struct{}{}
-		usedFiles[suite.SimulatorLog] = struct{}{}
 		for _, test := range suite.TestCases {
 			for _, client := range test.ClientInfo {
-				usedFiles[client.LogFile] = struct{}{}
+				if client.LogFile != "" {
+					s.logs = append(s.logs, client.LogFile)
+				}
+			}
+			for _, file := range test.Artifacts {
+				s.files = append(s.files, file)
 			}
 		}
+		suites = append(suites, s)
 		return nil
 	})
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("keeping %d suites (%d files)\n", keptSuites, len(usedFiles))
+	// Find the logs which should be compressed, and estimate how well they compress.
+	// This is needed to check the size limit before anything is compressed.
+	var (
+		compressible = make(map[string]int64) // uncompressed size by file name
+		sample       []string
+		ratio        = 1.0
+	)
+	if !config.compress.IsZero() {
+		for _, s := range suites {
+			if !s.start.Before(config.compress) {
+				continue
+			}
+			for _, name := range s.logs {
+				if _, ok := compressible[name]; ok || !fs.ValidPath(name) {
+					continue
+				}
+				stat, err := fs.Stat(fsys, name)
+				if err != nil || stat.IsDir() {
+					continue // missing, or compressed already
+				}
+				compressible[name] = stat.Size()
+				sample = append(sample, name)
+			}
+		}
+		ratio = estimateCompressionRatio(fsys, sample)
+	}
+
+	// Select the suites to keep.
+	var (
+		toCompress         []string
+		keptFiles          int
+		sizeLimitReached   bool
+		droppedByAge       int
+		droppedBySizeLimit int
+	)
+	for _, s := range suites {
+		// Skip when too old and when above the minimum.
+		if s.start.Before(config.cutoff) && keptSuites >= config.keepMin {
+			droppedByAge++
+			continue
+		}
+		if sizeLimitReached {
+			droppedBySizeLimit++
+			continue
+		}
+
+		// Compute the size of files not referenced by newer suites.
+		// Logs which will be compressed are counted with their estimated compressed size.
+		var (
+			size     int64
+			newFiles []string
+			seen     = make(map[string]bool)
+		)
+		for _, name := range append(s.files, s.logs...) {
+			if _, used := usedFiles[name]; used || seen[name] {
+				continue
+			}
+			seen[name] = true
+			newFiles = append(newFiles, name)
+			if usize, ok := compressible[name]; ok {
+				size += int64(float64(usize) * ratio)
+			} else if fsize, ok := resultFileSize(fsys, name); ok {
+				size += fsize
+			}
+		}
+		if config.maxSize > 0 && keptSuites >= config.keepMin && keptSize+size > config.maxSize {
+			sizeLimitReached = true
+			droppedBySizeLimit++
+			continue
+		}
+
+		// Keep the suite.
+		keptSuites++
+		keptFiles += len(newFiles)
+		keptSize += size
+		if oldest.IsZero() || s.start.Before(oldest) {
+			oldest = s.start
+		}
+		for _, name := range newFiles {
+			usedFiles[name] = struct{}{}
+			usedFiles[name+compressedExt] = struct{}{}
+			if _, ok := compressible[name]; ok {
+				toCompress = append(toCompress, name)
+			}
+		}
+		if s.reportDir != "" {
+			usedDirs[s.reportDir] = struct{}{}
+		}
+	}
+
+	// Compress the logs of kept suites.
+	var (
+		nCompressed       int
+		beforeCompression int64
+		afterCompression  int64
+	)
+	for _, name := range toCompress {
+		estimate := int64(float64(compressible[name]) * ratio)
+		if config.dryRun {
+			nCompressed++
+			beforeCompression += compressible[name]
+			afterCompression += estimate
+			continue
+		}
+		// The kept size was computed with the estimate, correct it.
+		size, err := compressFile(dir, name)
+		if err != nil {
+			fmt.Println("error:", err)
+			keptSize += compressible[name] - estimate
+			continue
+		}
+		nCompressed++
+		beforeCompression += compressible[name]
+		afterCompression += size
+		keptSize += size - estimate
+	}
+
+	verb := func(s string) string {
+		if config.dryRun {
+			return "would " + s
+		}
+		return s
+	}
+	// In dry-run mode, the compressed sizes are estimated.
+	estimated := func(size int64) string {
+		if config.dryRun && nCompressed > 0 {
+			return "about " + formatSize(size)
+		}
+		return formatSize(size)
+	}
+	fmt.Printf("keeping %d suites (%d files, %s)\n", keptSuites, keptFiles, estimated(keptSize))
 	fmt.Println("oldest suite date:", oldest)
+	fmt.Printf("%s %d suites (%d by age, %d by size limit)\n", verb("delete"), droppedByAge+droppedBySizeLimit, droppedByAge, droppedBySizeLimit)
+	if nCompressed > 0 {
+		fmt.Printf("%s %d logs (%s -> %s)\n", verb("compress"), nCompressed, formatSize(beforeCompression), estimated(afterCompression))
+	}
 
 	// Delete all files which aren't in usedFiles.
-	return fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+	var (
+		deletedFiles int
+		deletedSize  int64
+	)
+	err = fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return nil // Ignore scan errors.
 		}
 		if d.IsDir() {
 			return nil // Don't delete directories.
 		}
-		if _, used := usedFiles[path]; !used {
-			file := filepath.Join(dir, filepath.FromSlash(path))
-			// fmt.Println("rm", file)
-			err := os.Remove(file)
-			if err != nil {
-				fmt.Println("error:", err)
-			}
+		if _, used := usedFiles[path]; used {
+			return nil
+		}
+		if _, used := usedDirs[filepath.ToSlash(filepath.Dir(path))]; used {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			deletedSize += info.Size()
+		}
+		deletedFiles++
+		if config.dryRun {
+			fmt.Println("would delete", path)
+			return nil
+		}
+		file := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.Remove(file); err != nil {
+			fmt.Println("error:", err)
 		}
 		return nil
 	})
+	fmt.Printf("%s %d files (%s)\n", verb("delete"), deletedFiles, formatSize(deletedSize))
+	return err
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.2f GB", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.2f MB", float64(size)/(1<<20))
+	default:
+		return fmt.Sprintf("%.2f KB", float64(size)/(1<<10))
+	}
 }
 
 func suiteStart(suite *libhive.TestSuite) time.Time {
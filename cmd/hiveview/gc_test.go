@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// gcTestDir is a log directory for GC tests.
+type gcTestDir struct {
+	t   *testing.T
+	dir string
+}
+
+func newGCTestDir(t *testing.T) *gcTestDir {
+	return &gcTestDir{t: t, dir: t.TempDir()}
+}
+
+func (d *gcTestDir) write(name string, data []byte) {
+	d.t.Helper()
+	file := filepath.Join(d.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		d.t.Fatal(err)
+	}
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		d.t.Fatal(err)
+	}
+}
+
+// addSuite writes suite file n, which starts n hours after testTime. The simulator log
+// and client log of the suite are written with the given content, unless it is nil.
+func (d *gcTestDir) addSuite(n int, simLog, clientLog []byte) {
+	d.t.Helper()
+	test := makeTest("test", true, time.Second, "geth")
+	test.Start = testTime.Add(time.Duration(n) * time.Hour)
+	test.ClientInfo["a"].LogFile = fmt.Sprintf("geth/client-%d.log", n)
+	suite := makeSuite("suite", fmt.Sprintf("%d-simulator.log", n), test)
+	data, err := json.Marshal(suite)
+	if err != nil {
+		d.t.Fatal(err)
+	}
+	d.write(fmt.Sprintf("%d-suite.json", n), data)
+	if simLog != nil {
+		d.write(suite.SimulatorLog, simLog)
+	}
+	if clientLog != nil {
+		d.write(test.ClientInfo["a"].LogFile, clientLog)
+	}
+}
+
+// files returns the content of all files in the directory.
+func (d *gcTestDir) files() map[string]string {
+	d.t.Helper()
+	files := make(map[string]string)
+	err := fs.WalkDir(os.DirFS(d.dir), ".", func(path string, e fs.DirEntry, err error) error {
+		if err != nil || e.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(filepath.Join(d.dir, filepath.FromSlash(path)))
+		files[path] = string(data)
+		return err
+	})
+	if err != nil {
+		d.t.Fatal(err)
+	}
+	return files
+}
+
+func (d *gcTestDir) names() []string {
+	names := []string{}
+	for name := range d.files() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func randomData(seed int64, size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func gzipData(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGCSizeLimit(t *testing.T) {
+	const logSize = 10000
+
+	tests := []struct {
+		name   string
+		config gcConfig
+		kept   []int
+	}{
+		{
+			name:   "size limit",
+			config: gcConfig{maxSize: 4*logSize + 2000},
+			kept:   []int{4, 5},
+		},
+		{
+			name:   "keep-min above size limit",
+			config: gcConfig{maxSize: 4*logSize + 2000, keepMin: 3},
+			kept:   []int{3, 4, 5},
+		},
+		{
+			name:   "size limit above keep-min",
+			config: gcConfig{maxSize: 6*logSize + 3000, keepMin: 1},
+			kept:   []int{3, 4, 5},
+		},
+		{
+			name:   "keep-min with age limit",
+			config: gcConfig{cutoff: testTime.Add(10 * time.Hour), keepMin: 2},
+			kept:   []int{4, 5},
+		},
+		{
+			name:   "age limit before size limit",
+			config: gcConfig{cutoff: testTime.Add(5 * time.Hour), maxSize: 4*logSize + 2000},
+			kept:   []int{5},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := newGCTestDir(t)
+			for n := 1; n <= 5; n++ {
+				d.addSuite(n, randomData(int64(2*n), logSize), randomData(int64(2*n+1), logSize))
+			}
+			d.write(historyFileName, []byte("{}\n"))
+			if err := logdirGC(d.dir, test.config); err != nil {
+				t.Fatal(err)
+			}
+
+			want := []string{historyFileName}
+			for _, n := range test.kept {
+				want = append(want,
+					fmt.Sprintf("%d-simulator.log", n),
+					fmt.Sprintf("%d-suite.json", n),
+					fmt.Sprintf("geth/client-%d.log", n),
+				)
+			}
+			sort.Strings(want)
+			if names := d.names(); !reflect.DeepEqual(names, want) {
+				t.Fatalf("wrong files after GC:\n%q\nwant:\n%q", names, want)
+			}
+		})
+	}
+}
+
+func TestGCCompress(t *testing.T) {
+	d := newGCTestDir(t)
+	logs := make(map[int][]byte)
+	for n := 1; n <= 4; n++ {
+		logs[n] = []byte(strings.Repeat(fmt.Sprintf("log line of suite %d\n", n), 1000))
+	}
+	// Suite 1 is dropped. Its logs were compressed by an earlier run.
+	d.addSuite(1, nil, nil)
+	d.write("1-simulator.log.gz", gzipData(t, logs[1]))
+	d.write("geth/client-1.log.gz", gzipData(t, logs[1]))
+	// Suites 2 and 3 are compressed. The client log of suite 2 is compressed already.
+	d.addSuite(2, logs[2], nil)
+	d.write("geth/client-2.log.gz", gzipData(t, logs[2]))
+	d.addSuite(3, logs[3], logs[3])
+	// Suite 4 is too new to be compressed.
+	d.addSuite(4, logs[4], logs[4])
+
+	config := gcConfig{
+		cutoff:   testTime.Add(2 * time.Hour),
+		compress: testTime.Add(4 * time.Hour),
+	}
+	if err := logdirGC(d.dir, config); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"2-simulator.log.gz",
+		"2-suite.json",
+		"3-simulator.log.gz",
+		"3-suite.json",
+		"4-simulator.log",
+		"4-suite.json",
+		"geth/client-2.log.gz",
+		"geth/client-3.log.gz",
+		"geth/client-4.log",
+	}
+	if names := d.names(); !reflect.DeepEqual(names, want) {
+		t.Fatalf("wrong files after GC:\n%q\nwant:\n%q", names, want)
+	}
+
+	// The compressed logs can be read with their original name.
+	fsys := os.DirFS(d.dir)
+	for name, content := range map[string][]byte{
+		"2-simulator.log":   logs[2],
+		"3-simulator.log":   logs[3],
+		"geth/client-2.log": logs[2],
+		"geth/client-3.log": logs[3],
+		"geth/client-4.log": logs[4],
+	} {
+		f, err := openResultFile(fsys, name)
+		if err != nil {
+			t.Fatalf("can't open %s: %v", name, err)
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("can't read %s: %v", name, err)
+		}
+		if !bytes.Equal(data, content) {
+			t.Errorf("wrong content of %s", name)
+		}
+	}
+}
+
+func TestGCDryRun(t *testing.T) {
+	d := newGCTestDir(t)
+	for n := 1; n <= 5; n++ {
+		log := []byte(strings.Repeat(fmt.Sprintf("log line of suite %d\n", n), 1000))
+		d.addSuite(n, log, log)
+	}
+	d.write("geth/client-2.log.gz", gzipData(t, []byte("old log")))
+	d.write("unused.log", []byte("unused"))
+	d.write(historyFileName, []byte("{}\n"))
+
+	type fileState struct {
+		content string
+		modTime time.Time
+	}
+	state := func() map[string]fileState {
+		s := make(map[string]fileState)
+		for name, content := range d.files() {
+			stat, err := os.Stat(filepath.Join(d.dir, filepath.FromSlash(name)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			s[name] = fileState{content, stat.ModTime()}
+		}
+		return s
+	}
+	before := state()
+
+	config := gcConfig{
+		cutoff:   testTime.Add(2 * time.Hour),
+		maxSize:  60000,
+		compress: testTime.Add(5 * time.Hour),
+		dryRun:   true,
+	}
+	if err := logdirGC(d.dir, config); err != nil {
+		t.Fatal(err)
+	}
+	if after := state(); !reflect.DeepEqual(after, before) {
+		t.Fatal("dry run modified the log directory")
+	}
+}
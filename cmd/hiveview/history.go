@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// historyFileName is the default name of the history database in the log directory.
+const historyFileName = ".hiveview-history.jsonl"
+
+// historyDB tracks the results of every test for each client over time. It is
+// updated from the result index. Unlike the index, the history keeps results of
+// suite files which have been deleted.
+//
+// The database is stored as a log of JSON entries, one line per suite file. New
+// suites are appended to the file, so updates don't rewrite the existing history.
+type historyDB struct {
+	path string
+
+	mu      sync.Mutex
+	files   map[string]bool // suite files added to the history
+	tests   []*testHistory
+	index   map[historyKey]*testHistory
+	pending []*historyEntry // entries not written yet
+}
+
+// historyEntry is a line of the history file.
+type historyEntry struct {
+	File    string          `json:"file"`
+	Suite   string          `json:"suite"`
+	Results []historyRecord `json:"results"`
+}
+
+type historyRecord struct {
+	Test    string    `json:"test"`
+	Client  string    `json:"client"`
+	Time    time.Time `json:"time"`
+	Version string    `json:"version"`
+	Pass    bool      `json:"pass"`
+	ID      string    `json:"id"`
+}
+
+// testHistory contains the results of a test for one client.
+type testHistory struct {
+	Suite   string
+	Test    string
+	Client  string
+	Results []historyResult // sorted by time
+}
+
+type historyResult struct {
+	Time    time.Time `json:"time"`
+	Version string    `json:"version"` // client version
+	Pass    bool      `json:"pass"`
+	File    string    `json:"file"` // suite file
+	ID      string    `json:"id"`   // test ID within the suite
+}
+
+type historyKey struct {
+	suite, test, client string
+}
+
+// openHistory loads the history database from the given file. A new database
+// is created if the file does not exist.
+func openHistory(path string) (*historyDB, error) {
+	db := &historyDB{
+		path:  path,
+		files: make(map[string]bool),
+		index: make(map[historyKey]*testHistory),
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return db, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		r      = bufio.NewReader(f)
+		offset int64 // start of the current line
+	)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if len(line) == 0 {
+			break
+		}
+		complete := err == nil
+		var e historyEntry
+		decErr := json.Unmarshal(line, &e)
+		switch {
+		case decErr == nil:
+			db.apply(&e)
+			if !complete {
+				// The line break after the last entry is missing. Add it, so new
+				// entries are appended on a new line.
+				if err := appendHistory(path, []byte{'\n'}); err != nil {
+					return nil, fmt.Errorf("can't repair history file %s: %v", path, err)
+				}
+			}
+		case !complete:
+			// The last line is incomplete if hiveview was killed while writing it.
+			// Drop it, so new entries are appended after the valid part.
+			log.Printf("Dropping incomplete history entry at offset %d in %s: %v", offset, path, decErr)
+			if err := os.Truncate(path, offset); err != nil {
+				return nil, fmt.Errorf("can't repair history file %s: %v", path, err)
+			}
+		case len(bytes.TrimSpace(line)) > 0:
+			log.Printf("Skipping invalid history entry at offset %d in %s: %v", offset, path, decErr)
+		}
+		offset += int64(len(line))
+		if !complete {
+			break
+		}
+	}
+	return db, nil
+}
+
+// appendHistory appends data to the history file.
+func appendHistory(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		// Remove the partial write.
+		f.Truncate(stat.Size())
+		return err
+	}
+	return nil
+}
+
+// add records the test results of a suite. Suites which are already in the
+// history are ignored. This can be called on a nil database.
+func (db *historyDB) add(s *indexSuite) {
+	if db == nil {
+		return
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.files[s.FileName] {
+		return
+	}
+	e := &historyEntry{File: s.FileName, Suite: s.Name, Results: []historyRecord{}}
+	for _, test := range s.tests {
+		for _, client := range test.Clients {
+			e.Results = append(e.Results, historyRecord{
+				Test:    test.Name,
+				Client:  client,
+				Time:    test.Start,
+				Version: s.ClientVersions[client],
+				Pass:    test.Pass,
+				ID:      test.ID,
+			})
+		}
+	}
+	db.apply(e)
+	db.pending = append(db.pending, e)
+}
+
+// apply adds a history entry to the in-memory index. Entries of suite files which are
+// already in the history are ignored. The file can contain such duplicates when more
+// than one hiveview process appends to it.
+func (db *historyDB) apply(e *historyEntry) {
+	if db.files[e.File] {
+		return
+	}
+	db.files[e.File] = true
+	for _, r := range e.Results {
+		key := historyKey{e.Suite, r.Test, r.Client}
+		h := db.index[key]
+		if h == nil {
+			h = &testHistory{Suite: e.Suite, Test: r.Test, Client: r.Client}
+			db.index[key] = h
+			db.tests = append(db.tests, h)
+		}
+		h.insert(historyResult{Time: r.Time, Version: r.Version, Pass: r.Pass, File: e.File, ID: r.ID})
+	}
+}
+
+func (h *testHistory) insert(r historyResult) {
+	i := sort.Search(len(h.Results), func(i int) bool {
+		return h.Results[i].Time.After(r.Time)
+	})
+	h.Results = append(h.Results, historyResult{})
+	copy(h.Results[i+1:], h.Results[i:])
+	h.Results[i] = r
+}
+
+// save appends new entries to the database file.
+func (db *historyDB) save() {
+	if db == nil {
+		return
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if len(db.pending) == 0 {
+		return
+	}
+	var buf bytes.Buffer
+	for _, e := range db.pending {
+		line, err := json.Marshal(e)
+		if err != nil {
+			log.Printf("Can't encode history entry of %s: %v", e.File, err)
+			continue
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if err := appendHistory(db.path, buf.Bytes()); err != nil {
+		// The entries are retried on the next save.
+		log.Printf("Can't write history: %v", err)
+		return
+	}
+	db.pending = nil
+}
+
+// historyFilter selects tests in the history.
+type historyFilter struct {
+	client string
+	suite  string
+	test   *regexp.Regexp
+}
+
+func (f historyFilter) match(h *testHistory) bool {
+	if f.client != "" && h.Client != f.client {
+		return false
+	}
+	if f.suite != "" && h.Suite != f.suite {
+		return false
+	}
+	if f.test != nil && !f.test.MatchString(h.Test) {
+		return false
+	}
+	return true
+}
+
+// testResults returns the history of a single test.
+func (db *historyDB) testResults(suite, test, client string) []historyResult {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	h := db.index[historyKey{suite, test, client}]
+	if h == nil {
+		return []historyResult{}
+	}
+	return append([]historyResult{}, h.Results...)
+}
+
+// trendPoint is the pass rate of a client in one suite file.
+type trendPoint struct {
+	Time     time.Time `json:"time"`
+	Suite    string    `json:"suite"`
+	File     string    `json:"file"`
+	Client   string    `json:"client"`
+	Version  string    `json:"version"`
+	Tests    int       `json:"tests"`
+	Passes   int       `json:"passes"`
+	PassRate float64   `json:"passRate"`
+}
+
+// trend computes the pass rate of the selected tests for each suite file and
+// client, sorted by time.
+func (db *historyDB) trend(f historyFilter) []*trendPoint {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	type key struct{ file, client string }
+	points := make(map[key]*trendPoint)
+	for _, h := range db.tests {
+		if !f.match(h) {
+			continue
+		}
+		for _, r := range h.Results {
+			k := key{r.File, h.Client}
+			p := points[k]
+			if p == nil {
+				p = &trendPoint{Time: r.Time, Suite: h.Suite, File: r.File, Client: h.Client, Version: r.Version}
+				points[k] = p
+			}
+			if r.Time.Before(p.Time) {
+				p.Time = r.Time
+			}
+			p.Tests++
+			if r.Pass {
+				p.Passes++
+			}
+		}
+	}
+
+	result := make([]*trendPoint, 0, len(points))
+	for _, p := range points {
+		p.PassRate = float64(p.Passes) / float64(p.Tests)
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].Time.Equal(result[j].Time) {
+			return result[i].Time.Before(result[j].Time)
+		}
+		return result[i].Client < result[j].Client
+	})
+	return result
+}
+
+// failingTest is a test which failed in its most recent run.
+type failingTest struct {
+	Suite       string         `json:"suite"`
+	Test        string         `json:"test"`
+	Client      string         `json:"client"`
+	Failures    int            `json:"failures"`    // number of failures since the last pass
+	FirstFailed historyResult  `json:"firstFailed"` // first failure since the last pass
+	LastPassed  *historyResult `json:"lastPassed"`  // nil if the test never passed
+}
+
+// failing returns the selected tests which are currently failing, along with the
+// run where they started failing. The most recent regressions come first.
+func (db *historyDB) failing(f historyFilter) []*failingTest {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	result := []*failingTest{}
+	for _, h := range db.tests {
+		n := len(h.Results)
+		if !f.match(h) || n == 0 || h.Results[n-1].Pass {
+			continue
+		}
+		i := n - 1
+		for i > 0 && !h.Results[i-1].Pass {
+			i--
+		}
+		ft := &failingTest{
+			Suite:       h.Suite,
+			Test:        h.Test,
+			Client:      h.Client,
+			Failures:    n - i,
+			FirstFailed: h.Results[i],
+		}
+		if i > 0 {
+			lastPassed := h.Results[i-1]
+			ft.LastPassed = &lastPassed
+		}
+		result = append(result, ft)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if !a.FirstFailed.Time.Equal(b.FirstFailed.Time) {
+			return a.FirstFailed.Time.After(b.FirstFailed.Time)
+		}
+		if a.Suite != b.Suite {
+			return a.Suite < b.Suite
+		}
+		if a.Test != b.Test {
+			return a.Test < b.Test
+		}
+		return a.Client < b.Client
+	})
+	return result
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// historyLine encodes a history entry of a suite file with a single result
+// of test "t" with client "geth".
+func historyLine(t *testing.T, file string, n int, pass bool) string {
+	t.Helper()
+	e := historyEntry{
+		File:  file,
+		Suite: "suite",
+		Results: []historyRecord{{
+			Test:    "t",
+			Client:  "geth",
+			Time:    testTime.Add(time.Duration(n) * time.Hour),
+			Version: "1.0",
+			Pass:    pass,
+			ID:      "1",
+		}},
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data) + "\n"
+}
+
+// writeHistory creates a history file with the given content.
+func writeHistory(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), historyFileName)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func historyFiles(db *historyDB) []string {
+	files := []string{}
+	for _, r := range db.testResults("suite", "t", "geth") {
+		files = append(files, r.File)
+	}
+	return files
+}
+
+func TestHistoryLoad(t *testing.T) {
+	path := writeHistory(t, historyLine(t, "2.json", 2, false)+historyLine(t, "1.json", 1, true))
+	db, err := openHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := historyFiles(db); !reflect.DeepEqual(files, []string{"1.json", "2.json"}) {
+		t.Fatalf("wrong results %q", files)
+	}
+	if !db.files["1.json"] || !db.files["2.json"] {
+		t.Fatalf("suite files not recorded: %v", db.files)
+	}
+
+	// New suites are appended and loaded again.
+	db.add(&indexSuite{
+		listingEntry:   listingEntry{Name: "suite", FileName: "3.json"},
+		ClientVersions: map[string]string{"geth": "1.1"},
+		tests:          []indexTest{{ID: "1", Name: "t", Pass: true, Clients: []string{"geth"}, Start: testTime.Add(3 * time.Hour)}},
+	})
+	db.save()
+	db, err = openHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := historyFiles(db); !reflect.DeepEqual(files, []string{"1.json", "2.json", "3.json"}) {
+		t.Fatalf("wrong results after save %q", files)
+	}
+}
+
+func TestHistoryMissingFile(t *testing.T) {
+	db, err := openHistory(filepath.Join(t.TempDir(), historyFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db.tests) != 0 {
+		t.Fatalf("new history has %d tests", len(db.tests))
+	}
+}
+
+func TestHistoryRepair(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		files   []string
+		repair  string // file content after opening
+	}{
+		{
+			name:    "invalid entry",
+			content: historyLine(t, "1.json", 1, true) + "{invalid\n\n" + historyLine(t, "2.json", 2, true),
+			files:   []string{"1.json", "2.json"},
+			repair:  historyLine(t, "1.json", 1, true) + "{invalid\n\n" + historyLine(t, "2.json", 2, true),
+		},
+		{
+			name:    "incomplete last entry",
+			content: historyLine(t, "1.json", 1, true) + historyLine(t, "2.json", 2, true)[:20],
+			files:   []string{"1.json"},
+			repair:  historyLine(t, "1.json", 1, true),
+		},
+		{
+			name:    "missing line break",
+			content: strings.TrimSuffix(historyLine(t, "1.json", 1, true), "\n"),
+			files:   []string{"1.json"},
+			repair:  historyLine(t, "1.json", 1, true),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeHistory(t, test.content)
+			db, err := openHistory(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if files := historyFiles(db); !reflect.DeepEqual(files, test.files) {
+				t.Fatalf("wrong results %q, want %q", files, test.files)
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != test.repair {
+				t.Fatalf("wrong file content after repair:\n%s\nwant:\n%s", content, test.repair)
+			}
+
+			// Entries added after the repair are loaded.
+			db.add(&indexSuite{
+				listingEntry: listingEntry{Name: "suite", FileName: "3.json"},
+				tests:        []indexTest{{ID: "1", Name: "t", Clients: []string{"geth"}, Start: testTime.Add(3 * time.Hour)}},
+			})
+			db.save()
+			db, err = openHistory(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := append(test.files, "3.json")
+			if files := historyFiles(db); !reflect.DeepEqual(files, want) {
+				t.Fatalf("wrong results after save %q, want %q", files, want)
+			}
+		})
+	}
+}
+
+func TestHistoryDuplicates(t *testing.T) {
+	path := writeHistory(t, historyLine(t, "1.json", 1, true)+
+		historyLine(t, "2.json", 2, false)+
+		historyLine(t, "2.json", 2, false))
+	db, err := openHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := historyFiles(db); !reflect.DeepEqual(files, []string{"1.json", "2.json"}) {
+		t.Fatalf("wrong results %q", files)
+	}
+
+	trend := db.trend(historyFilter{client: "geth"})
+	if len(trend) != 2 {
+		t.Fatalf("wrong number of trend points %d", len(trend))
+	}
+	for _, p := range trend {
+		if p.Tests != 1 {
+			t.Errorf("trend point %s has %d tests, want 1", p.File, p.Tests)
+		}
+	}
+
+	failing := db.failing(historyFilter{client: "geth"})
+	if len(failing) != 1 {
+		t.Fatalf("wrong number of failing tests %d", len(failing))
+	}
+	if f := failing[0]; f.Failures != 1 || f.LastPassed == nil || f.LastPassed.File != "1.json" {
+		t.Fatalf("wrong failing test %+v", f)
+	}
+
+	// Adding a suite which is in the history already doesn't write a new entry.
+	db.add(&indexSuite{listingEntry: listingEntry{Name: "suite", FileName: "2.json"}})
+	if len(db.pending) != 0 {
+		t.Fatalf("duplicate suite added to pending entries")
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"io/fs"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/hive/internal/libhive"
+)
+
+// indexRefreshInterval is the minimum time between scans of the log directory.
+const indexRefreshInterval = 5 * time.Second
+
+// resultIndex caches summaries of the suite files in the log directory. It is
+// refreshed incrementally: only files which are new or changed get parsed.
+// New suites are also added to the history database, if there is one.
+type resultIndex struct {
+	fsys    fs.FS
+	history *historyDB
+
+	mu          sync.Mutex
+	suites      map[string]*indexSuite // by file name
+	sorted      []*indexSuite          // newest first
+	lastRefresh time.Time
+}
+
+// indexSuite is the summary of a suite file.
+type indexSuite struct {
+	listingEntry
+	ClientVersions map[string]string `json:"clientVersions"`
+
+	modTime time.Time
+	tests   []indexTest
+}
+
+// indexTest is the summary of a test case.
+type indexTest struct {
+	Suite     string    `json:"suite"`     // suite name
+	SuiteFile string    `json:"suiteFile"` // suite file name
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Pass      bool      `json:"pass"`
+	Clients   []string  `json:"clients"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+}
+
+func newResultIndex(fsys fs.FS, history *historyDB) *resultIndex {
+	return &resultIndex{fsys: fsys, history: history, suites: make(map[string]*indexSuite)}
+}
+
+// list returns all indexed suites, newest first. The index is refreshed if
+// it is older than indexRefreshInterval.
+func (idx *resultIndex) list() []*indexSuite {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if time.Since(idx.lastRefresh) >= indexRefreshInterval {
+		if err := idx.refresh(); err != nil {
+			log.Printf("Can't refresh result index: %v", err)
+		}
+	}
+	return idx.sorted
+}
+
+// refresh scans the log directory for changes.
+func (idx *resultIndex) refresh() error {
+	files, err := fs.ReadDir(idx.fsys, ".")
+	if err != nil {
+		return err
+	}
+	idx.lastRefresh = time.Now()
+
+	var (
+		present = make(map[string]bool)
+		changed bool
+	)
+	for _, entry := range files {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") || skipFile(name) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		present[name] = true
+		if s := idx.suites[name]; s != nil && s.Size == info.Size() && s.modTime.Equal(info.ModTime()) {
+			continue
+		}
+		changed = true
+		suite, fileInfo := parseSuite(idx.fsys, name)
+		if suite == nil {
+			delete(idx.suites, name)
+			continue
+		}
+		idx.suites[name] = newIndexSuite(suite, fileInfo)
+		idx.history.add(idx.suites[name])
+	}
+	idx.history.save()
+	for name := range idx.suites {
+		if !present[name] {
+			delete(idx.suites, name)
+			changed = true
+		}
+	}
+
+	if changed || idx.sorted == nil {
+		idx.sorted = make([]*indexSuite, 0, len(idx.suites))
+		for _, s := range idx.suites {
+			idx.sorted = append(idx.sorted, s)
+		}
+		sort.Slice(idx.sorted, func(i, j int) bool {
+			a, b := idx.sorted[i], idx.sorted[j]
+			if !a.Start.Equal(b.Start) {
+				return a.Start.After(b.Start)
+			}
+			return a.FileName > b.FileName
+		})
+	}
+	return nil
+}
+
+func newIndexSuite(suite *libhive.TestSuite, file fs.FileInfo) *indexSuite {
+	s := &indexSuite{
+		listingEntry:   suiteToEntry(suite, file),
+		ClientVersions: suite.ClientVersions,
+		modTime:        file.ModTime(),
+	}
+	ids := make([]libhive.TestID, 0, len(suite.TestCases))
+	for id := range suite.TestCases {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		test := suite.TestCases[id]
+		s.tests = append(s.tests, indexTest{
+			Suite:     suite.Name,
+			SuiteFile: s.FileName,
+			ID:        id.String(),
+			Name:      test.Name,
+			Pass:      test.SummaryResult.Pass,
+			Clients:   testClients(test),
+			Start:     test.Start,
+			End:       test.End,
+		})
+	}
+	return s
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/ethereum/hive/internal/libhive"
+)
+
+// suiteAt creates a suite with tests starting at the given offset to testTime.
+func suiteAt(name string, start time.Duration, tests ...string) *libhive.TestSuite {
+	suite := makeSuite(name, "sim.log")
+	for i, test := range tests {
+		tc := makeTest(test, true, time.Second)
+		tc.Start = testTime.Add(start)
+		suite.TestCases[libhive.TestID(i+1)] = tc
+	}
+	return suite
+}
+
+func indexFiles(idx *resultIndex) []string {
+	names := []string{}
+	for _, s := range idx.sorted {
+		names = append(names, s.FileName)
+	}
+	return names
+}
+
+func TestResultIndexRefresh(t *testing.T) {
+	fsys := fstest.MapFS{
+		"1.json":            suiteFile(t, suiteAt("s1", 0, "t1")),
+		"2.json":            suiteFile(t, suiteAt("s2", time.Hour, "t2")),
+		"3.json":            suiteFile(t, suiteAt("s3", time.Hour, "t3")),
+		"errorReport.json":  suiteFile(t, suiteAt("s4", 0, "t4")),
+		".hidden.json":      suiteFile(t, suiteAt("s5", 0, "t5")),
+		"dir/4.json":        suiteFile(t, suiteAt("s6", 0, "t6")),
+		"1-simulator-a.log": &fstest.MapFile{Data: []byte("log")},
+	}
+	idx := newResultIndex(fsys, nil)
+	refresh := func() {
+		t.Helper()
+		if err := idx.refresh(); err != nil {
+			t.Fatal("refresh failed:", err)
+		}
+	}
+
+	// Suites are sorted by start time, newest first.
+	refresh()
+	if files := indexFiles(idx); !reflect.DeepEqual(files, []string{"3.json", "2.json", "1.json"}) {
+		t.Fatalf("wrong suites %q", files)
+	}
+
+	// Unchanged files are not parsed again. This is checked by replacing
+	// the content, while keeping size and modification time.
+	fsys["1.json"].Data = bytes.Repeat([]byte("x"), len(fsys["1.json"].Data))
+	refresh()
+	if files := indexFiles(idx); !reflect.DeepEqual(files, []string{"3.json", "2.json", "1.json"}) {
+		t.Fatalf("wrong suites after refresh without changes %q", files)
+	}
+
+	// Changed files are parsed again.
+	fsys["2.json"] = suiteFile(t, suiteAt("s2", -time.Hour, "t2", "t2b"))
+	fsys["2.json"].ModTime = testTime.Add(time.Minute)
+	refresh()
+	if files := indexFiles(idx); !reflect.DeepEqual(files, []string{"3.json", "1.json", "2.json"}) {
+		t.Fatalf("wrong suites after change %q", files)
+	}
+	if n := len(idx.suites["2.json"].tests); n != 2 {
+		t.Fatalf("changed suite has %d tests, want 2", n)
+	}
+
+	// Deleted files and files which became invalid are removed,
+	// and new files are added.
+	delete(fsys, "3.json")
+	fsys["1.json"].ModTime = testTime.Add(time.Minute)
+	fsys["5.json"] = suiteFile(t, suiteAt("s5", 0, "t5"))
+	refresh()
+	if files := indexFiles(idx); !reflect.DeepEqual(files, []string{"5.json", "2.json"}) {
+		t.Fatalf("wrong suites after removal %q", files)
+	}
+}
+
+func TestNewIndexSuite(t *testing.T) {
+	suite := makeSuite("suite", "sim.log",
+		makeTest("a", true, time.Second, "geth", "besu"),
+		makeTest("b", false, time.Second, "geth"),
+	)
+	fsys := fstest.MapFS{"1.json": suiteFile(t, suite)}
+	s, fi := parseSuite(fsys, "1.json")
+	is := newIndexSuite(s, fi)
+
+	if is.NTests != 2 || is.Passes != 1 || is.Fails != 1 {
+		t.Errorf("wrong counts: %d tests, %d passes, %d fails", is.NTests, is.Passes, is.Fails)
+	}
+	want := []indexTest{
+		{Suite: "suite", SuiteFile: "1.json", ID: "1", Name: "a", Pass: true, Clients: []string{"besu", "geth"}},
+		{Suite: "suite", SuiteFile: "1.json", ID: "2", Name: "b", Pass: false, Clients: []string{"geth"}},
+	}
+	for i := range is.tests {
+		is.tests[i].Start, is.tests[i].End = time.Time{}, time.Time{}
+	}
+	if !reflect.DeepEqual(is.tests, want) {
+		t.Errorf("wrong tests %+v", is.tests)
+	}
+}
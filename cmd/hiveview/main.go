@@ -19,13 +19,22 @@ func main() {
 		serve          = flag.Bool("serve", false, "Enables the HTTP server")
 		listing        = flag.Bool("listing", false, "Generates listing JSON to stdout")
 		gc             = flag.Bool("gc", false, "Deletes old log files")
+		compare        = flag.Bool("compare", false, "Compares the results of two runs given as arguments")
+		export         = flag.String("export", "", "Writes a static copy of the viewer and results to the given directory")
+		exportMaxLog   = flag.Int64("export-maxlog", 0, "Trims exported client logs to this size in KB (0 = no limit)")
 		gcKeepInterval = flag.Duration("keep", 5*durationMonth, "Time interval of past log files to keep (for -gc)")
 		gcKeepMin      = flag.Int("keep-min", 10, "Minmum number of suite outputs to keep (for -gc)")
+		gcKeepSize     = flag.Int64("keep-size", 0, "Maximum total size of kept log files in MB, 0 = no limit (for -gc)")
+		gcCompress     = flag.Duration("compress-after", 0, "Compresses logs of suites older than this, 0 = never (for -gc)")
+		gcDryRun       = flag.Bool("dry-run", false, "Reports what would be deleted and compressed without doing it (for -gc)")
 		config         serverConfig
 	)
 	flag.StringVar(&config.listenAddr, "addr", "0.0.0.0:8080", "HTTP server listen address")
 	flag.StringVar(&config.logDir, "logdir", "workspace/logs", "Path to hive simulator log directory")
 	flag.StringVar(&config.assetsDir, "assets", "", "Path to static files directory. Serves baked-in assets when not set.")
+	flag.StringVar(&config.liveURL, "live", "", "Event stream URL of a running hive instance, shown on the live page (e.g. http://127.0.0.1:8089/events)")
+	flag.StringVar(&config.historyFile, "history", "", "Path of the result history database (default <logdir>/"+historyFileName+")")
+	flag.BoolVar(&config.noHistory, "no-history", false, "Disables the result history")
 	flag.Parse()
 
 	log.SetFlags(log.LstdFlags)
@@ -36,9 +45,37 @@ func main() {
 		fsys := os.DirFS(config.logDir)
 		generateListing(fsys, ".", os.Stdout)
 	case *gc:
-		cutoff := time.Now().Add(-*gcKeepInterval)
-		logdirGC(config.logDir, cutoff, *gcKeepMin)
+		now := time.Now()
+		gcConfig := gcConfig{
+			cutoff:  now.Add(-*gcKeepInterval),
+			keepMin: *gcKeepMin,
+			maxSize: *gcKeepSize * 1024 * 1024,
+			dryRun:  *gcDryRun,
+		}
+		if *gcCompress > 0 {
+			gcConfig.compress = now.Add(-*gcCompress)
+		}
+		if err := logdirGC(config.logDir, gcConfig); err != nil {
+			log.Fatal(err)
+		}
+	case *compare:
+		if flag.NArg() != 2 {
+			log.Fatalf("Usage: hiveview -compare <runA> <runB>")
+		}
+		if err := runCompare(flag.Arg(0), flag.Arg(1)); err != nil {
+			log.Fatal(err)
+		}
+	case *export != "":
+		err := runExport(exportConfig{
+			logDir:     config.logDir,
+			assetsDir:  config.assetsDir,
+			outputDir:  *export,
+			maxLogSize: *exportMaxLog * 1024,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
 	default:
-		log.Fatalf("Use -serve or -listing to select mode")
+		log.Fatalf("Use -serve, -listing, -compare or -export to select mode")
 	}
 }
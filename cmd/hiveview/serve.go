@@ -6,7 +6,10 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"net/http/httputil"
+	"net/url"
 	"os"
+	"path/filepath"
 
 	"github.com/gorilla/mux"
 )
@@ -18,29 +21,58 @@ type serverConfig struct {
 	listenAddr string
 	logDir     string
 	assetsDir  string
+	liveURL    string
+
+	historyFile string // path of history database
+	noHistory   bool
 }
 
-func runServer(config serverConfig) {
-	var assetFS fs.FS
-	if config.assetsDir != "" {
-		if stat, _ := os.Stat(config.assetsDir); stat == nil || !stat.IsDir() {
-			log.Fatalf("-assets: %q is not a directory", config.assetsDir)
+// openAssets returns the static files of the viewer. The baked-in assets are
+// used when dir is empty.
+func openAssets(dir string) fs.FS {
+	if dir != "" {
+		if stat, _ := os.Stat(dir); stat == nil || !stat.IsDir() {
+			log.Fatalf("-assets: %q is not a directory", dir)
 		}
-		assetFS = os.DirFS(config.assetsDir)
-	} else {
-		sub, err := fs.Sub(embeddedAssets, "assets")
-		if err != nil {
-			panic(err)
-		}
-		assetFS = sub
+		return os.DirFS(dir)
 	}
+	sub, err := fs.Sub(embeddedAssets, "assets")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+func runServer(config serverConfig) {
+	assetFS := openAssets(config.assetsDir)
 
 	// Create handlers.
 	logDirFS := os.DirFS(config.logDir)
-	logHandler := http.FileServer(http.FS(logDirFS))
-	listingHandler := serveListing{fsys: logDirFS}
+	logHandler := newResultFileServer(logDirFS)
+	var history *historyDB
+	if !config.noHistory {
+		historyFile := config.historyFile
+		if historyFile == "" {
+			historyFile = filepath.Join(config.logDir, historyFileName)
+		}
+		var err error
+		if history, err = openHistory(historyFile); err != nil {
+			log.Fatalf("Can't open history: %v", err)
+		}
+	}
+	api := resultAPI{index: newResultIndex(logDirFS, history)}
 	mux := mux.NewRouter()
-	mux.Handle("/listing.jsonl", listingHandler).Methods("GET")
+	mux.HandleFunc("/listing.jsonl", api.serveListing).Methods("GET")
+	mux.HandleFunc("/api/suites", api.serveSuites).Methods("GET")
+	mux.HandleFunc("/api/tests", api.serveTests).Methods("GET")
+	mux.HandleFunc("/api/clients", api.serveClients).Methods("GET")
+	mux.HandleFunc("/api/history/trend", api.serveHistoryTrend).Methods("GET")
+	mux.HandleFunc("/api/history/failing", api.serveHistoryFailing).Methods("GET")
+	mux.HandleFunc("/api/history/test", api.serveHistoryTest).Methods("GET")
+	mux.Handle("/compare.json", serveCompare{fsys: logDirFS}).Methods("GET")
+	if config.liveURL != "" {
+		mux.Handle("/live/events", liveProxy(config.liveURL)).Methods("GET")
+	}
 	mux.PathPrefix("/results").Handler(http.StripPrefix("/results/", logHandler))
 	mux.PathPrefix("/").Handler(http.FileServer(http.FS(assetFS)))
 
@@ -53,12 +85,18 @@ func runServer(config serverConfig) {
 	http.Serve(l, mux)
 }
 
-type serveListing struct{ fsys fs.FS }
-
-func (h serveListing) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	log.Printf("Generating listing...")
-	err := generateListing(h.fsys, ".", w)
+// liveProxy forwards the live event stream of a running hive instance.
+func liveProxy(streamURL string) http.Handler {
+	target, err := url.Parse(streamURL)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		log.Fatalf("-live: invalid URL: %v", err)
+	}
+	return &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			u := *target
+			r.URL = &u
+			r.Host = target.Host
+		},
+		FlushInterval: -1, // flush events immediately
 	}
 }
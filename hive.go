@@ -5,9 +5,14 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
+	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"regexp"
+	"runtime/debug"
 	"strings"
 	"syscall"
 	"time"
@@ -33,6 +38,10 @@ func main() {
 		simLogLevel           = flag.Int("sim.loglevel", 3, "Selects log `level` of client instances. Supports values 0-5.")
 		simDevMode            = flag.Bool("dev", false, "Only starts the simulator API endpoint (listening at 127.0.0.1:3000 by default) without starting any simulators.")
 		simDevModeAPIEndpoint = flag.String("dev.addr", "127.0.0.1:3000", "Endpoint that the simulator API listens on")
+		liveAddr              = flag.String("live.addr", "", "Serves a stream of test events at http://<`address`>/events while simulations are running.")
+		metricsAddr           = flag.String("metrics.addr", "", "Serves Prometheus metrics at http://<`address`>/metrics.")
+		resultsFormat         = flag.String("results.format", "", "Comma separated `list` of report formats to write at the end of the run (junit, tap, markdown, json-summary).")
+		cleanup               = flag.Bool("cleanup", false, "Removes docker containers and networks left behind by hive runs that are no longer running, then exits.")
 
 		clients = flag.String("client", "go-ethereum", "Comma separated `list` of clients to use. Client names in the list may be given as\n"+
 			"just the client name, or a client_branch specifier. If a branch name is supplied,\n"+
@@ -43,11 +52,58 @@ func main() {
 			"If a very long chain is imported, this timeout may need to be quite large.\n"+
 			"A lower value means that hive won't wait as long in case the node crashes and\n"+
 			"never opens the RPC port.")
+		clientLimit = flag.Int("client.limit", 0, "Max `number` of concurrently running client containers. Client start requests\n"+
+			"beyond the limit wait until a running client exits. Zero means unlimited.")
+		clientQueueTimeout = flag.Duration("client.queuetimeout", 0, "Max `time` a client start request waits for --client.limit or --client.membudget.\n"+
+			"Zero means requests wait until a client slot is available.")
+		clientMemLimit  = flag.Int64("client.memlimit", 0, "Memory limit of each client container in `MB`. Zero means unlimited.")
+		clientMemBudget = flag.Int64("client.membudget", 0, "Total memory limit of concurrently running client containers in `MB`.\n"+
+			"Client start requests beyond the budget wait until a running client exits.\n"+
+			"This requires --client.memlimit.")
+		clientLogExcerpt = flag.Int("client.logexcerpt", 50, "Number of trailing client log `lines` included in the log excerpts of failed tests.\n"+
+			"Excerpts also contain all warnings and errors logged during the test. Zero disables excerpts.")
 	)
 
-	// Parse the flags and configure the logger.
+	// Parse the flags. In reproduce mode, the flags of the original run are
+	// loaded from the manifest.
 	flag.Parse()
+	var manifest *libhive.RunManifest
+	if flag.NArg() > 0 {
+		if flag.Arg(0) != "reproduce" || flag.NArg() != 2 {
+			fatal("usage: hive [flags] reproduce <manifest>")
+		}
+		m, err := libhive.LoadRunManifest(flag.Arg(1))
+		if err != nil {
+			fatal(err)
+		}
+		if err := applyManifestFlags(m.Args); err != nil {
+			fatal("bad manifest:", err)
+		}
+		manifest = m
+	}
+
+	// Configure the logger.
 	log15.Root().SetHandler(log15.LvlFilterHandler(log15.Lvl(*loglevelFlag), log15.StreamHandler(os.Stderr, log15.TerminalFormat())))
+	if manifest != nil {
+		checkManifestVersion(manifest)
+	}
+	if *clientMemBudget > 0 && *clientMemLimit == 0 {
+		fatal("--client.membudget requires --client.memlimit")
+	}
+	if *clientMemBudget > 0 && *clientMemLimit > *clientMemBudget {
+		fatal("--client.memlimit exceeds --client.membudget")
+	}
+	if *clientQueueTimeout < 0 {
+		fatal("--client.queuetimeout must not be negative")
+	}
+	if *clientLogExcerpt < 0 {
+		fatal("--client.logexcerpt must not be negative")
+	}
+
+	reportFormats, err := libhive.ParseReportFormats(*resultsFormat)
+	if err != nil {
+		fatal("bad --results.format:", err)
+	}
 
 	if *simTestLimit > 0 {
 		log15.Warn("Option --sim.testlimit is deprecated and will have no effect.")
@@ -69,6 +125,16 @@ func main() {
 		log15.Warn("--sim is ignored when using --dev mode")
 		simList = nil
 	}
+	clientList := splitAndTrim(*clients, ",")
+	if manifest != nil {
+		simList, clientList = nil, nil
+		for _, sim := range manifest.Simulators {
+			simList = append(simList, sim.Name)
+		}
+		for _, client := range manifest.Clients {
+			clientList = append(clientList, client.Name)
+		}
+	}
 
 	// Create the docker backends.
 	dockerConfig := &libdocker.Config{
@@ -100,19 +166,57 @@ func main() {
 		cancel()
 	}()
 
+	// Check for resources left behind by crashed hive runs.
+	dead, unknown, err := cb.DeadRunResources()
+	if err != nil {
+		log15.Warn("can't check for left over docker resources", "err", err)
+	}
+	if len(unknown) > 0 {
+		log15.Info(fmt.Sprintf("found %d containers and networks of hive runs on other hosts, not checking them", len(unknown)))
+	}
+	if *cleanup {
+		if err := cb.RemoveResources(ctx, dead); err != nil {
+			fatal(err)
+		}
+		log15.Info(fmt.Sprintf("removed %d containers and networks of dead hive runs", len(dead)))
+		return
+	}
+	if len(dead) > 0 {
+		log15.Warn(fmt.Sprintf("found %d containers and networks of dead hive runs, use --cleanup to remove them", len(dead)))
+	}
+
 	// Run.
 	env := libhive.SimEnv{
-		LogDir:             *testResultsRoot,
-		SimLogLevel:        *simLogLevel,
-		SimTestPattern:     *simTestPattern,
-		SimParallelism:     *simParallelism,
-		SimDurationLimit:   *simTimeLimit,
-		ClientStartTimeout: *clientTimeout,
+		LogDir:                *testResultsRoot,
+		SimLogLevel:           *simLogLevel,
+		SimTestPattern:        *simTestPattern,
+		SimParallelism:        *simParallelism,
+		SimDurationLimit:      *simTimeLimit,
+		ClientStartTimeout:    *clientTimeout,
+		ClientLimit:           *clientLimit,
+		ClientQueueTimeout:    *clientQueueTimeout,
+		ClientMemoryLimit:     *clientMemLimit * 1024 * 1024,
+		ClientMemoryBudget:    *clientMemBudget * 1024 * 1024,
+		ClientLogExcerptLines: *clientLogExcerpt,
+	}
+	if *liveAddr != "" {
+		env.LiveFeed = libhive.NewLiveFeed()
+		if err := serveLiveFeed(*liveAddr, env.LiveFeed); err != nil {
+			fatal(err)
+		}
+	}
+	if *metricsAddr != "" {
+		if err := serveMetrics(*metricsAddr); err != nil {
+			fatal(err)
+		}
 	}
 	runner := libhive.NewRunner(inv, builder, cb)
-	clientList := splitAndTrim(*clients, ",")
-
-	if err := runner.Build(ctx, clientList, simList); err != nil {
+	if manifest != nil {
+		err = runner.UseManifest(ctx, manifest)
+	} else {
+		err = runner.Build(ctx, clientList, simList)
+	}
+	if err != nil {
 		fatal(err)
 	}
 
@@ -121,16 +225,50 @@ func main() {
 		return
 	}
 
-	var failCount int
+	// Record the run manifest.
+	newManifest, err := runner.Manifest(ctx)
+	if err != nil {
+		fatal(err)
+	}
+	newManifest.Args = flagArgs()
+	newManifest.HiveCommit, newManifest.HiveDirty = hiveVersion()
+	if env.RunManifest, err = libhive.WriteRunManifest(env.LogDir, newManifest); err != nil {
+		fatal("can't write run manifest:", err)
+	}
+	log15.Info("run manifest written", "file", filepath.Join(env.LogDir, filepath.FromSlash(env.RunManifest)))
+
+	var (
+		failCount int
+		suites    []*libhive.TestSuite
+		simErr    error
+	)
 	for _, sim := range simList {
 		result, err := runner.Run(ctx, sim, env)
+		failCount += result.TestsFailed
+		suites = append(suites, result.TestSuites...)
 		if err != nil {
-			fatal(err)
+			// Stop running simulators, but still write reports of the suites so far.
+			log15.Error(fmt.Sprintf("simulation %s failed", sim), "err", err)
+			simErr = err
+			break
 		}
-		failCount += result.TestsFailed
 		log15.Info(fmt.Sprintf("simulation %s finished", sim), "suites", result.Suites, "tests", result.Tests, "failed", result.TestsFailed)
 	}
 
+	// Write reports.
+	if len(reportFormats) > 0 {
+		files, err := libhive.WriteReports(env.LogDir, env.RunManifest, suites, reportFormats)
+		for _, file := range files {
+			log15.Info("report written", "file", filepath.Join(env.LogDir, filepath.FromSlash(file)))
+		}
+		if err != nil {
+			fatal("can't write reports:", err)
+		}
+	}
+
+	if simErr != nil {
+		fatal(simErr)
+	}
 	switch failCount {
 	case 0:
 	case 1:
@@ -140,11 +278,124 @@ func main() {
 	}
 }
 
+// serveLiveFeed starts the HTTP server for the live event stream.
+func serveLiveFeed(addr string, feed *libhive.LiveFeed) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("can't listen on --live.addr: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/events", feed)
+	go http.Serve(l, mux)
+	log15.Info("serving live test events", "url", "http://"+l.Addr().String()+"/events")
+	return nil
+}
+
+// serveMetrics starts the HTTP server for Prometheus metrics.
+func serveMetrics(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("can't listen on --metrics.addr: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", libhive.MetricsHandler())
+	go http.Serve(l, mux)
+	log15.Info("serving metrics", "url", "http://"+l.Addr().String()+"/metrics")
+	return nil
+}
+
 func fatal(args ...interface{}) {
 	fmt.Fprintln(os.Stderr, args...)
 	os.Exit(1)
 }
 
+// applyManifestFlags sets the flags recorded in a run manifest.
+// Flags given on the command line take precedence.
+func applyManifestFlags(args []string) error {
+	override := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { override[f.Name] = true })
+	for _, arg := range args {
+		name := strings.TrimLeft(arg, "-")
+		value := "true"
+		if i := strings.IndexByte(name, '='); i >= 0 {
+			name, value = name[:i], name[i+1:]
+		}
+		f := flag.Lookup(name)
+		if f == nil || !strings.HasPrefix(arg, "-") {
+			return fmt.Errorf("unknown flag %q", arg)
+		}
+		if override[name] {
+			continue
+		}
+		if err := f.Value.Set(value); err != nil {
+			return fmt.Errorf("invalid value %q for flag --%s: %v", value, name, err)
+		}
+	}
+	return nil
+}
+
+// checkManifestVersion warns if hive was built from a different commit than
+// the one that wrote the manifest.
+func checkManifestVersion(m *libhive.RunManifest) {
+	commit, dirty := hiveVersion()
+	switch {
+	case m.HiveCommit == "":
+		log15.Warn("manifest does not record the hive version")
+	case m.HiveCommit == unknownVersion || commit == unknownVersion:
+		log15.Warn("hive version unknown, can't compare it with manifest", "commit", commit, "manifest", m.HiveCommit)
+	case commit != m.HiveCommit:
+		log15.Warn("hive version differs from manifest", "commit", commit, "manifest", m.HiveCommit)
+	case m.HiveDirty || dirty:
+		log15.Warn("hive version may differ from manifest due to uncommitted changes", "commit", commit)
+	}
+}
+
+// flagArgs returns the flags which are set, in command-line syntax.
+func flagArgs() []string {
+	args := []string{}
+	flag.Visit(func(f *flag.Flag) {
+		args = append(args, "--"+f.Name+"="+f.Value.String())
+	})
+	return args
+}
+
+// unknownVersion is recorded in the run manifest when the hive version can't be determined.
+const unknownVersion = "unknown"
+
+// hiveVersion returns the git commit that hive was built from.
+func hiveVersion() (commit string, dirty bool) {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				commit = s.Value
+			case "vcs.modified":
+				dirty = s.Value == "true"
+			}
+		}
+	}
+	if commit == "" {
+		commit, dirty = gitVersion()
+	}
+	if commit == "" {
+		commit = unknownVersion
+	}
+	return commit, dirty
+}
+
+// gitVersion returns the commit of the git repository in the working directory.
+// This is used when hive was built without version control information, e.g.
+// by 'go run' or with -buildvcs=false.
+func gitVersion() (commit string, dirty bool) {
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return "", false
+	}
+	status, err := exec.Command("git", "status", "--porcelain", "--untracked-files=no").Output()
+	dirty = err == nil && len(strings.TrimSpace(string(status))) > 0
+	return strings.TrimSpace(string(out)), dirty
+}
+
 func splitAndTrim(input, sep string) []string {
 	list := strings.Split(input, sep)
 	for i := range list {
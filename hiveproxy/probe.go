@@ -0,0 +1,166 @@
+package hiveproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// These are the supported probe types.
+const (
+	ProbeTCP     = "tcp"
+	ProbeHTTP    = "http"
+	ProbeJSONRPC = "jsonrpc"
+)
+
+// Probe is a readiness check of a network endpoint.
+type Probe struct {
+	Type   string `json:"type"`             // one of the Probe* constants
+	Addr   string `json:"addr"`             // host:port of the endpoint
+	Path   string `json:"path,omitempty"`   // URL path for HTTP and JSON-RPC probes
+	Method string `json:"method,omitempty"` // method name for JSON-RPC probes
+}
+
+// Validate checks whether the probe is well-formed.
+func (p *Probe) Validate() error {
+	host, port, err := net.SplitHostPort(p.Addr)
+	if err != nil {
+		return err
+	}
+	if net.ParseIP(host) == nil {
+		return errors.New("invalid IP")
+	}
+	if _, err := net.LookupPort("tcp", port); err != nil {
+		return errors.New("invalid port")
+	}
+	switch p.Type {
+	case ProbeTCP, ProbeHTTP:
+	case ProbeJSONRPC:
+		if p.Method == "" {
+			return errors.New("missing method in JSON-RPC probe")
+		}
+	default:
+		return fmt.Errorf("unknown probe type %q", p.Type)
+	}
+	return nil
+}
+
+// url returns the HTTP endpoint of the probe.
+func (p *Probe) url() string {
+	path := p.Path
+	if path == "" || path[0] != '/' {
+		path = "/" + path
+	}
+	return "http://" + p.Addr + path
+}
+
+// Probe runs the given readiness check repeatedly until it succeeds.
+func (pfn *proxyFunctions) Probe(ctx context.Context, id uint64, probe Probe) error {
+	ctx, cancel := pfn.makeContext(ctx, id)
+	defer cancel()
+
+	if err := probe.Validate(); err != nil {
+		return err
+	}
+
+	var (
+		lastMsg time.Time
+		lastErr error
+		ticker  = time.NewTicker(100 * time.Millisecond)
+	)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if lastErr != nil {
+				return fmt.Errorf("canceled (last error: %v)", lastErr)
+			}
+			return errors.New("canceled")
+		case <-ticker.C:
+			if time.Since(lastMsg) >= time.Second {
+				log.Printf("probing %s endpoint: %s", probe.Type, probe.Addr)
+				lastMsg = time.Now()
+			}
+			if lastErr = runProbe(ctx, &probe); lastErr == nil {
+				return nil
+			}
+		}
+	}
+}
+
+// probeTimeout is the time limit of a single probe attempt.
+const probeTimeout = 2 * time.Second
+
+// runProbe performs a single probe attempt.
+func runProbe(ctx context.Context, probe *Probe) error {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	switch probe.Type {
+	case ProbeTCP:
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", probe.Addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+
+	case ProbeHTTP:
+		req, err := http.NewRequestWithContext(ctx, "GET", probe.url(), nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 1024*1024))
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("HTTP status %d", resp.StatusCode)
+		}
+		return nil
+
+	case ProbeJSONRPC:
+		body, _ := json.Marshal(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      1,
+			"method":  probe.Method,
+			"params":  []interface{}{},
+		})
+		req, err := http.NewRequestWithContext(ctx, "POST", probe.url(), bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("content-type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		var msg struct {
+			Result json.RawMessage  `json:"result"`
+			Error  *json.RawMessage `json:"error"`
+		}
+		if err := json.NewDecoder(io.LimitReader(resp.Body, 1024*1024)).Decode(&msg); err != nil {
+			return fmt.Errorf("invalid JSON-RPC response (HTTP status %d): %v", resp.StatusCode, err)
+		}
+		if msg.Error != nil {
+			return fmt.Errorf("JSON-RPC error: %s", *msg.Error)
+		}
+		if msg.Result == nil {
+			return errors.New("JSON-RPC response has no result")
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown probe type %q", probe.Type)
+	}
+}
@@ -7,8 +7,8 @@
 // the proxy container.
 //
 // The frontend also has auxiliary functions which can be triggered by the backend via
-// RPC. Specifically, it can run TCP endpoint probes, which are used by hive to confirm
-// that the client container has started.
+// RPC. Specifically, it can run endpoint probes (TCP, HTTP and JSON-RPC), which are used
+// by hive to confirm that the client container has started.
 package hiveproxy
 
 import (
@@ -94,6 +94,31 @@ func (p *Proxy) CheckLive(ctx context.Context, addr *net.TCPAddr) error {
 	return p.rpc.CallContext(ctx, nil, "proxy_checkLive", id, addr.String())
 }
 
+// Probe instructs the proxy frontend to run the given readiness check until it
+// succeeds. It returns a nil error when the probe was successful.
+//
+// This can only be called on the proxy side created by RunBackend.
+func (p *Proxy) Probe(ctx context.Context, probe Probe) error {
+	if p.isFront {
+		return errors.New("Probe called on proxy frontend")
+	}
+	if err := probe.Validate(); err != nil {
+		return err
+	}
+
+	id := atomic.AddUint64(&p.callID, 1)
+
+	// Set up cancellation relay.
+	probeDone := make(chan struct{})
+	cancelDone := p.relayCancel(ctx, probeDone, id)
+	defer func() {
+		close(probeDone)
+		<-cancelDone
+	}()
+
+	return p.rpc.CallContext(ctx, nil, "proxy_probe", id, probe)
+}
+
 // relayCancel notifies the proxy front-end when an RPC action is canceled.
 func (p *Proxy) relayCancel(ctx context.Context, done <-chan struct{}, id uint64) chan struct{} {
 	cancelDone := make(chan struct{})
@@ -5,7 +5,10 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -61,6 +64,60 @@ func TestProxyCheckLiveCancel(t *testing.T) {
 	t.Log(err)
 }
 
+func TestProxyProbe(t *testing.T) {
+	p := runProxyPair(t, nil)
+	defer p.close()
+
+	// The server becomes ready after a few requests.
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ready := atomic.AddInt32(&requests, 1) > 3
+		switch r.URL.Path {
+		case "/health":
+			if !ready {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		case "/rpc":
+			body, _ := io.ReadAll(r.Body)
+			if !strings.Contains(string(body), `"method":"eth_syncing"`) {
+				t.Errorf("wrong JSON-RPC request: %s", body)
+			}
+			if ready {
+				io.WriteString(w, `{"jsonrpc":"2.0","id":1,"result":false}`)
+			} else {
+				io.WriteString(w, `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"not ready"}}`)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	addr := srv.Listener.Addr().String()
+
+	probes := []Probe{
+		{Type: ProbeTCP, Addr: addr},
+		{Type: ProbeHTTP, Addr: addr, Path: "/health"},
+		{Type: ProbeJSONRPC, Addr: addr, Path: "/rpc", Method: "eth_syncing"},
+	}
+	for _, probe := range probes {
+		atomic.StoreInt32(&requests, 0)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := p.back.Probe(ctx, probe); err != nil {
+			t.Errorf("%s probe failed: %v", probe.Type, err)
+		}
+		cancel()
+	}
+
+	// Check that a failing probe times out.
+	ctx, cancel := context.WithTimeout(context.Background(), 400*time.Millisecond)
+	defer cancel()
+	err := p.back.Probe(ctx, Probe{Type: ProbeHTTP, Addr: addr, Path: "/missing"})
+	if err == nil {
+		t.Fatal("probe of missing endpoint did not fail")
+	}
+	t.Log(err)
+}
+
 func TestProxyWait(t *testing.T) {
 	p := runProxyPair(t, nil)
 
@@ -1,5 +1,7 @@
 package hivesim
 
+import "time"
+
 // SuiteID identifies a test suite context.
 type SuiteID uint32
 
@@ -19,6 +21,39 @@ type ExecInfo struct {
 	ExitCode int    `json:"exitCode"`
 }
 
+// ClientLogOptions configures a client log request.
+type ClientLogOptions struct {
+	Follow bool  // stream new output until the client exits
+	Since  int64 // byte offset in the log to start at
+}
+
+// NetworkOptions configures a network created by CreateNetworkWithOptions.
+// All fields are optional, except that IPv6 requires IPv6Subnet.
+type NetworkOptions struct {
+	Subnet     string // IPv4 subnet in CIDR notation, e.g. "10.10.0.0/16"
+	Gateway    string // IPv4 gateway address, must be in Subnet
+	Internal   bool   // disables access to outside networks
+	IPv6       bool   // enables IPv6 in addition to IPv4
+	IPv6Subnet string // IPv6 subnet in CIDR notation, e.g. "fd00:10::/64", required for IPv6
+	MTU        int    // MTU of network interfaces
+}
+
+// ClientClock is the setting of a fake client clock.
+type ClientClock struct {
+	Offset time.Duration // difference to real time
+	Rate   float64       // speed relative to real time
+}
+
+// ClientCrash describes an unexpected exit of a client container.
+type ClientCrash struct {
+	ID        string    `json:"id"`   // Container ID.
+	Name      string    `json:"name"` // Client name.
+	Time      time.Time `json:"time"`
+	ExitCode  int       `json:"exitCode"`
+	OOMKilled bool      `json:"oomKilled"`
+	LogTail   []string  `json:"logTail"` // Last lines of client output.
+}
+
 // ClientMetadata is part of the ClientDefinition and lists metadata
 type ClientMetadata struct {
 	Roles []string `yaml:"roles" json:"roles"`
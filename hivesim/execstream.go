@@ -0,0 +1,170 @@
+package hivesim
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/ethereum/hive/internal/simapi"
+	"github.com/gorilla/websocket"
+)
+
+// ExecStream is a command running in a client container.
+// It is created by Client.ExecStream.
+type ExecStream struct {
+	// Stdout and Stderr are the output streams of the command. Output is buffered,
+	// so reading the streams is optional. Both streams return io.EOF after the
+	// command has exited.
+	Stdout io.Reader
+	Stderr io.Reader
+
+	conn        *websocket.Conn
+	writeMu     sync.Mutex
+	stdinClosed bool
+	stdout      *outputBuffer
+	stderr      *outputBuffer
+
+	done     chan struct{}
+	exitCode int
+	err      error
+}
+
+func newExecStream(ctx context.Context, conn *websocket.Conn) *ExecStream {
+	s := &ExecStream{
+		conn:   conn,
+		stdout: newOutputBuffer(),
+		stderr: newOutputBuffer(),
+		done:   make(chan struct{}),
+	}
+	s.Stdout, s.Stderr = s.stdout, s.stderr
+	go s.readLoop(ctx)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// Closing the connection terminates the command.
+			s.conn.Close()
+		case <-s.done:
+		}
+	}()
+	return s
+}
+
+var errStdinClosed = errors.New("exec stream: stdin is closed")
+
+// Write sends p to the standard input of the command.
+// This fails if standard input was closed.
+func (s *ExecStream) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil // empty messages close stdin
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if s.stdinClosed {
+		return 0, errStdinClosed
+	}
+	if err := s.conn.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// CloseStdin closes the standard input of the command.
+// Calling it more than once has no effect.
+func (s *ExecStream) CloseStdin() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if s.stdinClosed {
+		return nil
+	}
+	s.stdinClosed = true
+	return s.conn.WriteMessage(websocket.BinaryMessage, nil)
+}
+
+// Wait waits for the command to exit and returns its exit code.
+// The returned error is non-nil if the command could not be run, or if
+// the context passed to Client.ExecStream was cancelled.
+func (s *ExecStream) Wait() (int, error) {
+	<-s.done
+	return s.exitCode, s.err
+}
+
+func (s *ExecStream) readLoop(ctx context.Context) {
+	defer close(s.done)
+	defer s.conn.Close()
+	defer s.stdout.close()
+	defer s.stderr.close()
+
+	for {
+		typ, msg, err := s.conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				s.err = ctx.Err()
+			} else {
+				s.err = fmt.Errorf("exec stream interrupted: %v", err)
+			}
+			return
+		}
+		switch {
+		case typ == websocket.BinaryMessage && len(msg) > 0:
+			switch msg[0] {
+			case simapi.ExecStreamStdout:
+				s.stdout.Write(msg[1:])
+			case simapi.ExecStreamStderr:
+				s.stderr.Write(msg[1:])
+			}
+		case typ == websocket.TextMessage:
+			var result simapi.ExecStreamResult
+			if err := json.Unmarshal(msg, &result); err != nil {
+				s.err = fmt.Errorf("invalid exec result: %v", err)
+			} else if result.Error != "" {
+				s.err = errors.New(result.Error)
+			}
+			s.exitCode = result.ExitCode
+			return
+		}
+	}
+}
+
+// outputBuffer is a pipe with unlimited buffering. Writes never block.
+type outputBuffer struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	buf    bytes.Buffer
+	closed bool
+}
+
+func newOutputBuffer() *outputBuffer {
+	b := new(outputBuffer)
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cond.Broadcast()
+	return b.buf.Write(p)
+}
+
+func (b *outputBuffer) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.buf.Len() == 0 && !b.closed {
+		b.cond.Wait()
+	}
+	if b.buf.Len() == 0 {
+		return 0, io.EOF
+	}
+	return b.buf.Read(p)
+}
+
+func (b *outputBuffer) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	b.cond.Broadcast()
+}
@@ -3,6 +3,7 @@ package hivesim
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,12 +11,15 @@ import (
 	"mime/multipart"
 	"net"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/hive/internal/simapi"
+	"github.com/gorilla/websocket"
 )
 
 // Simulation wraps the simulation HTTP API provided by hive.
@@ -227,6 +231,116 @@ func (sim *Simulation) ClientExec(testSuite SuiteID, test TestID, nodeid string,
 	return resp, err
 }
 
+// ClientExecStream starts a command in a running client, streaming its input and output.
+// Cancelling the context terminates the command. If stdin is false, the standard input
+// of the command is closed right away.
+func (sim *Simulation) ClientExecStream(ctx context.Context, testSuite SuiteID, test TestID, nodeid string, cmd []string, stdin bool) (*ExecStream, error) {
+	url := fmt.Sprintf("%s/testsuite/%d/test/%d/node/%s/exec-stream", sim.url, testSuite, test, nodeid)
+	url = "ws" + strings.TrimPrefix(url, "http")
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, url, nil)
+	if err != nil {
+		if resp != nil && resp.StatusCode >= 400 {
+			defer resp.Body.Close()
+			return nil, responseError(resp)
+		}
+		return nil, err
+	}
+	if err := conn.WriteJSON(&simapi.ExecRequest{Command: cmd}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	s := newExecStream(ctx, conn)
+	if !stdin {
+		if err := s.CloseStdin(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// UpdateClientClock changes the fake clock of a client which was started with
+// WithClockOffset or WithClockRate. The shift is added to the clock offset. If rate
+// is non-zero, it becomes the new clock speed. The new clock setting is returned.
+func (sim *Simulation) UpdateClientClock(testSuite SuiteID, test TestID, nodeid string, shift time.Duration, rate float64) (*ClientClock, error) {
+	var (
+		url  = fmt.Sprintf("%s/testsuite/%d/test/%d/node/%s/clock", sim.url, testSuite, test, nodeid)
+		req  = &simapi.ClockUpdate{Rate: rate}
+		resp simapi.ClockConfig
+	)
+	if shift != 0 {
+		req.Shift = shift.String()
+	}
+	if err := post(url, req, &resp); err != nil {
+		return nil, err
+	}
+	offset, err := time.ParseDuration(resp.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("invalid clock offset in response: %v", err)
+	}
+	return &ClientClock{Offset: offset, Rate: resp.Rate}, nil
+}
+
+// ClientLogs returns the log output of a client. The caller must close the returned reader.
+// When opts.Follow is set, the reader returns new output until the client exits or the
+// context is cancelled.
+func (sim *Simulation) ClientLogs(ctx context.Context, testSuite SuiteID, test TestID, nodeid string, opts ClientLogOptions) (io.ReadCloser, error) {
+	url := fmt.Sprintf("%s/testsuite/%d/test/%d/node/%s/logs?since=%d", sim.url, testSuite, test, nodeid, opts.Since)
+	if opts.Follow {
+		url += "&follow=1"
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return requestStream(req)
+}
+
+// ClientCrashes subscribes to crashes of clients in a test. The returned channel receives
+// a value for each client that exits before it is stopped. Note that hive also fails the
+// test when a client crashes. The channel is closed when the test ends or the context is
+// cancelled.
+func (sim *Simulation) ClientCrashes(ctx context.Context, testSuite SuiteID, test TestID) (<-chan *ClientCrash, error) {
+	url := fmt.Sprintf("%s/testsuite/%d/test/%d/crashes", sim.url, testSuite, test)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := requestStream(req)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan *ClientCrash)
+	go func() {
+		defer close(ch)
+		defer body.Close()
+		dec := json.NewDecoder(body)
+		for {
+			crash := new(ClientCrash)
+			if err := dec.Decode(crash); err != nil {
+				return
+			}
+			select {
+			case ch <- crash:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// ClientFiles returns a tar archive of a file or directory in a running client.
+// The path must be absolute. The caller must close the returned reader.
+func (sim *Simulation) ClientFiles(testSuite SuiteID, test TestID, nodeid string, path string) (io.ReadCloser, error) {
+	url := fmt.Sprintf("%s/testsuite/%d/test/%d/node/%s/file?path=%s", sim.url, testSuite, test, nodeid, neturl.QueryEscape(path))
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return requestStream(req)
+}
+
 // CreateNetwork sends a request to the hive server to create a docker network by
 // the given name.
 func (sim *Simulation) CreateNetwork(testSuite SuiteID, networkName string) error {
@@ -234,6 +348,24 @@ func (sim *Simulation) CreateNetwork(testSuite SuiteID, networkName string) erro
 	return post(url, nil, nil)
 }
 
+// CreateNetworkWithOptions is like CreateNetwork, but also configures the network.
+// This can be used to create IPv6-enabled networks, or internal networks without
+// access to the outside world.
+func (sim *Simulation) CreateNetworkWithOptions(testSuite SuiteID, networkName string, opts NetworkOptions) error {
+	var (
+		url = fmt.Sprintf("%s/testsuite/%d/network/%s", sim.url, testSuite, networkName)
+		req = &simapi.NetworkOptions{
+			Subnet:     opts.Subnet,
+			Gateway:    opts.Gateway,
+			Internal:   opts.Internal,
+			IPv6:       opts.IPv6,
+			IPv6Subnet: opts.IPv6Subnet,
+			MTU:        opts.MTU,
+		}
+	)
+	return post(url, req, nil)
+}
+
 // RemoveNetwork sends a request to the hive server to remove the given network.
 func (sim *Simulation) RemoveNetwork(testSuite SuiteID, network string) error {
 	url := fmt.Sprintf("%s/testsuite/%d/network/%s", sim.url, testSuite, network)
@@ -241,10 +373,15 @@ func (sim *Simulation) RemoveNetwork(testSuite SuiteID, network string) error {
 }
 
 // ConnectContainer sends a request to the hive server to connect the given
-// container to the given network.
-func (sim *Simulation) ConnectContainer(testSuite SuiteID, network, containerID string) error {
+// container to the given network. The aliases, if any, become DNS names of
+// the container in the network.
+func (sim *Simulation) ConnectContainer(testSuite SuiteID, network, containerID string, aliases ...string) error {
 	url := fmt.Sprintf("%s/testsuite/%d/network/%s/%s", sim.url, testSuite, network, containerID)
-	return post(url, nil, nil)
+	var req interface{}
+	if len(aliases) > 0 {
+		req = &simapi.NetworkConnectRequest{Aliases: aliases}
+	}
+	return post(url, req, nil)
 }
 
 // DisconnectContainer sends a request to the hive server to disconnect the given
@@ -265,6 +402,30 @@ func (sim *Simulation) ContainerNetworkIP(testSuite SuiteID, network, containerI
 	return resp, err
 }
 
+// ContainerNetworkIPv6 returns the global IPv6 address of a container on the given
+// network. The network must have been created with IPv6 enabled. If the container ID
+// is "simulation", it returns the address of the simulator container.
+func (sim *Simulation) ContainerNetworkIPv6(testSuite SuiteID, network, containerID string) (string, error) {
+	var (
+		url  = fmt.Sprintf("%s/testsuite/%d/network/%s/%s?family=ipv6", sim.url, testSuite, network, containerID)
+		resp string
+	)
+	err := get(url, &resp)
+	return resp, err
+}
+
+// AttachArtifact stores a file produced by a test case in the hive results directory.
+// The artifact is listed in the test report under the given name.
+func (sim *Simulation) AttachArtifact(testSuite SuiteID, test TestID, name string, content io.Reader) error {
+	url := fmt.Sprintf("%s/testsuite/%d/test/%d/artifact?name=%s", sim.url, testSuite, test, neturl.QueryEscape(name))
+	req, err := http.NewRequest("POST", url, content)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("content-type", "application/octet-stream")
+	return request(req, nil)
+}
+
 func (setup *clientSetup) postWithFiles(url string, result interface{}) error {
 	var (
 		pipeR, pipeW = io.Pipe()
@@ -375,21 +536,7 @@ func request(httpReq *http.Request, result interface{}) error {
 
 	switch {
 	case resp.StatusCode >= 400:
-		// It's an error response.
-		switch resp.Header.Get("content-type") {
-		case "application/json":
-			var errobj simapi.Error
-			if err := dec.Decode(&errobj); err != nil {
-				return fmt.Errorf("request failed (status %d) and can't decode error message: %v", resp.StatusCode, err)
-			}
-			return errors.New(errobj.Error)
-		default:
-			respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
-			if len(respBody) == 0 {
-				return fmt.Errorf("request failed (status %d)", resp.StatusCode)
-			}
-			return fmt.Errorf("request failed (status %d): %s", resp.StatusCode, respBody)
-		}
+		return responseError(resp)
 	case resp.StatusCode >= 200 && resp.StatusCode < 300:
 		// Request was successful.
 		if result != nil {
@@ -403,3 +550,40 @@ func request(httpReq *http.Request, result interface{}) error {
 		return fmt.Errorf("invalid response status code %d", resp.StatusCode)
 	}
 }
+
+// requestStream performs a request and returns the response body
+// without decoding it.
+func requestStream(httpReq *http.Request) (io.ReadCloser, error) {
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode >= 400:
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return resp.Body, nil
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("invalid response status code %d", resp.StatusCode)
+	}
+}
+
+// responseError decodes the error of a failed request.
+func responseError(resp *http.Response) error {
+	switch resp.Header.Get("content-type") {
+	case "application/json":
+		var errobj simapi.Error
+		if err := json.NewDecoder(resp.Body).Decode(&errobj); err != nil {
+			return fmt.Errorf("request failed (status %d) and can't decode error message: %v", resp.StatusCode, err)
+		}
+		return errors.New(errobj.Error)
+	default:
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		if len(respBody) == 0 {
+			return fmt.Errorf("request failed (status %d)", resp.StatusCode)
+		}
+		return fmt.Errorf("request failed (status %d): %s", resp.StatusCode, respBody)
+	}
+}
@@ -1,19 +1,30 @@
 package hivesim
 
 import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
+	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"reflect"
+	"regexp"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/ethereum/hive/internal/fakes"
 	"github.com/ethereum/hive/internal/libhive"
+	"github.com/ethereum/hive/internal/simapi"
 )
 
 // This test checks that the API returns configured client names correctly.
@@ -173,6 +184,41 @@ func TestStartClientStartOptions(t *testing.T) {
 		}
 	})
 
+	t.Run("readiness_options", func(t *testing.T) {
+		// Default is the TCP check of port 8545.
+		if _, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1"); err != nil {
+			t.Fatalf("failed to start client: %v", err)
+		}
+		want := &simapi.ReadinessProbe{Type: "tcp", Port: 8545}
+		if !reflect.DeepEqual(lastOptions.Readiness, want) {
+			t.Fatalf("wrong default probe: %+v", lastOptions.Readiness)
+		}
+
+		// Probe configured by the simulator.
+		probe := ReadinessProbe{Type: "jsonrpc", Port: 9545, Method: "optimism_syncStatus", Timeout: 2 * time.Minute}
+		if _, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1", WithReadinessProbe(probe)); err != nil {
+			t.Fatalf("failed to start client: %v", err)
+		}
+		want = &simapi.ReadinessProbe{Type: "jsonrpc", Port: 9545, Method: "optimism_syncStatus", Timeout: "2m0s"}
+		if !reflect.DeepEqual(lastOptions.Readiness, want) {
+			t.Fatalf("wrong probe: %+v", lastOptions.Readiness)
+		}
+
+		// Disabled check.
+		if _, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1", Params{"HIVE_CHECK_LIVE_PORT": "0"}); err != nil {
+			t.Fatalf("failed to start client: %v", err)
+		}
+		if lastOptions.Readiness != nil {
+			t.Fatalf("probe set despite HIVE_CHECK_LIVE_PORT=0: %+v", lastOptions.Readiness)
+		}
+
+		// Invalid probe.
+		_, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1", WithReadinessProbe(ReadinessProbe{Type: "jsonrpc", Port: 8545}))
+		if err == nil {
+			t.Fatal("no error for jsonrpc probe without method")
+		}
+	})
+
 	t.Run("files_options", func(t *testing.T) {
 		file1, err := ioutil.TempFile("", "hivesim_test")
 		if err != nil {
@@ -303,6 +349,795 @@ func TestRunProgram(t *testing.T) {
 	}
 }
 
+// This checks that files can be read from client containers.
+func TestClientReadFile(t *testing.T) {
+	hooks := &fakes.BackendHooks{
+		CopyFromContainer: func(containerID, path string, w io.Writer) error {
+			if path != "/version.txt" {
+				return fmt.Errorf("no such file %s", path)
+			}
+			tw := tar.NewWriter(w)
+			content := []byte("v1.0.0")
+			tw.WriteHeader(&tar.Header{Name: "version.txt", Mode: 0644, Size: int64(len(content))})
+			tw.Write(content)
+			return tw.Close()
+		},
+	}
+	tm, srv := newFakeAPI(hooks)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	suite := Suite{Name: "suite"}
+	suite.Add(ClientTestSpec{
+		Role: "eth1",
+		Name: "read file",
+		Run: func(t *T, c *Client) {
+			content, err := c.ReadFile("/version.txt")
+			if err != nil {
+				t.Fatal("read failed:", err)
+			}
+			if string(content) != "v1.0.0" {
+				t.Fatalf("wrong content %q", content)
+			}
+			if _, err := c.ReadFile("/missing"); err == nil || !strings.Contains(err.Error(), "no such file") {
+				t.Fatal("wrong error for missing file:", err)
+			}
+			if _, err := c.ReadFile("relative/path"); err == nil {
+				t.Fatal("no error for relative path")
+			}
+		},
+	})
+	if err := RunSuite(NewAt(srv.URL), suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+	tm.Terminate()
+	for _, test := range tm.Results()[0].TestCases {
+		if !test.SummaryResult.Pass {
+			t.Fatal("test failed:", test.SummaryResult.Details)
+		}
+	}
+}
+
+func TestClientExecStream(t *testing.T) {
+	hooks := &fakes.BackendHooks{
+		RunProgramStream: func(containerID string, cmd []string, streams libhive.ExecStreams) (int, error) {
+			switch cmd[0] {
+			case "/hive-bin/cat":
+				io.Copy(streams.Stdout, streams.Stdin)
+				return 0, nil
+			case "/hive-bin/fail":
+				io.WriteString(streams.Stderr, "boom")
+				return 3, nil
+			case "/hive-bin/wait":
+				// Reading stdin fails when the connection is closed.
+				_, err := io.Copy(io.Discard, streams.Stdin)
+				return 0, err
+			default:
+				return 0, fmt.Errorf("unknown command %v", cmd)
+			}
+		},
+	}
+	tm, srv := newFakeAPI(hooks)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	suite := Suite{Name: "suite"}
+	suite.Add(ClientTestSpec{
+		Role: "eth1",
+		Name: "exec stream",
+		Run: func(t *T, c *Client) {
+			ctx := context.Background()
+
+			// Input is forwarded and output is returned.
+			s, err := c.ExecStreamInput(ctx, "cat")
+			if err != nil {
+				t.Fatal("exec failed:", err)
+			}
+			io.WriteString(s, "hello ")
+			io.WriteString(s, "world")
+			s.CloseStdin()
+			output, _ := io.ReadAll(s.Stdout)
+			if string(output) != "hello world" {
+				t.Fatalf("wrong output %q", output)
+			}
+			if code, err := s.Wait(); code != 0 || err != nil {
+				t.Fatalf("wrong result: code %d, err %v", code, err)
+			}
+
+			// Standard input is closed by default.
+			s, err = c.ExecStream(ctx, "cat")
+			if err != nil {
+				t.Fatal("exec failed:", err)
+			}
+			if code, err := s.Wait(); code != 0 || err != nil {
+				t.Fatalf("wrong result: code %d, err %v", code, err)
+			}
+			if _, err := io.WriteString(s, "input"); err != errStdinClosed {
+				t.Fatal("wrong write error:", err)
+			}
+
+			// Exit code and stderr.
+			s, err = c.ExecStream(ctx, "fail")
+			if err != nil {
+				t.Fatal("exec failed:", err)
+			}
+			if code, err := s.Wait(); code != 3 || err != nil {
+				t.Fatalf("wrong result: code %d, err %v", code, err)
+			}
+			if output, _ := io.ReadAll(s.Stderr); string(output) != "boom" {
+				t.Fatalf("wrong stderr %q", output)
+			}
+
+			// Backend errors.
+			s, err = c.ExecStream(ctx, "unknown")
+			if err != nil {
+				t.Fatal("exec failed:", err)
+			}
+			if _, err := s.Wait(); err == nil || !strings.Contains(err.Error(), "unknown command") {
+				t.Fatal("wrong error:", err)
+			}
+
+			// Cancellation.
+			cctx, cancel := context.WithCancel(ctx)
+			s, err = c.ExecStreamInput(cctx, "wait")
+			if err != nil {
+				t.Fatal("exec failed:", err)
+			}
+			cancel()
+			if _, err := s.Wait(); err != context.Canceled {
+				t.Fatal("wrong error after cancel:", err)
+			}
+		},
+	})
+	if err := RunSuite(NewAt(srv.URL), suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+	tm.Terminate()
+	for _, test := range tm.Results()[0].TestCases {
+		if !test.SummaryResult.Pass {
+			t.Fatal("test failed:", test.SummaryResult.Details)
+		}
+	}
+}
+
+func TestClientLogs(t *testing.T) {
+	var (
+		logFile  string
+		exit     = make(chan struct{})
+		exitOnce sync.Once
+		stop     = func() { exitOnce.Do(func() { close(exit) }) }
+	)
+	hooks := &fakes.BackendHooks{
+		StartContainer: func(image, containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
+			logFile = opt.LogFile
+			os.MkdirAll(filepath.Dir(logFile), 0755)
+			os.WriteFile(logFile, []byte("starting\n"), 0644)
+			return &libhive.ContainerInfo{Wait: func() { <-exit }}, nil
+		},
+		DeleteContainer: func(containerID string) error {
+			stop()
+			return nil
+		},
+	}
+	tm, srv := newFakeAPIWithEnv(hooks, libhive.SimEnv{LogDir: t.TempDir()})
+	defer srv.Close()
+	defer tm.Terminate()
+
+	suite := Suite{Name: "suite"}
+	suite.Add(ClientTestSpec{
+		Role: "eth1",
+		Name: "logs",
+		Run: func(t *T, c *Client) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			// Wait for a line which is written later.
+			go func() {
+				time.Sleep(200 * time.Millisecond)
+				f, _ := os.OpenFile(logFile, os.O_APPEND|os.O_WRONLY, 0644)
+				f.WriteString("Sequencer started\n")
+				f.Close()
+			}()
+			line, err := c.WaitForLog(ctx, regexp.MustCompile("Sequencer (started|stopped)"))
+			if err != nil {
+				t.Fatal("WaitForLog failed:", err)
+			}
+			if line != "Sequencer started" {
+				t.Fatalf("wrong line %q", line)
+			}
+
+			// Read the log without following, starting at an offset.
+			opts := ClientLogOptions{Since: int64(len("starting\n"))}
+			logs, err := t.Sim.ClientLogs(ctx, t.SuiteID, t.TestID, c.Container, opts)
+			if err != nil {
+				t.Fatal("ClientLogs failed:", err)
+			}
+			content, _ := io.ReadAll(logs)
+			logs.Close()
+			if string(content) != "Sequencer started\n" {
+				t.Fatalf("wrong log content %q", content)
+			}
+
+			// Following ends when the client exits.
+			go func() {
+				time.Sleep(200 * time.Millisecond)
+				t.Sim.StopClient(t.SuiteID, t.TestID, c.Container)
+			}()
+			_, err = c.WaitForLog(ctx, regexp.MustCompile("never"))
+			if err == nil || !strings.Contains(err.Error(), "client exited") {
+				t.Fatal("wrong error:", err)
+			}
+		},
+	})
+	if err := RunSuite(NewAt(srv.URL), suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+	tm.Terminate()
+	for _, test := range tm.Results()[0].TestCases {
+		if !test.SummaryResult.Pass {
+			t.Fatal("test failed:", test.SummaryResult.Details)
+		}
+	}
+}
+
+// This test checks that unexpected client exits are reported.
+func TestClientCrash(t *testing.T) {
+	crash := make(chan struct{})
+	hooks := &fakes.BackendHooks{
+		StartContainer: func(image, containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
+			os.MkdirAll(filepath.Dir(opt.LogFile), 0755)
+			os.WriteFile(opt.LogFile, []byte("line 1\nfatal error: out of memory\n"), 0644)
+			return &libhive.ContainerInfo{Wait: func() { <-crash }}, nil
+		},
+		InspectExit: func(containerID string) (*libhive.ExitInfo, error) {
+			return &libhive.ExitInfo{ExitCode: 137, OOMKilled: true}, nil
+		},
+	}
+	tm, srv := newFakeAPIWithEnv(hooks, libhive.SimEnv{LogDir: t.TempDir()})
+	defer srv.Close()
+	defer tm.Terminate()
+
+	suite := Suite{Name: "suite"}
+	suite.Add(ClientTestSpec{
+		Role: "eth1",
+		Name: "crash",
+		Run: func(t *T, c *Client) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			crashes, err := t.ClientCrashes(ctx)
+			if err != nil {
+				t.Fatal("can't subscribe to crashes:", err)
+			}
+			close(crash)
+
+			ev, ok := <-crashes
+			if !ok {
+				t.Fatal("no crash event")
+			}
+			if ev.ID != c.Container || ev.ExitCode != 137 || !ev.OOMKilled {
+				t.Fatalf("wrong crash event: %+v", ev)
+			}
+			want := []string{"line 1", "fatal error: out of memory"}
+			if !reflect.DeepEqual(ev.LogTail, want) {
+				t.Fatalf("wrong log tail %q", ev.LogTail)
+			}
+		},
+	})
+	if err := RunSuite(NewAt(srv.URL), suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+	tm.Terminate()
+
+	test := tm.Results()[0].TestCases[1]
+	if test.SummaryResult.Pass {
+		t.Fatal("test passed despite client crash")
+	}
+	if !strings.Contains(test.SummaryResult.Details, "exited unexpectedly with exit code 137 (killed: out of memory)") {
+		t.Fatalf("wrong test details: %q", test.SummaryResult.Details)
+	}
+	for _, info := range test.ClientInfo {
+		if info.Crash == nil || info.Crash.ExitCode != 137 {
+			t.Fatalf("crash not recorded in client info: %+v", info.Crash)
+		}
+	}
+}
+
+// This test checks that log excerpts are added to the clients of failed tests.
+// Only output written during the test is included. Timestamps in the log are
+// ignored, since clients can run with a fake clock.
+func TestClientLogExcerpt(t *testing.T) {
+	var logFile string
+	hooks := &fakes.BackendHooks{
+		StartContainer: func(image, containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
+			var log bytes.Buffer
+			clock := time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+			for i := 0; i < 10; i++ {
+				if i == 2 {
+					fmt.Fprintf(&log, "t=%s lvl=eror msg=boom\n", clock.Format(time.RFC3339))
+					continue
+				}
+				fmt.Fprintf(&log, "t=%s lvl=info msg=\"line %d\"\n", clock.Format(time.RFC3339), i)
+			}
+			os.MkdirAll(filepath.Dir(opt.LogFile), 0755)
+			os.WriteFile(opt.LogFile, log.Bytes(), 0644)
+			logFile = opt.LogFile
+			return &libhive.ContainerInfo{}, nil
+		},
+		DeleteContainer: func(containerID string) error {
+			// Output written during shutdown is not part of the excerpt.
+			f, err := os.OpenFile(logFile, os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(f, "t=%s lvl=eror msg=\"after the test\"\n", time.Now().UTC().Format(time.RFC3339))
+			return f.Close()
+		},
+	}
+	env := libhive.SimEnv{LogDir: t.TempDir(), ClientLogExcerptLines: 2}
+	tm, srv := newFakeAPIWithEnv(hooks, env)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	suite := Suite{Name: "suite"}
+	suite.Add(ClientTestSpec{
+		Role: "eth1",
+		Name: "fail",
+		Run: func(t *T, c *Client) {
+			t.Fatal("failed")
+		},
+	})
+	if err := RunSuite(NewAt(srv.URL), suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+	tm.Terminate()
+
+	test := tm.Results()[0].TestCases[1]
+	if len(test.ClientInfo) != 1 {
+		t.Fatal("wrong number of clients:", len(test.ClientInfo))
+	}
+	for _, info := range test.ClientInfo {
+		var excerpt []string
+		for _, line := range info.LogExcerpt {
+			excerpt = append(excerpt, line[strings.Index(line, " ")+1:])
+		}
+		want := []string{"lvl=eror msg=boom", "[...]", `lvl=info msg="line 8"`, `lvl=info msg="line 9"`}
+		if !reflect.DeepEqual(excerpt, want) {
+			t.Fatalf("wrong log excerpt %q", info.LogExcerpt)
+		}
+	}
+}
+
+// This test checks the fake clock options and clock updates.
+func TestClientClock(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		specs []string
+	)
+	hooks := &fakes.BackendHooks{
+		CreateContainer: func(image string, opt libhive.ContainerOptions) (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			specs = append(specs, opt.FakeClock)
+			return fmt.Sprintf("%08d", len(specs)), nil
+		},
+		SetFakeClock: func(containerID, spec string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			specs = append(specs, spec)
+			return nil
+		},
+	}
+	tm, srv := newFakeAPI(hooks)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	suite := Suite{Name: "suite"}
+	suite.Add(TestSpec{
+		Name: "clock",
+		Run: func(t *T) {
+			c := t.StartClient("client-1", WithClockOffset(-time.Hour), WithClockRate(2))
+			if err := c.ShiftClock(90 * time.Second); err != nil {
+				t.Fatal("ShiftClock failed:", err)
+			}
+			clock, err := t.Sim.UpdateClientClock(t.SuiteID, t.TestID, c.Container, 0, 0.5)
+			if err != nil {
+				t.Fatal("UpdateClientClock failed:", err)
+			}
+			if !clockNear(clock.Offset, -time.Hour+90*time.Second) || clock.Rate != 0.5 {
+				t.Fatalf("wrong clock %+v", clock)
+			}
+
+			// Clients without fake clock can't be changed.
+			c2 := t.StartClient("client-1")
+			if err := c2.ShiftClock(time.Second); err == nil {
+				t.Fatal("ShiftClock succeeded for client without fake clock")
+			}
+		},
+	})
+	if err := RunSuite(NewAt(srv.URL), suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+	tm.Terminate()
+
+	for _, test := range tm.Results()[0].TestCases {
+		if !test.SummaryResult.Pass {
+			t.Fatal("test failed:", test.SummaryResult.Details)
+		}
+	}
+	// The specs contain the clock offset at the time of the change.
+	// The offset drifts a bit between the changes because of the rate.
+	want := []struct {
+		offset time.Duration
+		rate   float64
+	}{
+		{-time.Hour, 2},
+		{-time.Hour + 90*time.Second, 2},
+		{-time.Hour + 90*time.Second, 0.5},
+	}
+	if len(specs) != len(want)+1 || specs[len(want)] != "" {
+		t.Fatalf("wrong clock specs %q", specs)
+	}
+	for i, w := range want {
+		var real, fake int64
+		var rate float64
+		if _, err := fmt.Sscanf(specs[i], "%d %d %g", &real, &fake, &rate); err != nil {
+			t.Fatalf("invalid clock spec %q: %v", specs[i], err)
+		}
+		if offset := time.Duration(fake - real); !clockNear(offset, w.offset) || rate != w.rate {
+			t.Errorf("wrong clock spec %d: offset %v, rate %v, want offset %v, rate %v", i, offset, rate, w.offset, w.rate)
+		}
+	}
+}
+
+// clockNear reports whether a clock offset is close to the expected value.
+func clockNear(offset, want time.Duration) bool {
+	d := offset - want
+	return d > -time.Second && d < time.Second
+}
+
+// This test checks that the timeline of a test is recorded.
+func TestTestEvents(t *testing.T) {
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	suite := Suite{Name: "suite"}
+	suite.Add(TestSpec{
+		Name: "events",
+		Run: func(t *T) {
+			if err := t.Sim.CreateNetwork(t.SuiteID, "net"); err != nil {
+				t.Fatal("can't create network:", err)
+			}
+			c := t.StartClient("client-1", WithInitialNetworks([]string{"net"}))
+			if _, err := c.Exec("status.sh"); err != nil {
+				t.Fatal("exec failed:", err)
+			}
+			if err := t.Sim.DisconnectContainer(t.SuiteID, "net", c.Container); err != nil {
+				t.Fatal("disconnect failed:", err)
+			}
+			if err := t.Sim.StopClient(t.SuiteID, t.TestID, c.Container); err != nil {
+				t.Fatal("stop failed:", err)
+			}
+			// This client is not probed, and it is stopped by EndTest.
+			t.StartClient("client-1", WithReadinessProbe(ReadinessProbe{Type: "none"}))
+		},
+	})
+	if err := RunSuite(NewAt(srv.URL), suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+	tm.Terminate()
+
+	test := tm.Results()[0].TestCases[1]
+	var types []string
+	for _, ev := range test.Events {
+		types = append(types, ev.Type)
+	}
+	want := []string{
+		libhive.EventNetworkConnect,
+		libhive.EventClientStart,
+		libhive.EventClientReady,
+		libhive.EventExec,
+		libhive.EventNetworkDisconnect,
+		libhive.EventClientStop,
+		libhive.EventClientStart,
+		libhive.EventClientStarted,
+		libhive.EventTestEnd,
+		libhive.EventClientStop,
+	}
+	if !reflect.DeepEqual(types, want) {
+		t.Fatalf("wrong events %v, want %v", types, want)
+	}
+	if ev := test.Events[3]; ev.Details != "/hive-bin/status.sh (exit code 0)" {
+		t.Errorf("wrong exec event details %q", ev.Details)
+	}
+	if ev := test.Events[5]; ev.Details != "" || ev.Client == "" {
+		t.Errorf("wrong client stop event %+v", ev)
+	}
+	if ev := test.Events[8]; ev.Details != "pass" {
+		t.Errorf("wrong test end event details %q", ev.Details)
+	}
+	if ev := test.Events[9]; ev.Details != "test ended" || ev.Client == "" {
+		t.Errorf("wrong client stop event at test end %+v", ev)
+	}
+}
+
+// This test checks that client starts beyond the client limit are queued.
+func TestClientLimit(t *testing.T) {
+	tm, srv := newFakeAPIWithEnv(nil, libhive.SimEnv{ClientLimit: 1})
+	defer srv.Close()
+	defer tm.Terminate()
+
+	suite := Suite{Name: "suite"}
+	suite.Add(TestSpec{
+		Name: "limit",
+		Run: func(t *T) {
+			c1 := t.StartClient("client-1")
+
+			started := make(chan error, 1)
+			go func() {
+				_, _, err := t.Sim.StartClientWithOptions(t.SuiteID, t.TestID, "client-2")
+				started <- err
+			}()
+			select {
+			case err := <-started:
+				t.Fatal("second client started while the first is running, err:", err)
+			case <-time.After(200 * time.Millisecond):
+			}
+
+			if err := t.Sim.StopClient(t.SuiteID, t.TestID, c1.Container); err != nil {
+				t.Fatal("stop failed:", err)
+			}
+			select {
+			case err := <-started:
+				if err != nil {
+					t.Fatal("second client failed to start:", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("second client did not start after the first one stopped")
+			}
+		},
+	})
+	if err := RunSuite(NewAt(srv.URL), suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+	tm.Terminate()
+
+	test := tm.Results()[0].TestCases[1]
+	if !test.SummaryResult.Pass {
+		t.Fatal("test failed:", test.SummaryResult.Details)
+	}
+	var queued int
+	for _, ev := range test.Events {
+		if ev.Type == libhive.EventClientQueued {
+			queued++
+		}
+	}
+	if queued != 1 {
+		t.Fatalf("expected one %s event, got %d", libhive.EventClientQueued, queued)
+	}
+}
+
+// This test checks that queued client starts fail when the start timeout expires,
+// and that a client exceeding the memory budget on its own is rejected.
+func TestClientLimitTimeout(t *testing.T) {
+	env := libhive.SimEnv{ClientLimit: 1, ClientQueueTimeout: 200 * time.Millisecond}
+	tm, srv := newFakeAPIWithEnv(nil, env)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	if _, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1"); err != nil {
+		t.Fatal("can't start client:", err)
+	}
+	_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err == nil || !strings.Contains(err.Error(), "1 of 1 clients running") {
+		t.Fatal("wrong error for queued client:", err)
+	}
+
+	env = libhive.SimEnv{ClientMemoryLimit: 2 << 20, ClientMemoryBudget: 1 << 20}
+	tm2, srv2 := newFakeAPIWithEnv(nil, env)
+	defer srv2.Close()
+	defer tm2.Terminate()
+
+	sim = NewAt(srv2.URL)
+	if suiteID, err = sim.StartSuite("suite", "", ""); err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	if testID, err = sim.StartTest(suiteID, "test", ""); err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err == nil || !strings.Contains(err.Error(), "exceeds the client memory budget of 1 MB") {
+		t.Fatal("wrong error for client exceeding the budget:", err)
+	}
+}
+
+// This test checks that the client start timeout doesn't apply to queued clients.
+func TestClientLimitWait(t *testing.T) {
+	env := libhive.SimEnv{ClientLimit: 1, ClientStartTimeout: 50 * time.Millisecond}
+	tm, srv := newFakeAPIWithEnv(nil, env)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	id, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		sim.StopClient(suiteID, testID, id)
+	}()
+	if _, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1"); err != nil {
+		t.Fatal("queued client start failed:", err)
+	}
+}
+
+// This test checks that containers of a test suite which are left over when the
+// suite ends get removed.
+func TestSuiteLeftovers(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		labels  = make(map[string]map[string]string)
+		deleted = make(map[string]bool)
+	)
+	hooks := &fakes.BackendHooks{
+		CreateContainer: func(image string, opt libhive.ContainerOptions) (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			id := fmt.Sprintf("container-%d", len(labels))
+			labels[id] = opt.Labels
+			return id, nil
+		},
+		DeleteContainer: func(containerID string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			deleted[containerID] = true
+			return nil
+		},
+		// Connecting fails, which leaves the client container behind.
+		ConnectContainer: func(containerID, networkID string, aliases []string) error {
+			return errors.New("connect failed")
+		},
+		ListResources: func(filter map[string]string) ([]libhive.Resource, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			var res []libhive.Resource
+		outer:
+			for id, l := range labels {
+				for k, v := range filter {
+					if l[k] != v {
+						continue outer
+					}
+				}
+				if !deleted[id] {
+					res = append(res, libhive.Resource{Type: libhive.ResourceContainer, ID: id})
+				}
+			}
+			return res, nil
+		},
+	}
+	tm, srv := newFakeAPI(hooks)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	if err := sim.CreateNetwork(suiteID, "net"); err != nil {
+		t.Fatal("can't create network:", err)
+	}
+	_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1", WithInitialNetworks([]string{"net"}))
+	if err == nil {
+		t.Fatal("expected error from StartClient")
+	}
+	if err := sim.EndTest(suiteID, testID, TestResult{Pass: true}); err != nil {
+		t.Fatal("can't end test:", err)
+	}
+	if err := sim.EndSuite(suiteID); err != nil {
+		t.Fatal("can't end suite:", err)
+	}
+
+	want := map[string]string{libhive.LabelSuite: "0", libhive.LabelTest: "1"}
+	if !reflect.DeepEqual(labels["container-0"], want) {
+		t.Errorf("wrong container labels %v, want %v", labels["container-0"], want)
+	}
+	if !deleted["container-0"] {
+		t.Error("left over container was not deleted")
+	}
+}
+
+// This test checks the events sent to the live feed.
+func TestLiveFeed(t *testing.T) {
+	feed := libhive.NewLiveFeed()
+	tm, srv := newFakeAPIWithEnv(nil, libhive.SimEnv{LiveFeed: feed})
+	defer srv.Close()
+	defer tm.Terminate()
+
+	events, _, unsubscribe := feed.Subscribe()
+	defer unsubscribe()
+
+	suite := Suite{Name: "suite"}
+	suite.Add(TestSpec{
+		Name: "live",
+		Run: func(t *T) {
+			t.StartClient("client-1")
+		},
+	})
+	if err := RunSuite(NewAt(srv.URL), suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+
+	var types []string
+	for len(types) == 0 || types[len(types)-1] != libhive.LiveSuiteEnd {
+		select {
+		case ev := <-events:
+			types = append(types, ev.Type)
+			if ev.Type == libhive.EventTestEnd && (ev.Pass == nil || !*ev.Pass || ev.Test != 1) {
+				t.Errorf("wrong test end event %+v", ev)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for events, have", types)
+		}
+	}
+	want := []string{
+		libhive.LiveSuiteStart,
+		libhive.LiveTestStart,
+		libhive.EventClientStart,
+		libhive.EventClientReady,
+		libhive.EventClientStop,
+		libhive.EventTestEnd,
+		libhive.LiveSuiteEnd,
+	}
+	if !reflect.DeepEqual(types, want) {
+		t.Fatalf("wrong events %v, want %v", types, want)
+	}
+
+	// Check that the HTTP stream replays the events.
+	feedSrv := httptest.NewServer(feed)
+	defer feedSrv.Close()
+	resp, err := http.Get(feedSrv.URL)
+	if err != nil {
+		t.Fatal("can't get event stream:", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("content-type"); ct != "text/event-stream" {
+		t.Fatalf("wrong content type %q", ct)
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	var sseTypes []string
+	for scanner.Scan() && len(sseTypes) < len(want) {
+		if strings.HasPrefix(scanner.Text(), "event: ") {
+			sseTypes = append(sseTypes, strings.TrimPrefix(scanner.Text(), "event: "))
+		}
+	}
+	if !reflect.DeepEqual(sseTypes, want) {
+		t.Fatalf("wrong event stream %v, want %v", sseTypes, want)
+	}
+}
+
 // This test checks for some common errors returned by StartClient.
 func TestStartClientErrors(t *testing.T) {
 	tm, srv := newFakeAPI(nil)
@@ -349,7 +1184,7 @@ func TestStartClientInitialNetworks(t *testing.T) {
 		StartContainer: func(image, containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
 			return &libhive.ContainerInfo{}, nil
 		},
-		ConnectContainer: func(containerID string, networkID string) error {
+		ConnectContainer: func(containerID string, networkID string, aliases []string) error {
 			ipcounter++
 			connections[containerID+networkID] = net.IP{203, 0, 113, ipcounter}
 			return nil
@@ -400,12 +1235,191 @@ func TestStartClientInitialNetworks(t *testing.T) {
 	}
 }
 
+// This test checks that network options are validated and passed to the backend.
+func TestCreateNetworkWithOptions(t *testing.T) {
+	var created []simapi.NetworkOptions
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		CreateNetwork: func(name string, opt simapi.NetworkOptions, labels map[string]string) (string, error) {
+			created = append(created, opt)
+			return name, nil
+		},
+	})
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+
+	opts := NetworkOptions{
+		Subnet:     "10.10.0.0/16",
+		Gateway:    "10.10.0.1",
+		Internal:   true,
+		IPv6:       true,
+		IPv6Subnet: "fd00:10::/64",
+		MTU:        1280,
+	}
+	if err := sim.CreateNetworkWithOptions(suiteID, "net1", opts); err != nil {
+		t.Fatal("can't create network:", err)
+	}
+	if err := sim.CreateNetwork(suiteID, "net2"); err != nil {
+		t.Fatal("can't create network:", err)
+	}
+	want := []simapi.NetworkOptions{
+		{Subnet: "10.10.0.0/16", Gateway: "10.10.0.1", Internal: true, IPv6: true, IPv6Subnet: "fd00:10::/64", MTU: 1280},
+		{},
+	}
+	if !reflect.DeepEqual(created, want) {
+		t.Fatalf("wrong network options %+v", created)
+	}
+	if ip, err := sim.ContainerNetworkIPv6(suiteID, "net1", "simulation"); ip != "2001:db8::2" {
+		t.Fatalf("wrong IPv6 address %q (err %v)", ip, err)
+	}
+
+	// Check validation.
+	invalid := map[string]NetworkOptions{
+		"invalid IPv4 subnet":     {Subnet: "fd00::/64"},
+		"is not in subnet":        {Subnet: "10.10.0.0/16", Gateway: "10.11.0.1"},
+		"gateway requires subnet": {Gateway: "10.10.0.1"},
+		"requires IPv6":           {IPv6Subnet: "fd00::/64"},
+		"requires an IPv6 subnet": {IPv6: true},
+		"invalid IPv6 subnet":     {IPv6: true, IPv6Subnet: "10.0.0.0/8"},
+		"invalid MTU":             {MTU: 10},
+	}
+	for wantErr, opts := range invalid {
+		err := sim.CreateNetworkWithOptions(suiteID, "bad", opts)
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("wrong error for %+v: %v", opts, err)
+		}
+	}
+}
+
+// This test checks that client host names are registered as network aliases.
+func TestClientHostname(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		hostname string
+		aliases  = make(map[string][]string)
+	)
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		CreateContainer: func(image string, opt libhive.ContainerOptions) (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			hostname = opt.Hostname
+			return "0000abcd", nil
+		},
+		ConnectContainer: func(containerID, networkID string, a []string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			aliases[networkID] = append(aliases[networkID], a...)
+			return nil
+		},
+	})
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	sim.CreateNetwork(suiteID, "net1")
+	sim.CreateNetwork(suiteID, "net2")
+	defer sim.RemoveNetwork(suiteID, "net1")
+	defer sim.RemoveNetwork(suiteID, "net2")
+
+	// Invalid host names are rejected.
+	_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1", WithHostname("-bad_name"))
+	if err == nil || !strings.Contains(err.Error(), "invalid hostname") {
+		t.Fatal("wrong error for invalid hostname:", err)
+	}
+
+	opts := []StartOption{WithInitialNetworks([]string{"net1"}), WithHostname("sequencer")}
+	containerID, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1", opts...)
+	if err != nil {
+		t.Fatal("failed to start client:", err)
+	}
+	if err := sim.ConnectContainer(suiteID, "net2", containerID, "seq", "sequencer.op"); err != nil {
+		t.Fatal("failed to connect container:", err)
+	}
+	if err := sim.ConnectContainer(suiteID, "net2", containerID, "bad alias"); err == nil {
+		t.Fatal("no error for invalid alias")
+	}
+	// Aliases must be unique in a network.
+	err = sim.ConnectContainer(suiteID, "net1", "simulation", "sequencer")
+	if err == nil || !strings.Contains(err.Error(), "already in use") {
+		t.Fatal("wrong error for duplicate alias:", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if hostname != "sequencer" {
+		t.Fatalf("wrong container hostname %q", hostname)
+	}
+	want := map[string][]string{
+		"00000001": {"sequencer"},
+		"00000002": {"seq", "sequencer.op"},
+	}
+	if !reflect.DeepEqual(aliases, want) {
+		t.Fatalf("wrong aliases %v, want %v", aliases, want)
+	}
+}
+
+// This test checks that artifacts are stored in the log directory and listed in the results.
+func TestAttachArtifact(t *testing.T) {
+	logdir := t.TempDir()
+	tm, srv := newFakeAPIWithEnv(nil, libhive.SimEnv{LogDir: logdir})
+	defer srv.Close()
+
+	suite := Suite{Name: "suite"}
+	suite.Add(TestSpec{
+		Name: "test",
+		Run: func(t *T) {
+			if err := t.AttachArtifact("config.json", strings.NewReader("{}")); err != nil {
+				t.Fatal("attach failed:", err)
+			}
+			if err := t.AttachArtifact("../escape", strings.NewReader("")); err == nil {
+				t.Fatal("no error for invalid artifact name")
+			}
+		},
+	})
+	if err := RunSuite(NewAt(srv.URL), suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+	tm.Terminate()
+
+	test := tm.Results()[0].TestCases[1]
+	if !test.SummaryResult.Pass {
+		t.Fatal("test failed:", test.SummaryResult.Details)
+	}
+	file, ok := test.Artifacts["config.json"]
+	if !ok || len(test.Artifacts) != 1 {
+		t.Fatalf("wrong artifacts in result: %v", test.Artifacts)
+	}
+	content, err := os.ReadFile(filepath.Join(logdir, filepath.FromSlash(file)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "{}" {
+		t.Fatalf("wrong artifact content %q", content)
+	}
+}
+
 func newFakeAPI(hooks *fakes.BackendHooks) (*libhive.TestManager, *httptest.Server) {
+	return newFakeAPIWithEnv(hooks, libhive.SimEnv{})
+}
+
+func newFakeAPIWithEnv(hooks *fakes.BackendHooks, env libhive.SimEnv) (*libhive.TestManager, *httptest.Server) {
 	defs := map[string]*libhive.ClientDefinition{
 		"client-1": {Name: "client-1", Image: "/ignored/in/api", Version: "client-1-version", Meta: libhive.ClientMetadata{Roles: []string{"eth1"}}},
 		"client-2": {Name: "client-2", Image: "/not/exposed/", Version: "client-2-version", Meta: libhive.ClientMetadata{Roles: []string{"beacon"}}},
 	}
-	env := libhive.SimEnv{}
 	backend := fakes.NewContainerBackend(hooks)
 	tm := libhive.NewTestManager(env, backend, defs)
 	srv := httptest.NewServer(tm.API())
@@ -3,6 +3,7 @@ package hivesim
 import (
 	"io"
 	"os"
+	"time"
 
 	"github.com/ethereum/hive/internal/simapi"
 )
@@ -37,6 +38,21 @@ func WithInitialNetworks(networks []string) StartOption {
 	})
 }
 
+// WithHostname sets the host name of the client container. The name is registered as a
+// DNS alias in the initial networks of the client (see WithInitialNetworks), so other
+// containers in these networks can reach the client by name, e.g. "http://sequencer:8545".
+// Since the name is known in advance, it can be used in configuration files before the
+// client has started.
+//
+// Host names must be unique within a network, and starting a client fails if another
+// container in one of its initial networks uses the same name. Tests which run in
+// parallel and use fixed host names should create a network for each test.
+func WithHostname(name string) StartOption {
+	return optionFunc(func(setup *clientSetup) {
+		setup.config.Hostname = name
+	})
+}
+
 // WithStaticFiles adds files from the local filesystem to the client. Map: destination file path -> source file path.
 func WithStaticFiles(initFiles map[string]string) StartOption {
 	return optionFunc(func(setup *clientSetup) {
@@ -57,6 +73,61 @@ func WithDynamicFile(dstPath string, src func() (io.ReadCloser, error)) StartOpt
 	})
 }
 
+// ReadinessProbe configures the check hive performs to confirm that a client has started.
+type ReadinessProbe struct {
+	Type    string        // "tcp", "http", "jsonrpc" or "none"
+	Port    uint16        // port of the probed endpoint
+	Path    string        // URL path of "http" and "jsonrpc" probes
+	Method  string        // method called by "jsonrpc" probes
+	Timeout time.Duration // time limit for the client to become ready
+}
+
+// WithReadinessProbe sets the startup check of the client. It overrides the probe
+// declared in the client's hive.yaml. An "http" probe succeeds when a GET request
+// returns status 2xx, and a "jsonrpc" probe succeeds when the method call returns
+// a result. Use probe type "none" to disable the check.
+func WithReadinessProbe(probe ReadinessProbe) StartOption {
+	return optionFunc(func(setup *clientSetup) {
+		setup.config.Readiness = &simapi.ReadinessProbe{
+			Type:   probe.Type,
+			Port:   probe.Port,
+			Path:   probe.Path,
+			Method: probe.Method,
+		}
+		if probe.Timeout != 0 {
+			setup.config.Readiness.Timeout = probe.Timeout.String()
+		}
+	})
+}
+
+// WithClockOffset starts the client with a fake clock which is ahead of real time by d.
+// Use a negative offset to set the clock back.
+//
+// The fake clock works for all client programs, including clients written in Go like
+// op-geth and op-node. Only the wall clock is faked: timers and sleeps run at real speed.
+// The fake clock is supported on x86-64 only. The clock can be changed while the client
+// is running using Client.ShiftClock.
+func WithClockOffset(d time.Duration) StartOption {
+	return optionFunc(func(setup *clientSetup) {
+		if setup.config.Clock == nil {
+			setup.config.Clock = new(simapi.ClockConfig)
+		}
+		setup.config.Clock.Offset = d.String()
+	})
+}
+
+// WithClockRate starts the client with a fake clock that runs at the given speed
+// relative to real time, e.g. 2 for a clock running twice as fast. See WithClockOffset
+// for limitations of the fake clock.
+func WithClockRate(rate float64) StartOption {
+	return optionFunc(func(setup *clientSetup) {
+		if setup.config.Clock == nil {
+			setup.config.Clock = new(simapi.ClockConfig)
+		}
+		setup.config.Clock.Rate = rate
+	})
+}
+
 // Bundle combines start options, e.g. to bundle files together as option.
 func Bundle(option ...StartOption) StartOption {
 	return optionFunc(func(setup *clientSetup) {
@@ -0,0 +1,139 @@
+package hivesim
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// RPCRecorder is an http.RoundTripper that records JSON-RPC traffic in the '.io' test
+// format used by the rpc-compat simulator. Every request is written as a line starting
+// with ">> ", followed by the response on a line starting with "<< ".
+//
+// Recordings of a passing run against a reference client can be used as conformance
+// test fixtures for other clients.
+type RPCRecorder struct {
+	inner http.RoundTripper
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewRPCRecorder creates a recorder that writes to w. If inner is nil,
+// http.DefaultTransport is used to perform requests.
+func NewRPCRecorder(w io.Writer, inner http.RoundTripper) *RPCRecorder {
+	if inner == nil {
+		inner = http.DefaultTransport
+	}
+	return &RPCRecorder{w: w, inner: inner}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (rec *RPCRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Read the request body.
+	var reqBytes []byte
+	if req.Body != nil {
+		var err error
+		reqBytes, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	reqCopy := req.Clone(req.Context())
+	reqCopy.Body = io.NopCloser(bytes.NewReader(reqBytes))
+
+	// Do the round trip.
+	resp, err := rec.inner.RoundTrip(reqCopy)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Read the response body.
+	respBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	respCopy := *resp
+	respCopy.Body = io.NopCloser(bytes.NewReader(respBytes))
+
+	// Write the exchange. Request and response are written together, so that
+	// concurrent calls don't get interleaved in the output.
+	if err := rec.write(reqBytes, respBytes); err != nil {
+		return nil, fmt.Errorf("can't write RPC recording: %v", err)
+	}
+	return &respCopy, nil
+}
+
+func (rec *RPCRecorder) write(req, resp []byte) error {
+	var buf bytes.Buffer
+	buf.WriteString(">> ")
+	buf.Write(compactJSON(req))
+	buf.WriteString("\n<< ")
+	buf.Write(compactJSON(resp))
+	buf.WriteByte('\n')
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	_, err := rec.w.Write(buf.Bytes())
+	return err
+}
+
+// compactJSON removes insignificant whitespace from a JSON message.
+// The .io format requires each message to be on a single line.
+func compactJSON(msg []byte) []byte {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, msg); err != nil {
+		// Not JSON, just make sure it fits on one line.
+		return bytes.ReplaceAll(bytes.TrimSpace(msg), []byte("\n"), []byte(" "))
+	}
+	return buf.Bytes()
+}
+
+// RecordRPC returns an RPC client connected to the client's RPC server. All requests
+// sent through the returned client are recorded to w. See RPCRecorder for a description
+// of the recording format.
+func (c *Client) RecordRPC(w io.Writer) *rpc.Client {
+	httpClient := &http.Client{Transport: NewRPCRecorder(w, nil)}
+	client, _ := rpc.DialHTTPWithClient(fmt.Sprintf("http://%v:8545", c.IP), httpClient)
+	return client
+}
+
+// RPCRecordingFile creates a file for recording the RPC traffic of the test in the given
+// directory. The file is named after the test and has the ".io" extension, so the
+// directory can be used as the test directory of the rpc-compat simulator.
+//
+// The caller is responsible for closing the file.
+func (t *T) RPCRecordingFile(dir string) (*os.File, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return os.Create(filepath.Join(dir, recordingFileName(t.name)))
+}
+
+// recordingFileName turns a test name into a file name.
+func recordingFileName(testName string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r == '-' || r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, strings.TrimSpace(testName))
+	if name == "" {
+		name = "test"
+	}
+	return name + ".io"
+}
@@ -0,0 +1,57 @@
+package hivesim
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// This test checks that RPCRecorder writes exchanges in the rpc-compat test format.
+func TestRPCRecorder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !bytes.Contains(body, []byte(`"eth_chainId"`)) {
+			t.Errorf("unexpected request: %s", body)
+		}
+		w.Header().Set("content-type", "application/json")
+		io.WriteString(w, "{\n  \"jsonrpc\": \"2.0\",\n  \"id\": 1,\n  \"result\": \"0x539\"\n}\n")
+	}))
+	defer srv.Close()
+
+	var out bytes.Buffer
+	httpClient := &http.Client{Transport: NewRPCRecorder(&out, nil)}
+	client, err := rpc.DialHTTPWithClient(srv.URL, httpClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result string
+	if err := client.Call(&result, "eth_chainId"); err != nil {
+		t.Fatal("call failed:", err)
+	}
+	if result != "0x539" {
+		t.Fatalf("wrong result %q", result)
+	}
+
+	want := `>> {"jsonrpc":"2.0","id":1,"method":"eth_chainId"}` + "\n" +
+		`<< {"jsonrpc":"2.0","id":1,"result":"0x539"}` + "\n"
+	if out.String() != want {
+		t.Fatalf("wrong recording:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestRecordingFileName(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{"eth_getBlockByNumber/get-genesis (go-ethereum)", "eth_getBlockByNumber_get-genesis__go-ethereum_.io"},
+		{"simple.test", "simple.test.io"},
+		{"", "test.io"},
+	}
+	for _, test := range tests {
+		if got := recordingFileName(test.name); got != test.want {
+			t.Errorf("recordingFileName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -1,12 +1,19 @@
 package hivesim
 
 import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"net"
 	"os"
+	"regexp"
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/rpc"
 )
@@ -170,18 +177,122 @@ func (c *Client) Exec(command ...string) (*ExecInfo, error) {
 	return c.test.Sim.ClientExec(c.test.SuiteID, c.test.TestID, c.Container, command)
 }
 
+// ExecStream starts a script in the client container. Unlike Exec, it returns
+// immediately and provides access to the output of the script while it is running.
+// Cancelling the context terminates the script. This requires /bin/sh in the client
+// container.
+//
+// The standard input of the script is closed. Use ExecStreamInput for scripts
+// which read input.
+func (c *Client) ExecStream(ctx context.Context, command ...string) (*ExecStream, error) {
+	return c.test.Sim.ClientExecStream(ctx, c.test.SuiteID, c.test.TestID, c.Container, command, false)
+}
+
+// ExecStreamInput is like ExecStream, but keeps the standard input of the script
+// open. Input is written to the returned stream. Scripts which read until the end of
+// their input only exit after ExecStream.CloseStdin is called.
+func (c *Client) ExecStreamInput(ctx context.Context, command ...string) (*ExecStream, error) {
+	return c.test.Sim.ClientExecStream(ctx, c.test.SuiteID, c.test.TestID, c.Container, command, true)
+}
+
+// ShiftClock moves the fake clock of the client by d.
+// This only works if the client was started with WithClockOffset or WithClockRate.
+func (c *Client) ShiftClock(d time.Duration) error {
+	_, err := c.test.Sim.UpdateClientClock(c.test.SuiteID, c.test.TestID, c.Container, d, 0)
+	return err
+}
+
+// SetClockRate changes the speed of the fake clock of the client.
+// This only works if the client was started with WithClockOffset or WithClockRate.
+func (c *Client) SetClockRate(rate float64) error {
+	_, err := c.test.Sim.UpdateClientClock(c.test.SuiteID, c.test.TestID, c.Container, 0, rate)
+	return err
+}
+
+// Logs returns the log output of the client. The returned reader follows the log, i.e.
+// it delivers new output until the client exits or the context is cancelled.
+// The caller must close the reader.
+func (c *Client) Logs(ctx context.Context) (io.ReadCloser, error) {
+	opts := ClientLogOptions{Follow: true}
+	return c.test.Sim.ClientLogs(ctx, c.test.SuiteID, c.test.TestID, c.Container, opts)
+}
+
+// WaitForLog waits for a line matching the given regular expression to appear in the
+// client log, and returns the line. An error is returned if the client exits or the
+// context is cancelled before a matching line is found.
+func (c *Client) WaitForLog(ctx context.Context, re *regexp.Regexp) (string, error) {
+	logs, err := c.Logs(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer logs.Close()
+
+	scanner := bufio.NewScanner(logs)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := scanner.Text(); re.MatchString(line) {
+			return line, nil
+		}
+	}
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("client exited before log line matching %q appeared", re)
+}
+
+// CopyFiles returns a tar archive of a file or directory in the client container.
+// The path must be absolute. The caller must close the returned reader.
+func (c *Client) CopyFiles(path string) (io.ReadCloser, error) {
+	return c.test.Sim.ClientFiles(c.test.SuiteID, c.test.TestID, c.Container, path)
+}
+
+// ReadFile returns the content of a file in the client container.
+func (c *Client) ReadFile(path string) ([]byte, error) {
+	archive, err := c.CopyFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	tr := tar.NewReader(archive)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("file %s not found in archive", path)
+		} else if err != nil {
+			return nil, err
+		}
+		switch header.Typeflag {
+		case tar.TypeReg:
+			return io.ReadAll(tr)
+		case tar.TypeDir:
+			return nil, fmt.Errorf("%s is a directory", path)
+		case tar.TypeSymlink:
+			return nil, fmt.Errorf("%s is a symbolic link to %s", path, header.Linkname)
+		}
+	}
+}
+
 // T is a running test. This is a lot like testing.T, but has some additional methods for
 // launching clients.
 //
 // All test log output (via t.Log, t.Logf) goes to the 'details' section of the test report.
+// It is also written to the simulation log, with each line tagged with the test ID.
 type T struct {
 	// Test case info.
 	Sim     *Simulation
 	TestID  TestID
 	SuiteID SuiteID
 	suite   *Suite
+	name    string
 	mu      sync.Mutex
 	result  TestResult
+
+	cleanups []func()
+	outputs  []*testOutput
 }
 
 // StartClient starts a client instance. If the client cannot by started, the test fails immediately.
@@ -193,6 +304,46 @@ func (t *T) StartClient(clientType string, option ...StartOption) *Client {
 	return &Client{Type: clientType, Container: container, IP: ip, test: t}
 }
 
+// ClientCrashes returns a channel that receives a value for each client of the test that
+// exits unexpectedly. Hive fails the test when a client crashes, so this is only needed
+// to react to crashes while the test is running, e.g. to stop waiting for the client.
+func (t *T) ClientCrashes(ctx context.Context) (<-chan *ClientCrash, error) {
+	return t.Sim.ClientCrashes(ctx, t.SuiteID, t.TestID)
+}
+
+// AttachArtifact stores a file in the hive results directory. The file is listed in the
+// test report under the given name. Use this for data which helps with debugging a test,
+// such as configuration files or traces.
+func (t *T) AttachArtifact(name string, content io.Reader) error {
+	return t.Sim.AttachArtifact(t.SuiteID, t.TestID, name, content)
+}
+
+// Cleanup registers a function to be called when the test function has returned.
+// Cleanup functions are called in last added, first called order, before the
+// test result is reported.
+func (t *T) Cleanup(fn func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cleanups = append(t.cleanups, fn)
+}
+
+// runCleanups calls all registered cleanup functions.
+// A cleanup function failing the test doesn't prevent the others from running.
+func (t *T) runCleanups() {
+	for {
+		t.mu.Lock()
+		n := len(t.cleanups)
+		if n == 0 {
+			t.mu.Unlock()
+			return
+		}
+		fn := t.cleanups[n-1]
+		t.cleanups = t.cleanups[:n-1]
+		t.mu.Unlock()
+		runProtected(t, fn)
+	}
+}
+
 // RunClient runs the given client test against a single client type.
 // It waits for the subtest to complete.
 func (t *T) RunClient(clientType string, spec ClientTestSpec) {
@@ -247,22 +398,92 @@ func (t *T) Fatalf(format string, values ...interface{}) {
 }
 
 // Logf prints to standard output, which goes to the simulation log file.
+// Lines in the simulation log are tagged with the test ID.
 func (t *T) Logf(format string, values ...interface{}) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	if !strings.HasSuffix(format, "\n") {
 		format = format + "\n"
 	}
-	fmt.Printf(format, values...)
-	t.result.Details += fmt.Sprintf(format, values...)
+	text := fmt.Sprintf(format, values...)
+	printTestLog(t.TestID, text)
+	t.result.Details += text
 }
 
 // Log prints to standard output, which goes to the simulation log file.
+// Lines in the simulation log are tagged with the test ID.
 func (t *T) Log(values ...interface{}) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
-	fmt.Println(values...)
-	t.result.Details += fmt.Sprintln(values...)
+	text := fmt.Sprintln(values...)
+	printTestLog(t.TestID, text)
+	t.result.Details += text
+}
+
+// Output returns a writer for simulator output related to the test, e.g. for use as
+// the output of a logger. Like t.Log output, lines written to it are tagged with the
+// test ID in the simulation log. Unlike t.Log, they don't go into the test details.
+// An incomplete last line is written when the test ends.
+func (t *T) Output() io.Writer {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	w := &testOutput{test: t.TestID}
+	t.outputs = append(t.outputs, w)
+	return w
+}
+
+// testEndMarker is printed after all output of a test. hiveview uses it to find the
+// end of the test's output in the simulation log.
+const testEndMarker = "--- end of test output"
+
+// endOutput writes the remaining test output and the end marker.
+// This must be called with t.mu held.
+func (t *T) endOutput() {
+	for _, w := range t.outputs {
+		w.flush()
+	}
+	printTestLog(t.TestID, testEndMarker)
+}
+
+// testOutput is the writer returned by T.Output.
+type testOutput struct {
+	test TestID
+	mu   sync.Mutex
+	buf  []byte // holds current incomplete line
+}
+
+func (w *testOutput) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, b...)
+	if end := bytes.LastIndexByte(w.buf, '\n'); end >= 0 {
+		printTestLog(w.test, string(w.buf[:end+1]))
+		w.buf = append(w.buf[:0], w.buf[end+1:]...)
+	}
+	return len(b), nil
+}
+
+// flush writes the incomplete last line.
+func (w *testOutput) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) > 0 {
+		printTestLog(w.test, string(w.buf))
+		w.buf = w.buf[:0]
+	}
+}
+
+// printTestLog writes text to standard output, prefixing each line with the test tag.
+// This allows hive to show the simulator output of individual tests.
+func printTestLog(test TestID, text string) {
+	tag := fmt.Sprintf("[test %d] ", test)
+	var out strings.Builder
+	for _, line := range strings.SplitAfter(strings.TrimSuffix(text, "\n"), "\n") {
+		out.WriteString(tag)
+		out.WriteString(line)
+	}
+	out.WriteString("\n")
+	os.Stdout.WriteString(out.String())
 }
 
 // Failed reports whether the test has already failed.
@@ -305,6 +526,7 @@ func runTest(host *Simulation, test testSpec, runit func(t *T)) error {
 		Sim:     host,
 		SuiteID: test.suiteID,
 		suite:   test.suite,
+		name:    test.name,
 	}
 	testID, err := host.StartTest(test.suiteID, test.name, test.desc)
 	if err != nil {
@@ -315,10 +537,19 @@ func runTest(host *Simulation, test testSpec, runit func(t *T)) error {
 	defer func() {
 		t.mu.Lock()
 		defer t.mu.Unlock()
+		t.endOutput()
 		host.EndTest(test.suiteID, testID, t.result)
 	}()
 
 	// Run the test function.
+	runProtected(t, func() { runit(t) })
+	t.runCleanups()
+	return nil
+}
+
+// runProtected runs fn on a new goroutine, capturing panics as test failures.
+// This also handles FailNow, which exits the goroutine.
+func runProtected(t *T, fn func()) {
 	done := make(chan struct{})
 	go func() {
 		defer func() {
@@ -330,10 +561,9 @@ func runTest(host *Simulation, test testSpec, runit func(t *T)) error {
 			}
 			close(done)
 		}()
-		runit(t)
+		fn()
 	}()
 	<-done
-	return nil
 }
 
 func (spec ClientTestSpec) runTest(host *Simulation, suiteID SuiteID, suite *Suite) error {
@@ -1,6 +1,8 @@
 package hivesim
 
 import (
+	"io"
+	"os"
 	"reflect"
 	"sort"
 	"testing"
@@ -74,13 +76,14 @@ func TestSuiteReporting(t *testing.T) {
 	}
 }
 
-// removeTimestamps removes test timestamps in results so they can be
-// compared using reflect.DeepEqual.
+// removeTimestamps removes test timestamps and event timelines in results
+// so they can be compared using reflect.DeepEqual.
 func removeTimestamps(result map[libhive.TestSuiteID]*libhive.TestSuite) {
 	for _, suite := range result {
 		for _, test := range suite.TestCases {
 			test.Start = time.Time{}
 			test.End = time.Time{}
+			test.Events = nil
 		}
 	}
 }
@@ -152,3 +155,70 @@ func TestSkipping(t *testing.T) {
 		}
 	}
 }
+
+// This test checks that cleanup functions run after the test function, even when
+// the test is aborted using FailNow.
+func TestCleanup(t *testing.T) {
+	var calls []string
+	suite := Suite{Name: "suite"}
+	suite.Add(TestSpec{
+		Name: "test",
+		Run: func(t *T) {
+			t.Cleanup(func() { calls = append(calls, "first") })
+			t.Cleanup(func() {
+				calls = append(calls, "second")
+				if !t.Failed() {
+					panic("test should have failed")
+				}
+				t.Log("message from cleanup")
+				t.FailNow()
+			})
+			t.Fatal("message from the test")
+		},
+	})
+
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+	if err := RunSuite(NewAt(srv.URL), suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+	tm.Terminate()
+
+	if want := []string{"second", "first"}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("wrong cleanup calls %v, want %v", calls, want)
+	}
+	result := tm.Results()[0].TestCases[1].SummaryResult
+	if want := "message from the test\nmessage from cleanup\n"; result.Details != want {
+		t.Fatalf("wrong test details %q", result.Details)
+	}
+}
+
+// This test checks that test output is tagged with the test ID.
+func TestLogTagging(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	test := &T{TestID: 3}
+	test.Logf("line 1\nline 2")
+	out := test.Output()
+	io.WriteString(out, "partial ")
+	io.WriteString(out, "line\nrest")
+	test.mu.Lock()
+	test.endOutput()
+	test.mu.Unlock()
+	w.Close()
+	output, _ := io.ReadAll(r)
+
+	want := "[test 3] line 1\n[test 3] line 2\n[test 3] partial line\n[test 3] rest\n[test 3] --- end of test output\n"
+	if string(output) != want {
+		t.Errorf("wrong output %q", output)
+	}
+	if test.result.Details != "line 1\nline 2\n" {
+		t.Errorf("wrong details %q", test.result.Details)
+	}
+}
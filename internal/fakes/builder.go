@@ -2,7 +2,10 @@ package fakes
 
 import (
 	"context"
+	"crypto/sha256"
+	"fmt"
 	"io/fs"
+	"strings"
 
 	"github.com/ethereum/hive/internal/libhive"
 )
@@ -13,6 +16,7 @@ type BuilderHooks struct {
 	BuildSimulatorImage func(context.Context, string) (string, error)
 	ReadFile            func(ctx context.Context, image string, file string) ([]byte, error)
 	ReadClientMetadata  func(name string) (*libhive.ClientMetadata, error)
+	InspectImage        func(ctx context.Context, image string) (*libhive.ImageInfo, error)
 }
 
 // fakeBuilder implements Backend without docker.
@@ -61,3 +65,14 @@ func (b *fakeBuilder) ReadFile(ctx context.Context, image, file string) ([]byte,
 	}
 	return []byte{}, nil
 }
+
+func (b *fakeBuilder) InspectImage(ctx context.Context, image string) (*libhive.ImageInfo, error) {
+	if b.hooks.InspectImage != nil {
+		return b.hooks.InspectImage(ctx, image)
+	}
+	if strings.HasPrefix(image, "sha256:") {
+		return &libhive.ImageInfo{ID: image}, nil
+	}
+	h := sha256.Sum256([]byte(image))
+	return &libhive.ImageInfo{ID: fmt.Sprintf("sha256:%x", h)}, nil
+}
@@ -1,15 +1,18 @@
 package fakes
 
 import (
+	"archive/tar"
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"sync"
 	"sync/atomic"
 
 	"github.com/ethereum/hive/internal/libhive"
+	"github.com/ethereum/hive/internal/simapi"
 )
 
 // BackendHooks can be used to override the behavior of the fake backend.
@@ -17,14 +20,22 @@ type BackendHooks struct {
 	CreateContainer func(image string, opt libhive.ContainerOptions) (string, error)
 	StartContainer  func(image, containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error)
 	DeleteContainer func(containerID string) error
+	InspectExit     func(containerID string) (*libhive.ExitInfo, error)
 	RunProgram      func(containerID string, cmd []string) (*libhive.ExecInfo, error)
 
+	RunProgramStream  func(containerID string, cmd []string, streams libhive.ExecStreams) (int, error)
+	SetFakeClock      func(containerID, spec string) error
+	CopyFromContainer func(containerID, path string, w io.Writer) error
+
 	NetworkNameToID     func(string) (string, error)
-	CreateNetwork       func(string) (string, error)
+	CreateNetwork       func(name string, opt simapi.NetworkOptions, labels map[string]string) (string, error)
 	RemoveNetwork       func(networkID string) error
 	ContainerIP         func(containerID, networkID string) (net.IP, error)
-	ConnectContainer    func(containerID, networkID string) error
+	ContainerIPv6       func(containerID, networkID string) (net.IP, error)
+	ConnectContainer    func(containerID, networkID string, aliases []string) error
 	DisconnectContainer func(containerID, networkID string) error
+
+	ListResources func(labels map[string]string) ([]libhive.Resource, error)
 }
 
 var _ = libhive.ContainerBackend(&fakeBackend{})
@@ -35,8 +46,9 @@ type fakeBackend struct {
 	clientCounter uint64
 	netCounter    uint64
 
-	mutex sync.Mutex
-	cimg  map[string]string // tracks created containers and their image names
+	mutex   sync.Mutex
+	cimg    map[string]string        // tracks created containers and their image names
+	running map[string]chan struct{} // tracks started containers, closed on delete
 }
 
 type apiServer struct {
@@ -54,7 +66,7 @@ func (s apiServer) Addr() net.Addr {
 
 // NewBackend creates a new fake container backend.
 func NewContainerBackend(hooks *BackendHooks) libhive.ContainerBackend {
-	b := &fakeBackend{cimg: make(map[string]string)}
+	b := &fakeBackend{cimg: make(map[string]string), running: make(map[string]chan struct{})}
 	if hooks != nil {
 		b.hooks = *hooks
 	}
@@ -115,10 +127,6 @@ func (b *fakeBackend) StartContainer(ctx context.Context, containerID string, op
 			return nil, err
 		}
 		info = *info2
-		info.ID = containerID
-		if info.Wait == nil {
-			info.Wait = func() {}
-		}
 	}
 
 	info.ID = containerID
@@ -129,7 +137,14 @@ func (b *fakeBackend) StartContainer(ctx context.Context, containerID string, op
 	if info.MAC == "" {
 		info.MAC = "00:80:41:ae:fd:7e"
 	}
-	info.Wait = func() {}
+	if info.Wait == nil {
+		// The default container runs until it is deleted.
+		exit := make(chan struct{})
+		b.mutex.Lock()
+		b.running[containerID] = exit
+		b.mutex.Unlock()
+		info.Wait = func() { <-exit }
+	}
 	return &info, nil
 }
 
@@ -141,10 +156,21 @@ func (b *fakeBackend) DeleteContainer(containerID string) error {
 
 	b.mutex.Lock()
 	delete(b.cimg, containerID)
+	if exit, ok := b.running[containerID]; ok {
+		close(exit)
+		delete(b.running, containerID)
+	}
 	b.mutex.Unlock()
 	return err
 }
 
+func (b *fakeBackend) InspectExit(containerID string) (*libhive.ExitInfo, error) {
+	if b.hooks.InspectExit != nil {
+		return b.hooks.InspectExit(containerID)
+	}
+	return &libhive.ExitInfo{ExitCode: 1}, nil
+}
+
 func (b *fakeBackend) RunProgram(ctx context.Context, containerID string, cmd []string) (*libhive.ExecInfo, error) {
 	if b.hooks.RunProgram != nil {
 		return b.hooks.RunProgram(containerID, cmd)
@@ -152,6 +178,34 @@ func (b *fakeBackend) RunProgram(ctx context.Context, containerID string, cmd []
 	return &libhive.ExecInfo{Stdout: "std output", Stderr: "std err", ExitCode: 0}, nil
 }
 
+func (b *fakeBackend) RunProgramStream(ctx context.Context, containerID string, cmd []string, streams libhive.ExecStreams) (int, error) {
+	if b.hooks.RunProgramStream != nil {
+		return b.hooks.RunProgramStream(containerID, cmd, streams)
+	}
+	// Behave like cat: copy input to output.
+	if streams.Stdin != nil {
+		if _, err := io.Copy(streams.Stdout, streams.Stdin); err != nil {
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (b *fakeBackend) SetFakeClock(ctx context.Context, containerID, spec string) error {
+	if b.hooks.SetFakeClock != nil {
+		return b.hooks.SetFakeClock(containerID, spec)
+	}
+	return nil
+}
+
+func (b *fakeBackend) CopyFromContainer(ctx context.Context, containerID, path string, w io.Writer) error {
+	if b.hooks.CopyFromContainer != nil {
+		return b.hooks.CopyFromContainer(containerID, path, w)
+	}
+	// Respond with an empty archive.
+	return tar.NewWriter(w).Close()
+}
+
 func (b *fakeBackend) NetworkNameToID(name string) (string, error) {
 	if b.hooks.NetworkNameToID != nil {
 		return b.hooks.NetworkNameToID(name)
@@ -159,9 +213,9 @@ func (b *fakeBackend) NetworkNameToID(name string) (string, error) {
 	return "", errors.New("network not found")
 }
 
-func (b *fakeBackend) CreateNetwork(name string) (string, error) {
+func (b *fakeBackend) CreateNetwork(name string, opt simapi.NetworkOptions, labels map[string]string) (string, error) {
 	if b.hooks.CreateNetwork != nil {
-		return b.hooks.CreateNetwork(name)
+		return b.hooks.CreateNetwork(name, opt, labels)
 	}
 	id := fmt.Sprintf("%0.8x", atomic.AddUint64(&b.netCounter, 1))
 	return id, nil
@@ -181,9 +235,16 @@ func (b *fakeBackend) ContainerIP(containerID, networkID string) (net.IP, error)
 	return net.IP{203, 0, 113, 2}, nil
 }
 
-func (b *fakeBackend) ConnectContainer(containerID, networkID string) error {
+func (b *fakeBackend) ContainerIPv6(containerID, networkID string) (net.IP, error) {
+	if b.hooks.ContainerIPv6 != nil {
+		return b.hooks.ContainerIPv6(containerID, networkID)
+	}
+	return net.ParseIP("2001:db8::2"), nil
+}
+
+func (b *fakeBackend) ConnectContainer(containerID, networkID string, aliases ...string) error {
 	if b.hooks.ConnectContainer != nil {
-		return b.hooks.ConnectContainer(containerID, networkID)
+		return b.hooks.ConnectContainer(containerID, networkID, aliases)
 	}
 	return nil
 }
@@ -194,3 +255,10 @@ func (b *fakeBackend) DisconnectContainer(containerID, networkID string) error {
 	}
 	return nil
 }
+
+func (b *fakeBackend) ListResources(labels map[string]string) ([]libhive.Resource, error) {
+	if b.hooks.ListResources != nil {
+		return b.hooks.ListResources(labels)
+	}
+	return nil, nil
+}
@@ -11,6 +11,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/ethereum/hive/internal/libhive"
 	docker "github.com/fsouza/go-dockerclient"
@@ -245,9 +246,21 @@ func (b *Builder) buildImage(ctx context.Context, contextDir, dockerFile, branch
 	}
 
 	logger.Info("building image", logctx...)
+	start := time.Now()
 	if err := b.client.BuildImage(opts); err != nil {
+		libhive.MetricImageBuildDuration.WithLabelValues(imageTag, "error").Observe(time.Since(start).Seconds())
 		logger.Error("image build failed", "err", err)
 		return err
 	}
+	libhive.MetricImageBuildDuration.WithLabelValues(imageTag, "ok").Observe(time.Since(start).Seconds())
 	return nil
 }
+
+// InspectImage returns the ID and registry digests of an image.
+func (b *Builder) InspectImage(ctx context.Context, image string) (*libhive.ImageInfo, error) {
+	img, err := b.client.InspectImage(image)
+	if err != nil {
+		return nil, err
+	}
+	return &libhive.ImageInfo{ID: img.ID, RepoDigests: img.RepoDigests}, nil
+}
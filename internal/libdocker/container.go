@@ -11,11 +11,14 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/hive/hiveproxy"
 	"github.com/ethereum/hive/internal/libhive"
+	"github.com/ethereum/hive/internal/simapi"
 	docker "github.com/fsouza/go-dockerclient"
 	"gopkg.in/inconshreveable/log15.v2"
 )
@@ -24,12 +27,17 @@ type ContainerBackend struct {
 	client *docker.Client
 	config *Config
 	logger log15.Logger
+	runID  string
+	owner  map[string]string // labels identifying the hive process
 
 	proxy *hiveproxy.Proxy
+
+	// fakeclock is the hive-clock program for running containers with a fake clock.
+	fakeclock []byte
 }
 
 func NewContainerBackend(c *docker.Client, cfg *Config) *ContainerBackend {
-	b := &ContainerBackend{client: c, config: cfg, logger: cfg.Logger}
+	b := &ContainerBackend{client: c, config: cfg, logger: cfg.Logger, runID: newRunID(), owner: ownerLabels()}
 	if b.logger == nil {
 		b.logger = log15.Root()
 	}
@@ -72,6 +80,77 @@ func (b *ContainerBackend) RunProgram(ctx context.Context, containerID string, c
 	}, nil
 }
 
+// RunProgramStream runs a /hive-bin script in a container, streaming its input and output.
+// The command is started through /bin/sh, so the container image must contain a shell.
+func (b *ContainerBackend) RunProgramStream(ctx context.Context, containerID string, cmd []string, streams libhive.ExecStreams) (int, error) {
+	// Docker has no API for stopping an exec instance. To make the command cancellable,
+	// it is launched through a shell which records the process ID into a file.
+	pidFile := fmt.Sprintf("/tmp/hive-exec-%d.pid", atomic.AddUint64(&execCounter, 1))
+	wrapper := []string{"/bin/sh", "-c", `echo $$ > ` + pidFile + ` && exec "$@"`, "sh"}
+	exec, err := b.client.CreateExec(docker.CreateExecOptions{
+		Context:      ctx,
+		AttachStdin:  streams.Stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+		Tty:          false,
+		Cmd:          append(wrapper, cmd...),
+		Container:    containerID,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("can't create exec %v: %v", cmd, err)
+	}
+	defer b.runCleanupCommand(containerID, []string{"rm", "-f", pidFile})
+
+	stdout, stderr := streams.Stdout, streams.Stderr
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+	err = b.client.StartExec(exec.ID, docker.StartExecOptions{
+		Context:      ctx,
+		Detach:       false,
+		InputStream:  streams.Stdin,
+		OutputStream: stdout,
+		ErrorStream:  stderr,
+	})
+	if ctx.Err() != nil {
+		b.logger.Debug("terminating exec", "container", containerID[:8], "cmd", cmd)
+		b.runCleanupCommand(containerID, []string{"/bin/sh", "-c", "kill $(cat " + pidFile + ")"})
+		return 0, ctx.Err()
+	}
+	if err != nil {
+		return 0, fmt.Errorf("can't run exec %v: %v", cmd, err)
+	}
+	insp, err := b.client.InspectExec(exec.ID)
+	if err != nil {
+		return 0, fmt.Errorf("can't check execution result of %v: %v", cmd, err)
+	}
+	return insp.ExitCode, nil
+}
+
+// execCounter is used to create unique file names for RunProgramStream.
+var execCounter uint64
+
+// runCleanupCommand runs a helper command in the container, ignoring its output.
+func (b *ContainerBackend) runCleanupCommand(containerID string, cmd []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := b.RunProgram(ctx, containerID, cmd); err != nil {
+		b.logger.Debug("exec cleanup failed", "container", containerID[:8], "cmd", cmd, "err", err)
+	}
+}
+
+// CopyFromContainer writes a tar archive of a file or directory in the container to w.
+func (b *ContainerBackend) CopyFromContainer(ctx context.Context, containerID, path string, w io.Writer) error {
+	return b.client.DownloadFromContainer(containerID, docker.DownloadFromContainerOptions{
+		Context:      ctx,
+		Path:         path,
+		OutputStream: w,
+	})
+}
+
 // CreateContainer creates a docker container.
 func (b *ContainerBackend) CreateContainer(ctx context.Context, imageName string, opt libhive.ContainerOptions) (string, error) {
 	vars := []string{}
@@ -81,10 +160,15 @@ func (b *ContainerBackend) CreateContainer(ctx context.Context, imageName string
 	createOpts := docker.CreateContainerOptions{
 		Context: ctx,
 		Config: &docker.Config{
-			Image: imageName,
-			Env:   vars,
+			Image:    imageName,
+			Env:      vars,
+			Hostname: opt.Hostname,
+			Labels:   b.resourceLabels(opt.Labels),
 		},
 	}
+	if opt.MemoryLimit > 0 {
+		createOpts.HostConfig = &docker.HostConfig{Memory: opt.MemoryLimit}
+	}
 
 	if opt.Input != nil {
 		// Pre-announce that stdin will be attached. The stdin attachment
@@ -99,10 +183,17 @@ func (b *ContainerBackend) CreateContainer(ctx context.Context, imageName string
 		createOpts.Config.AttachStdout = true
 	}
 
+	if opt.FakeClock != "" {
+		if err := b.configureFakeClock(imageName, createOpts.Config); err != nil {
+			return "", err
+		}
+	}
+
 	c, err := b.client.CreateContainer(createOpts)
 	if err != nil {
 		return "", err
 	}
+	libhive.MetricContainersCreated.Inc()
 	logger := b.logger.New("image", imageName, "container", c.ID[:8])
 
 	// Now upload files.
@@ -111,14 +202,21 @@ func (b *ContainerBackend) CreateContainer(ctx context.Context, imageName string
 		b.DeleteContainer(c.ID)
 		return "", err
 	}
+	if opt.FakeClock != "" {
+		if err := b.uploadFakeClock(ctx, c.ID, opt.FakeClock); err != nil {
+			logger.Error("container fake clock setup failed", "err", err)
+			b.DeleteContainer(c.ID)
+			return "", err
+		}
+	}
 	logger.Debug("container created")
 	return c.ID, err
 }
 
 // StartContainer starts a docker container.
 func (b *ContainerBackend) StartContainer(ctx context.Context, containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
-	if opt.CheckLive != 0 && b.proxy == nil {
-		panic("attempt to start container with CheckLive, but proxy is not running")
+	if opt.Readiness != nil && b.proxy == nil {
+		panic("attempt to start container with readiness probe, but proxy is not running")
 	}
 
 	info := &libhive.ContainerInfo{ID: containerID[:8], LogFile: opt.LogFile}
@@ -135,9 +233,11 @@ func (b *ContainerBackend) StartContainer(ctx context.Context, containerID strin
 	// This goroutine waits for the container to end and closes log
 	// files when done.
 	containerExit := make(chan struct{})
+	libhive.MetricContainersRunning.Inc()
 	go func() {
 		defer close(containerExit)
 		err := waiter.Wait()
+		libhive.MetricContainersRunning.Dec()
 		logger.Debug("container exited", "err", err)
 		err = waiter.Close()
 		logger.Debug("container files closed", "err", err)
@@ -158,16 +258,23 @@ func (b *ContainerBackend) StartContainer(ctx context.Context, containerID strin
 	info.IP = container.NetworkSettings.IPAddress
 	info.MAC = container.NetworkSettings.MacAddress
 
-	// Set up the port check if requested.
+	// Set up the readiness check if requested.
 	hasStarted := make(chan struct{})
-	if opt.CheckLive != 0 {
+	if opt.Readiness != nil {
 		ctx, cancel := context.WithCancel(ctx)
 		defer cancel()
-		addr := &net.TCPAddr{IP: net.ParseIP(info.IP), Port: int(opt.CheckLive)}
+		probe := hiveproxy.Probe{
+			Type:   opt.Readiness.Type,
+			Addr:   net.JoinHostPort(info.IP, strconv.Itoa(int(opt.Readiness.Port))),
+			Path:   opt.Readiness.Path,
+			Method: opt.Readiness.Method,
+		}
 		go func() {
-			err := b.proxy.CheckLive(ctx, addr)
+			err := b.proxy.Probe(ctx, probe)
 			if err == nil {
 				close(hasStarted)
+			} else if ctx.Err() == nil {
+				logger.Error("readiness probe failed", "type", probe.Type, "err", err)
 			}
 		}()
 	} else {
@@ -202,13 +309,41 @@ func (b *ContainerBackend) DeleteContainer(containerID string) error {
 	return err
 }
 
+// InspectExit returns the exit status of a container that has stopped.
+func (b *ContainerBackend) InspectExit(containerID string) (*libhive.ExitInfo, error) {
+	c, err := b.client.InspectContainerWithOptions(docker.InspectContainerOptions{ID: containerID})
+	if err != nil {
+		return nil, err
+	}
+	return &libhive.ExitInfo{ExitCode: c.State.ExitCode, OOMKilled: c.State.OOMKilled}, nil
+}
+
 // CreateNetwork creates a docker network.
-func (b *ContainerBackend) CreateNetwork(name string) (string, error) {
-	network, err := b.client.CreateNetwork(docker.CreateNetworkOptions{
+func (b *ContainerBackend) CreateNetwork(name string, opt simapi.NetworkOptions, labels map[string]string) (string, error) {
+	createOpts := docker.CreateNetworkOptions{
 		Name:           name,
 		CheckDuplicate: true,
 		Attachable:     true,
-	})
+		Labels:         b.resourceLabels(labels),
+		Internal:       opt.Internal,
+		EnableIPv6:     opt.IPv6,
+	}
+	var ipam []docker.IPAMConfig
+	if opt.Subnet != "" {
+		ipam = append(ipam, docker.IPAMConfig{Subnet: opt.Subnet, Gateway: opt.Gateway})
+	}
+	if opt.IPv6Subnet != "" {
+		ipam = append(ipam, docker.IPAMConfig{Subnet: opt.IPv6Subnet})
+	}
+	if len(ipam) > 0 {
+		createOpts.IPAM = &docker.IPAMOptions{Driver: "default", Config: ipam}
+	}
+	if opt.MTU != 0 {
+		createOpts.Options = map[string]interface{}{
+			"com.docker.network.driver.mtu": strconv.Itoa(opt.MTU),
+		}
+	}
+	network, err := b.client.CreateNetwork(createOpts)
 	if err != nil {
 		return "", err
 	}
@@ -246,6 +381,26 @@ func (b *ContainerBackend) RemoveNetwork(id string) error {
 
 // ContainerIP finds the IP of a container in the given network.
 func (b *ContainerBackend) ContainerIP(containerID, networkID string) (net.IP, error) {
+	network, err := b.containerNetwork(containerID, networkID)
+	if err != nil {
+		return nil, err
+	}
+	return net.ParseIP(network.IPAddress), nil
+}
+
+// ContainerIPv6 finds the global IPv6 address of a container in the given network.
+func (b *ContainerBackend) ContainerIPv6(containerID, networkID string) (net.IP, error) {
+	network, err := b.containerNetwork(containerID, networkID)
+	if err != nil {
+		return nil, err
+	}
+	if network.GlobalIPv6Address == "" {
+		return nil, fmt.Errorf("container has no IPv6 address in network")
+	}
+	return net.ParseIP(network.GlobalIPv6Address), nil
+}
+
+func (b *ContainerBackend) containerNetwork(containerID, networkID string) (*docker.ContainerNetwork, error) {
 	details, err := b.client.InspectContainerWithOptions(docker.InspectContainerOptions{
 		ID: containerID,
 	})
@@ -255,17 +410,21 @@ func (b *ContainerBackend) ContainerIP(containerID, networkID string) (net.IP, e
 	// Range over all networks to which the container is connected and get network-specific IP.
 	for _, network := range details.NetworkSettings.Networks {
 		if network.NetworkID == networkID {
-			return net.ParseIP(network.IPAddress), nil
+			network := network
+			return &network, nil
 		}
 	}
 	return nil, fmt.Errorf("network not found")
 }
 
 // ConnectContainer connects the given container to a network.
-func (b *ContainerBackend) ConnectContainer(containerID, networkID string) error {
-	return b.client.ConnectNetwork(networkID, docker.NetworkConnectionOptions{
-		Container: containerID,
-	})
+// The aliases are registered as DNS names of the container in the network.
+func (b *ContainerBackend) ConnectContainer(containerID, networkID string, aliases ...string) error {
+	opts := docker.NetworkConnectionOptions{Container: containerID}
+	if len(aliases) > 0 {
+		opts.EndpointConfig = &docker.EndpointConfig{Aliases: aliases}
+	}
+	return b.client.ConnectNetwork(networkID, opts)
 }
 
 // DisconnectContainer disconnects the given container from a network.
@@ -280,17 +439,7 @@ func (b *ContainerBackend) uploadFiles(ctx context.Context, id string, files map
 	if len(files) == 0 {
 		return nil
 	}
-
-	// Stream tar archive with all files.
-	var (
-		pipeR, pipeW = io.Pipe()
-		streamErrCh  = make(chan error, 1)
-	)
-	go func() (err error) {
-		defer func() { streamErrCh <- err }()
-		defer pipeW.Close()
-
-		tw := tar.NewWriter(pipeW)
+	return b.uploadTar(ctx, id, func(tw *tar.Writer) error {
 		for filePath, fileHeader := range files {
 			// Write file header.
 			header := &tar.Header{Name: filePath, Mode: 0777, Size: fileHeader.Size}
@@ -308,6 +457,25 @@ func (b *ContainerBackend) uploadFiles(ctx context.Context, id string, files map
 				return copyErr
 			}
 		}
+		return nil
+	})
+}
+
+// uploadTar streams a tar archive into the root directory of a container.
+// The archive content is created by the write function.
+func (b *ContainerBackend) uploadTar(ctx context.Context, id string, write func(*tar.Writer) error) error {
+	var (
+		pipeR, pipeW = io.Pipe()
+		streamErrCh  = make(chan error, 1)
+	)
+	go func() (err error) {
+		defer func() { streamErrCh <- err }()
+		defer pipeW.Close()
+
+		tw := tar.NewWriter(pipeW)
+		if err := write(tw); err != nil {
+			return err
+		}
 		return tw.Close()
 	}()
 
@@ -0,0 +1,92 @@
+package libdocker
+
+import (
+	"archive/tar"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/ethereum/hive/internal/libhive"
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// fakeclockSource is the build context of the hive-clock helper image.
+//
+//go:embed fakeclock
+var fakeclockSource embed.FS
+
+const (
+	fakeclockTag       = "hive/fakeclock"
+	fakeclockDir       = "/hive-fakeclock"
+	fakeclockProgram   = fakeclockDir + "/hive-clock"
+	fakeclockClockFile = fakeclockDir + "/clock"
+)
+
+// buildFakeClock builds the hive-clock helper image and loads the program
+// needed for running client containers with a fake clock.
+func (b *ContainerBackend) buildFakeClock(ctx context.Context, builder libhive.Builder) error {
+	src, err := fs.Sub(fakeclockSource, "fakeclock")
+	if err != nil {
+		return err
+	}
+	if err := builder.BuildImage(ctx, fakeclockTag, src); err != nil {
+		return err
+	}
+	program, err := builder.ReadFile(ctx, fakeclockTag, "/hive-clock")
+	if err != nil {
+		return fmt.Errorf("can't read hive-clock from %s: %v", fakeclockTag, err)
+	}
+	b.fakeclock = program
+	return nil
+}
+
+// configureFakeClock modifies the container config so the entry point of the image
+// runs under hive-clock. The clock is read from fakeclockClockFile.
+func (b *ContainerBackend) configureFakeClock(imageName string, config *docker.Config) error {
+	if b.fakeclock == nil {
+		return errors.New("fake clock is not available because the fakeclock image was not built")
+	}
+	img, err := b.client.InspectImage(imageName)
+	if err != nil {
+		return err
+	}
+	var cmdline []string
+	if img.Config != nil {
+		cmdline = append(cmdline, img.Config.Entrypoint...)
+		cmdline = append(cmdline, img.Config.Cmd...)
+	}
+	if len(cmdline) == 0 {
+		return fmt.Errorf("image %s has no entry point", imageName)
+	}
+	config.Entrypoint = []string{fakeclockProgram, fakeclockClockFile}
+	config.Cmd = cmdline
+	return nil
+}
+
+// uploadFakeClock adds hive-clock and the initial clock file to a container.
+func (b *ContainerBackend) uploadFakeClock(ctx context.Context, id string, spec string) error {
+	return b.uploadTar(ctx, id, func(tw *tar.Writer) error {
+		if err := writeTarFile(tw, fakeclockProgram, 0755, b.fakeclock); err != nil {
+			return err
+		}
+		return writeTarFile(tw, fakeclockClockFile, 0644, []byte(spec+"\n"))
+	})
+}
+
+// SetFakeClock changes the clock of a container which was created with a fake clock.
+func (b *ContainerBackend) SetFakeClock(ctx context.Context, containerID string, spec string) error {
+	return b.uploadTar(ctx, containerID, func(tw *tar.Writer) error {
+		return writeTarFile(tw, fakeclockClockFile, 0644, []byte(spec+"\n"))
+	})
+}
+
+func writeTarFile(tw *tar.Writer, name string, mode int64, data []byte) error {
+	header := &tar.Header{Name: name, Mode: mode, Size: int64(len(data))}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
@@ -0,0 +1,323 @@
+// hive-clock runs a program with a fake wall clock.
+//
+// Usage: hive-clock <clock file> <command> [args...]
+//
+// The clock file contains three numbers: a real time and the fake time corresponding
+// to it, both in nanoseconds since the Unix epoch, and the clock rate. The file is
+// re-read every 100ms while the program is reading the clock.
+//
+// The program is traced using ptrace. A seccomp filter stops the program on system
+// calls reading the wall clock, and hive-clock answers them with the fake time. Most
+// programs (including all Go programs) read the clock through the vDSO instead of
+// making a system call, so the vDSO is removed from the auxiliary vector of the
+// program when it starts. The C library and the Go runtime fall back to system calls
+// when the vDSO is not available.
+//
+// Only CLOCK_REALTIME is faked. Monotonic clocks, and thus timers and sleeps, run at
+// real speed. Faking the clock is implemented for x86-64 only.
+
+#define _GNU_SOURCE
+#include <elf.h>
+#include <errno.h>
+#include <linux/audit.h>
+#include <linux/filter.h>
+#include <linux/seccomp.h>
+#include <signal.h>
+#include <stddef.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <sys/prctl.h>
+#include <sys/ptrace.h>
+#include <sys/syscall.h>
+#include <sys/uio.h>
+#include <sys/user.h>
+#include <sys/wait.h>
+#include <time.h>
+#include <unistd.h>
+
+#if !defined(__x86_64__)
+
+int main(void) {
+    fprintf(stderr, "hive-clock: fake clock is not supported on this architecture\n");
+    return 127;
+}
+
+#else
+
+#define TRACE_ARCH AUDIT_ARCH_X86_64
+#define SYSCALL_NR(r) ((r).orig_rax)
+#define SYSCALL_ARG0(r) ((r).rdi)
+#define SYSCALL_ARG1(r) ((r).rsi)
+#define STACK_POINTER(r) ((r).rsp)
+
+static int get_regs(pid_t pid, struct user_regs_struct *regs) {
+    return ptrace(PTRACE_GETREGS, pid, 0, regs);
+}
+
+// skip_syscall makes the stopped system call return the given value
+// without running it.
+static int skip_syscall(pid_t pid, struct user_regs_struct *regs, long ret) {
+    regs->orig_rax = -1;
+    regs->rax = ret;
+    return ptrace(PTRACE_SETREGS, pid, 0, regs);
+}
+
+static const char *clock_file;
+static pid_t main_pid;
+
+// The clock setting.
+static struct {
+    int64_t real;
+    int64_t fake;
+    double rate;
+    int64_t checked;
+} clk = {.rate = 1};
+
+static void fatal(const char *msg) {
+    fprintf(stderr, "hive-clock: %s: %s\n", msg, strerror(errno));
+    exit(127);
+}
+
+static int64_t now(clockid_t id) {
+    struct timespec ts;
+    clock_gettime(id, &ts);
+    return (int64_t)ts.tv_sec * 1000000000 + ts.tv_nsec;
+}
+
+// load_clock reads the clock file. The file is read at most every 100ms.
+static void load_clock(void) {
+    int64_t mono = now(CLOCK_MONOTONIC);
+    if (clk.checked != 0 && mono - clk.checked < 100000000) {
+        return;
+    }
+    clk.checked = mono;
+
+    FILE *f = fopen(clock_file, "r");
+    if (f == NULL) {
+        return;
+    }
+    long long real, fake;
+    double rate;
+    char end;
+    // A partially written file is ignored, and read again on the next check.
+    if (fscanf(f, "%lld %lld %lf%c", &real, &fake, &rate, &end) == 4 && end == '\n' && rate >= 0) {
+        clk.real = real;
+        clk.fake = fake;
+        clk.rate = rate;
+    }
+    fclose(f);
+}
+
+static int64_t fake_now(void) {
+    load_clock();
+    int64_t real = now(CLOCK_REALTIME);
+    if (clk.real == 0) {
+        return real;
+    }
+    return clk.fake + (int64_t)((double)(real - clk.real) * clk.rate);
+}
+
+static int write_mem(pid_t pid, uint64_t addr, const void *data, size_t len) {
+    struct iovec local = {.iov_base = (void *)data, .iov_len = len};
+    struct iovec remote = {.iov_base = (void *)addr, .iov_len = len};
+    return process_vm_writev(pid, &local, 1, &remote, 1, 0) == (ssize_t)len ? 0 : -1;
+}
+
+static int read_mem(pid_t pid, uint64_t addr, void *data, size_t len) {
+    struct iovec local = {.iov_base = data, .iov_len = len};
+    struct iovec remote = {.iov_base = (void *)addr, .iov_len = len};
+    return process_vm_readv(pid, &local, 1, &remote, 1, 0) == (ssize_t)len ? 0 : -1;
+}
+
+// install_filter makes the process stop on system calls reading the wall clock.
+static void install_filter(void) {
+    struct sock_filter filter[] = {
+        BPF_STMT(BPF_LD | BPF_W | BPF_ABS, offsetof(struct seccomp_data, arch)),
+        BPF_JUMP(BPF_JMP | BPF_JEQ | BPF_K, TRACE_ARCH, 1, 0),
+        BPF_STMT(BPF_RET | BPF_K, SECCOMP_RET_ALLOW),
+        BPF_STMT(BPF_LD | BPF_W | BPF_ABS, offsetof(struct seccomp_data, nr)),
+        BPF_JUMP(BPF_JMP | BPF_JEQ | BPF_K, SYS_gettimeofday, 6, 0),
+        BPF_JUMP(BPF_JMP | BPF_JEQ | BPF_K, SYS_time, 5, 0),
+        BPF_JUMP(BPF_JMP | BPF_JEQ | BPF_K, SYS_clock_gettime, 0, 3),
+        BPF_STMT(BPF_LD | BPF_W | BPF_ABS, offsetof(struct seccomp_data, args[0])),
+        BPF_JUMP(BPF_JMP | BPF_JEQ | BPF_K, CLOCK_REALTIME, 2, 0),
+        BPF_JUMP(BPF_JMP | BPF_JEQ | BPF_K, CLOCK_REALTIME_COARSE, 1, 0),
+        BPF_STMT(BPF_RET | BPF_K, SECCOMP_RET_ALLOW),
+        BPF_STMT(BPF_RET | BPF_K, SECCOMP_RET_TRACE),
+    };
+    struct sock_fprog prog = {.len = sizeof(filter) / sizeof(filter[0]), .filter = filter};
+    if (prctl(PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0) != 0) {
+        fatal("can't set no_new_privs");
+    }
+    if (prctl(PR_SET_SECCOMP, SECCOMP_MODE_FILTER, &prog) != 0) {
+        fatal("can't install seccomp filter");
+    }
+}
+
+// hide_vdso removes the vDSO from the auxiliary vector of a process which has just
+// executed a new program. This forces the program to make system calls for reading
+// the clock.
+static void hide_vdso(pid_t pid) {
+    struct user_regs_struct regs;
+    if (get_regs(pid, &regs) != 0) {
+        return;
+    }
+    // The stack contains argc, argv, NULL, envp, NULL, then the auxiliary vector.
+    uint64_t p = STACK_POINTER(regs), argc, v;
+    if (read_mem(pid, p, &argc, 8) != 0) {
+        return;
+    }
+    p += 8 * (argc + 2);
+    do {
+        if (read_mem(pid, p, &v, 8) != 0) {
+            return;
+        }
+        p += 8;
+    } while (v != 0);
+    for (;; p += 16) {
+        uint64_t aux[2];
+        if (read_mem(pid, p, aux, sizeof(aux)) != 0 || aux[0] == AT_NULL) {
+            return;
+        }
+        if (aux[0] == AT_SYSINFO_EHDR) {
+            uint64_t ignore = AT_IGNORE;
+            write_mem(pid, p, &ignore, 8);
+        }
+    }
+}
+
+// fake_syscall answers a clock system call of a stopped process.
+static void fake_syscall(pid_t pid) {
+    struct user_regs_struct regs;
+    if (get_regs(pid, &regs) != 0) {
+        return;
+    }
+    int64_t t = fake_now();
+    int64_t sec = t / 1000000000, nsec = t % 1000000000;
+    if (nsec < 0) {
+        sec--;
+        nsec += 1000000000;
+    }
+    uint64_t addr = SYSCALL_ARG1(regs);
+    long ret = 0;
+    switch (SYSCALL_NR(regs)) {
+    case SYS_clock_gettime: {
+        struct timespec ts = {.tv_sec = sec, .tv_nsec = nsec};
+        if (write_mem(pid, addr, &ts, sizeof(ts)) != 0) {
+            ret = -EFAULT;
+        }
+        break;
+    }
+    case SYS_gettimeofday: {
+        struct timeval tv = {.tv_sec = sec, .tv_usec = nsec / 1000};
+        addr = SYSCALL_ARG0(regs);
+        if (addr != 0 && write_mem(pid, addr, &tv, sizeof(tv)) != 0) {
+            ret = -EFAULT;
+        }
+        break;
+    }
+    case SYS_time: {
+        addr = SYSCALL_ARG0(regs);
+        ret = sec;
+        if (addr != 0 && write_mem(pid, addr, &sec, sizeof(sec)) != 0) {
+            ret = -EFAULT;
+        }
+        break;
+    }
+    default:
+        return;
+    }
+    skip_syscall(pid, &regs, ret);
+}
+
+static void forward_signal(int sig) {
+    kill(main_pid, sig);
+}
+
+// trace runs the tracing loop until the main process exits.
+// It returns the exit status of the main process.
+static int trace(void) {
+    for (;;) {
+        int status;
+        pid_t pid = waitpid(-1, &status, __WALL);
+        if (pid < 0) {
+            if (errno == EINTR) {
+                continue;
+            }
+            fatal("wait failed");
+        }
+        if (WIFEXITED(status) || WIFSIGNALED(status)) {
+            if (pid == main_pid) {
+                return WIFEXITED(status) ? WEXITSTATUS(status) : 128 + WTERMSIG(status);
+            }
+            continue;
+        }
+        if (!WIFSTOPPED(status)) {
+            continue;
+        }
+        int sig = WSTOPSIG(status), event = status >> 16, inject = 0;
+        if (sig == SIGTRAP && event == PTRACE_EVENT_SECCOMP) {
+            fake_syscall(pid);
+        } else if (sig == SIGTRAP && event == PTRACE_EVENT_EXEC) {
+            hide_vdso(pid);
+        } else if (sig == SIGTRAP && event != 0) {
+            // Other ptrace events, i.e. new processes and threads.
+        } else if (sig == SIGSTOP) {
+            // New processes and threads start with SIGSTOP. This is also reported
+            // for group-stops, which are ignored here.
+            siginfo_t si;
+            if (ptrace(PTRACE_GETSIGINFO, pid, 0, &si) == 0 && si.si_code == SI_USER && si.si_pid != 0) {
+                inject = sig;
+            }
+        } else {
+            inject = sig;
+        }
+        ptrace(PTRACE_CONT, pid, 0, inject);
+    }
+}
+
+int main(int argc, char **argv) {
+    if (argc < 3) {
+        fprintf(stderr, "usage: hive-clock <clock file> <command> [args...]\n");
+        return 2;
+    }
+    clock_file = argv[1];
+
+    main_pid = fork();
+    if (main_pid < 0) {
+        fatal("fork failed");
+    }
+    if (main_pid == 0) {
+        if (ptrace(PTRACE_TRACEME, 0, 0, 0) != 0) {
+            fatal("can't trace the program");
+        }
+        raise(SIGSTOP);
+        install_filter();
+        execvp(argv[2], argv + 2);
+        fatal("exec failed");
+    }
+
+    // Wait for the child to stop, then set the trace options.
+    int status;
+    if (waitpid(main_pid, &status, 0) < 0 || !WIFSTOPPED(status)) {
+        fatal("program did not start");
+    }
+    long opts = PTRACE_O_EXITKILL | PTRACE_O_TRACESECCOMP | PTRACE_O_TRACEEXEC |
+                PTRACE_O_TRACECLONE | PTRACE_O_TRACEFORK | PTRACE_O_TRACEVFORK;
+    if (ptrace(PTRACE_SETOPTIONS, main_pid, 0, opts) != 0) {
+        fatal("can't set trace options");
+    }
+
+    // Signals sent to hive-clock, e.g. when the container is stopped,
+    // are forwarded to the program.
+    int sigs[] = {SIGTERM, SIGINT, SIGHUP, SIGQUIT, SIGUSR1, SIGUSR2};
+    for (size_t i = 0; i < sizeof(sigs) / sizeof(sigs[0]); i++) {
+        signal(sigs[i], forward_signal);
+    }
+    ptrace(PTRACE_CONT, main_pid, 0, 0);
+    return trace();
+}
+
+#endif
@@ -14,9 +14,12 @@ import (
 
 const hiveproxyTag = "hive/hiveproxy"
 
-// Build builds the hiveproxy image.
+// Build builds the hiveproxy and fakeclock images.
 func (cb *ContainerBackend) Build(ctx context.Context, b libhive.Builder) error {
-	return b.BuildImage(ctx, hiveproxyTag, hiveproxy.Source)
+	if err := b.BuildImage(ctx, hiveproxyTag, hiveproxy.Source); err != nil {
+		return err
+	}
+	return cb.buildFakeClock(ctx, b)
 }
 
 // ServeAPI starts the API server.
@@ -60,7 +63,7 @@ func (cb *ContainerBackend) ServeAPI(ctx context.Context, h http.Handler) (libhi
 		}
 	}
 
-	// Register proxy in ContainerBackend, so it can be used for CheckLive.
+	// Register proxy in ContainerBackend, so it can be used for readiness probes.
 	cb.proxy = proxy
 
 	srv := &proxyContainer{
@@ -73,7 +76,7 @@ func (cb *ContainerBackend) ServeAPI(ctx context.Context, h http.Handler) (libhi
 		proxy:           proxy,
 	}
 
-	// Register proxy in ContainerBackend, so it can be used for CheckLive.
+	// Register proxy in ContainerBackend, so it can be used for readiness probes.
 	cb.proxy = proxy
 	log15.Info("hiveproxy started", "container", id[:12], "addr", srv.Addr())
 	return srv, nil
@@ -0,0 +1,217 @@
+package libdocker
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/ethereum/hive/internal/libhive"
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// newRunID creates a random ID for the current hive run.
+func newRunID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RunID returns the ID of the current hive run. All containers and networks
+// created by the backend are labeled with this ID.
+func (b *ContainerBackend) RunID() string {
+	return b.runID
+}
+
+// ownerLabels returns the labels identifying the current hive process.
+func ownerLabels() map[string]string {
+	labels := map[string]string{libhive.LabelOwnerPID: strconv.Itoa(os.Getpid())}
+	if host, err := os.Hostname(); err == nil {
+		labels[libhive.LabelOwnerHost] = host
+	}
+	if start, ok := processStartTime(os.Getpid()); ok {
+		labels[libhive.LabelOwnerStart] = start
+	}
+	return labels
+}
+
+// resourceLabels returns the labels of a new container or network.
+func (b *ContainerBackend) resourceLabels(extra map[string]string) map[string]string {
+	labels := map[string]string{libhive.LabelRunID: b.runID}
+	for k, v := range b.owner {
+		labels[k] = v
+	}
+	for k, v := range extra {
+		labels[k] = v
+	}
+	return labels
+}
+
+// ListResources returns the containers and networks created by the current
+// hive run which have all of the given labels.
+func (b *ContainerBackend) ListResources(labels map[string]string) ([]libhive.Resource, error) {
+	filter := map[string]string{libhive.LabelRunID: b.runID}
+	for k, v := range labels {
+		filter[k] = v
+	}
+	return b.listResources(filter)
+}
+
+// listResources returns containers and networks matching a label filter.
+// An empty label value matches any value. Containers are listed first.
+func (b *ContainerBackend) listResources(filter map[string]string) ([]libhive.Resource, error) {
+	var (
+		containerFilter []string
+		networkFilter   = make(map[string]bool)
+	)
+	for k, v := range filter {
+		f := k
+		if v != "" {
+			f += "=" + v
+		}
+		containerFilter = append(containerFilter, f)
+		networkFilter[f] = true
+	}
+
+	var resources []libhive.Resource
+	containers, err := b.client.ListContainers(docker.ListContainersOptions{
+		All:     true,
+		Filters: map[string][]string{"label": containerFilter},
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range containers {
+		var name string
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		resources = append(resources, libhive.Resource{
+			Type:   libhive.ResourceContainer,
+			ID:     c.ID,
+			Name:   name,
+			Labels: c.Labels,
+		})
+	}
+	networks, err := b.client.FilteredListNetworks(docker.NetworkFilterOpts{"label": networkFilter})
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range networks {
+		resources = append(resources, libhive.Resource{
+			Type:   libhive.ResourceNetwork,
+			ID:     n.ID,
+			Name:   n.Name,
+			Labels: n.Labels,
+		})
+	}
+	return resources, nil
+}
+
+// DeadRunResources returns the containers and networks left behind by hive runs whose
+// owner process no longer exists. Only runs started on the same host, i.e. with the same
+// host name, can be checked. Resources of other runs, e.g. from hive instances in other
+// containers sharing the docker daemon, are returned as unknown and must not be removed
+// automatically.
+func (b *ContainerBackend) DeadRunResources() (dead, unknown []libhive.Resource, err error) {
+	all, err := b.listResources(map[string]string{libhive.LabelRunID: ""})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, r := range all {
+		if r.Labels[libhive.LabelRunID] == b.runID {
+			continue
+		}
+		alive, known := b.ownerAlive(r.Labels)
+		switch {
+		case !known:
+			unknown = append(unknown, r)
+		case !alive:
+			dead = append(dead, r)
+		}
+	}
+	return dead, unknown, nil
+}
+
+// ownerAlive reports whether the hive process which created a resource is still running.
+// The result is only known if the process ran on the same host as this process.
+func (b *ContainerBackend) ownerAlive(labels map[string]string) (alive, known bool) {
+	host := b.owner[libhive.LabelOwnerHost]
+	if host == "" || labels[libhive.LabelOwnerHost] != host {
+		return false, false
+	}
+	pid, err := strconv.Atoi(labels[libhive.LabelOwnerPID])
+	if err != nil {
+		return false, false
+	}
+	if !processAlive(pid) {
+		return false, true
+	}
+	// The PID may have been reused by another process after hive exited.
+	if start := labels[libhive.LabelOwnerStart]; start != "" {
+		if current, ok := processStartTime(pid); ok && current != start {
+			return false, true
+		}
+	}
+	return true, true
+}
+
+// RemoveResources removes the given containers and networks.
+func (b *ContainerBackend) RemoveResources(ctx context.Context, resources []libhive.Resource) error {
+	var errs []string
+	for _, r := range resources {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		b.logger.Info("removing "+r.Type, "id", r.ID, "name", r.Name, "run", r.Labels[libhive.LabelRunID])
+		var err error
+		switch r.Type {
+		case libhive.ResourceContainer:
+			err = b.client.RemoveContainer(docker.RemoveContainerOptions{ID: r.ID, Force: true, Context: ctx})
+		case libhive.ResourceNetwork:
+			err = b.RemoveNetwork(r.ID)
+		}
+		if err != nil {
+			errs = append(errs, r.Type+" "+r.ID+": "+err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New("can't remove " + strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// processAlive reports whether a process with the given ID exists.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// processStartTime returns the start time of a process in clock ticks since boot.
+// This only works on Linux.
+func processStartTime(pid int) (string, bool) {
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return "", false
+	}
+	// The second field is the command name in parentheses, which can contain spaces.
+	// The start time is field 22.
+	i := bytes.LastIndexByte(stat, ')')
+	if i < 0 {
+		return "", false
+	}
+	fields := strings.Fields(string(stat[i+1:]))
+	if len(fields) < 20 {
+		return "", false
+	}
+	return fields[19], true
+}
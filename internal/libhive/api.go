@@ -1,22 +1,28 @@
 package libhive
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
+	"net"
 	"net/http"
+	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ethereum/hive/internal/simapi"
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
 	"gopkg.in/inconshreveable/log15.v2"
 )
 
@@ -35,12 +41,18 @@ func newSimulationAPI(b ContainerBackend, env SimEnv, tm *TestManager) http.Hand
 	router := mux.NewRouter()
 	router.HandleFunc("/clients", api.getClientTypes).Methods("GET")
 	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/exec", api.execInClient).Methods("POST")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/exec-stream", api.execStreamInClient).Methods("GET")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/logs", api.clientLogs).Methods("GET")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/file", api.copyFromClient).Methods("GET")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/clock", api.updateClientClock).Methods("POST")
 	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}", api.getNodeStatus).Methods("GET")
 	router.HandleFunc("/testsuite/{suite}/test/{test}/node", api.startClient).Methods("POST")
 	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}", api.stopClient).Methods("DELETE")
 	router.HandleFunc("/testsuite/{suite}/test", api.startTest).Methods("POST")
 	// post because the delete http verb does not always support a message body
 	router.HandleFunc("/testsuite/{suite}/test/{test}", api.endTest).Methods("POST")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/artifact", api.addArtifact).Methods("POST")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/crashes", api.watchCrashes).Methods("GET")
 	router.HandleFunc("/testsuite", api.startSuite).Methods("POST")
 	router.HandleFunc("/testsuite/{suite}", api.endSuite).Methods("DELETE")
 	router.HandleFunc("/testsuite/{suite}/network/{network}", api.networkCreate).Methods("POST")
@@ -48,6 +60,7 @@ func newSimulationAPI(b ContainerBackend, env SimEnv, tm *TestManager) http.Hand
 	router.HandleFunc("/testsuite/{suite}/network/{network}/{node}", api.networkIPGet).Methods("GET")
 	router.HandleFunc("/testsuite/{suite}/network/{network}/{node}", api.networkConnect).Methods("POST")
 	router.HandleFunc("/testsuite/{suite}/network/{network}/{node}", api.networkDisconnect).Methods("DELETE")
+	router.Use(instrumentAPI)
 	return router
 }
 
@@ -162,6 +175,28 @@ func (api *simAPI) endTest(w http.ResponseWriter, r *http.Request) {
 	serveOK(w)
 }
 
+// addArtifact stores a file produced by a test case.
+func (api *simAPI) addArtifact(w http.ResponseWriter, r *http.Request) {
+	_, testID, err := api.requestSuiteAndTest(r)
+	if err != nil {
+		serveError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	err = api.tm.AddArtifact(testID, name, r.Body)
+	switch {
+	case err == ErrInvalidArtifactName:
+		serveError(w, fmt.Errorf("%v %q", err, name), http.StatusBadRequest)
+	case err != nil:
+		log15.Error("API: could not store artifact", "test", testID, "name", name, "error", err)
+		serveError(w, err, http.StatusInternalServerError)
+	default:
+		log15.Info("API: artifact stored", "test", testID, "name", name)
+		serveOK(w)
+	}
+}
+
 // startClient starts a client container.
 func (api *simAPI) startClient(w http.ResponseWriter, r *http.Request) {
 	suiteID, testID, err := api.requestSuiteAndTest(r)
@@ -208,6 +243,17 @@ func (api *simAPI) startClient(w http.ResponseWriter, r *http.Request) {
 		serveError(w, err, http.StatusBadRequest)
 		return
 	}
+	// The host name is registered as an alias in the initial networks.
+	var aliases []string
+	if clientConfig.Hostname != "" {
+		if !isValidHostname(clientConfig.Hostname) {
+			err := fmt.Errorf("invalid hostname %q in client start request", clientConfig.Hostname)
+			log15.Error("API: "+err.Error(), "client", clientDef.Name)
+			serveError(w, err, http.StatusBadRequest)
+			return
+		}
+		aliases = []string{clientConfig.Hostname}
+	}
 
 	files := make(map[string]*multipart.FileHeader)
 	for key, fheaders := range r.MultipartForm.File {
@@ -232,16 +278,71 @@ func (api *simAPI) startClient(w http.ResponseWriter, r *http.Request) {
 		env["HIVE_LOGLEVEL"] = strconv.Itoa(api.env.SimLogLevel)
 	}
 
+	// Configure the readiness check.
+	probe, probeTimeout, err := clientReadinessProbe(clientDef, &clientConfig, env)
+	if err != nil {
+		log15.Error("API: invalid readiness probe", "client", clientDef.Name, "error", err)
+		serveError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// Configure the fake clock.
+	clock, err := newClientClock(clientConfig.Clock)
+	if err != nil {
+		log15.Error("API: invalid clock config", "client", clientDef.Name, "error", err)
+		serveError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// Wait until the client limit allows starting another client. The slot is
+	// released when the container exits, or here if it doesn't get registered.
+	// The start timeout applies only after the slot is acquired.
+	var events []TestEvent
+	queueStart := time.Now()
+	mem := api.env.ClientMemoryLimit
+	queueWait, err := api.tm.clientLimiter.acquire(r.Context(), mem, api.env.ClientQueueTimeout)
+	if err != nil {
+		log15.Error("API: client start failed while queued", "client", clientDef.Name, "error", err)
+		err := fmt.Errorf("client start failed while queued: %v", err)
+		serveError(w, err, http.StatusServiceUnavailable)
+		return
+	}
+	release := func() { api.tm.clientLimiter.release(mem) }
+	defer func() {
+		if release != nil {
+			release()
+		}
+	}()
+	metricClientQueueDuration.WithLabelValues(clientDef.Name).Observe(queueWait.Seconds())
+	if queueWait > 0 {
+		log15.Info("API: client start was queued", "client", clientDef.Name, "wait", queueWait)
+		events = append(events, TestEvent{Time: queueStart, Type: EventClientQueued, Details: "waited " + queueWait.Round(time.Millisecond).String()})
+	}
+
 	// Set up the timeout.
 	timeout := api.env.ClientStartTimeout
 	if timeout == 0 {
 		timeout = defaultStartTimeout
 	}
+	if probeTimeout != 0 {
+		timeout = probeTimeout
+	}
 	ctx, cancel := context.WithTimeout(r.Context(), timeout)
 	defer cancel()
 
 	// Create the client container.
-	options := ContainerOptions{Env: env, Files: files}
+	options := ContainerOptions{
+		Env:         env,
+		Files:       files,
+		Hostname:    clientConfig.Hostname,
+		Labels:      suiteLabels(suiteID),
+		Readiness:   probe,
+		MemoryLimit: api.env.ClientMemoryLimit,
+	}
+	options.Labels[LabelTest] = testID.String()
+	if clock != nil {
+		options.FakeClock = clock.spec()
+	}
 	containerID, err := api.backend.CreateContainer(ctx, clientDef.Image, options)
 	if err != nil {
 		log15.Error("API: client container create failed", "client", clientDef.Name, "error", err)
@@ -257,27 +358,36 @@ func (api *simAPI) startClient(w http.ResponseWriter, r *http.Request) {
 
 	// Connect to the networks if requested, so it is started already joined to each one.
 	for _, network := range networks {
-		if err := api.tm.ConnectContainer(suiteID, network, containerID); err != nil {
+		if err := api.tm.ConnectContainer(suiteID, network, containerID, aliases...); err != nil {
 			log15.Error("API: failed to connect container", "network", network, "container", containerID, "error", err)
-			serveError(w, err, http.StatusInternalServerError)
-			return
-		}
-	}
-
-	// by default: check the eth1 port
-	options.CheckLive = 8545
-	if portStr := env["HIVE_CHECK_LIVE_PORT"]; portStr != "" {
-		v, err := strconv.ParseUint(portStr, 10, 16)
-		if err != nil {
-			log15.Error("API: could not parse check-live port", "error", err)
-			serveError(w, err, http.StatusBadRequest)
+			api.backend.DeleteContainer(containerID)
+			api.tm.releaseAliases(containerID, "")
+			status := http.StatusInternalServerError
+			if errors.Is(err, ErrDuplicateAlias) {
+				status = http.StatusConflict
+			}
+			serveError(w, err, status)
 			return
 		}
-		options.CheckLive = uint16(v)
+		events = append(events, TestEvent{Time: time.Now(), Type: EventNetworkConnect, Network: network})
 	}
 
 	// Start it!
+	startTime := time.Now()
 	info, err := api.backend.StartContainer(ctx, containerID, options)
+	events = append(events, TestEvent{Time: startTime, Type: EventClientStart, Details: clientDef.Name})
+	if err != nil {
+		events = append(events, TestEvent{Time: time.Now(), Type: EventClientStartFailed, Details: err.Error()})
+		metricClientStartFailures.WithLabelValues(clientDef.Name).Inc()
+	} else {
+		// Without a readiness probe, the client was not checked.
+		readyEvent := EventClientReady
+		if probe == nil {
+			readyEvent = EventClientStarted
+		}
+		events = append(events, TestEvent{Time: time.Now(), Type: readyEvent})
+		metricClientStartDuration.WithLabelValues(clientDef.Name).Observe(time.Since(startTime).Seconds())
+	}
 	if info != nil {
 		clientInfo := &ClientInfo{
 			ID:             info.ID,
@@ -285,7 +395,10 @@ func (api *simAPI) startClient(w http.ResponseWriter, r *http.Request) {
 			Name:           clientDef.Name,
 			InstantiatedAt: time.Now(),
 			LogFile:        logPath,
+			LogOffsets:     &LogOffsets{}, // the log file is created by StartContainer
+			clock:          clock,
 			wait:           info.Wait,
+			release:        release,
 		}
 
 		// Add client version to the test suite.
@@ -297,9 +410,16 @@ func (api *simAPI) startClient(w http.ResponseWriter, r *http.Request) {
 
 		// Register the node. This should always be done, even if starting the container
 		// failed, to ensure that the failed client log is associated with the test.
-		api.tm.RegisterNode(testID, info.ID, clientInfo)
+		if api.tm.RegisterNode(testID, info.ID, clientInfo) == nil {
+			release = nil // now owned by the client watcher
+		}
+		for _, ev := range events {
+			ev.Client = info.ID
+			api.tm.AddTestEvent(testID, ev)
+		}
 	}
 	if err != nil {
+		api.tm.releaseAliases(containerID, "")
 		log15.Error("API: could not start client", "client", clientDef.Name, "container", containerID[:8], "error", err)
 		err := fmt.Errorf("client did not start: %v", err)
 		serveError(w, err, http.StatusInternalServerError)
@@ -322,6 +442,55 @@ func (api *simAPI) clientLogFilePaths(clientName, containerID string) (jsonPath
 	return jsonPath, file
 }
 
+// clientReadinessProbe determines the startup check of a client container. A probe
+// requested by the simulator takes precedence over the HIVE_CHECK_LIVE_PORT variable,
+// which in turn overrides the probe declared in hive.yaml. Without any configuration,
+// hive waits for TCP port 8545 to open. The returned probe is nil if no check should
+// be performed.
+func clientReadinessProbe(def *ClientDefinition, config *simapi.NodeConfig, env map[string]string) (*simapi.ReadinessProbe, time.Duration, error) {
+	probe := simapi.ReadinessProbe{Type: "tcp", Port: 8545}
+	portStr := env["HIVE_CHECK_LIVE_PORT"]
+	switch {
+	case config.Readiness != nil:
+		probe = *config.Readiness
+	case portStr != "":
+		v, err := strconv.ParseUint(portStr, 10, 16)
+		if err != nil {
+			return nil, 0, fmt.Errorf("could not parse check-live port: %v", err)
+		}
+		probe.Port = uint16(v)
+		if v == 0 {
+			probe.Type = "none"
+		}
+	case def.Meta.Readiness != nil:
+		probe = *def.Meta.Readiness
+	}
+
+	var timeout time.Duration
+	if probe.Timeout != "" {
+		var err error
+		timeout, err = time.ParseDuration(probe.Timeout)
+		if err != nil || timeout <= 0 {
+			return nil, 0, fmt.Errorf("invalid readiness probe timeout %q", probe.Timeout)
+		}
+	}
+	switch probe.Type {
+	case "none":
+		return nil, timeout, nil
+	case "tcp", "http":
+	case "jsonrpc":
+		if probe.Method == "" {
+			return nil, 0, errors.New("missing method in jsonrpc readiness probe")
+		}
+	default:
+		return nil, 0, fmt.Errorf("unknown readiness probe type %q", probe.Type)
+	}
+	if probe.Port == 0 {
+		return nil, 0, fmt.Errorf("missing port in %s readiness probe", probe.Type)
+	}
+	return &probe, timeout, nil
+}
+
 func (api *simAPI) checkClient(req *simapi.NodeConfig) (*ClientDefinition, error) {
 	if req.Client == "" {
 		return nil, errors.New("missing client type in start request")
@@ -404,15 +573,408 @@ func (api *simAPI) execInClient(w http.ResponseWriter, r *http.Request) {
 		serveError(w, err, http.StatusBadRequest)
 		return
 	}
+	start := time.Now()
 	info, err := api.backend.RunProgram(r.Context(), nodeInfo.ID, commandline)
 	if err != nil {
+		api.recordExec(testID, node, start, commandline, 0, err)
 		log15.Error("API: client script exec error", "node", node, "error", err)
 		serveError(w, err, http.StatusInternalServerError)
 		return
 	}
+	api.recordExec(testID, node, start, commandline, info.ExitCode, nil)
 	serveJSON(w, &info)
 }
 
+// recordExec adds a command execution to the timeline of a test.
+func (api *simAPI) recordExec(testID TestID, node string, start time.Time, cmd []string, exitCode int, err error) {
+	details := strings.Join(cmd, " ")
+	if err != nil {
+		details += " (error: " + err.Error() + ")"
+	} else {
+		details += fmt.Sprintf(" (exit code %d)", exitCode)
+	}
+	api.tm.AddTestEvent(testID, TestEvent{Time: start, Type: EventExec, Client: node, Details: details})
+}
+
+var execStreamUpgrader = websocket.Upgrader{}
+
+// execStreamInClient runs a command in a client container, streaming its input and
+// output over a websocket connection.
+//
+// The first message sent by the simulator is the ExecRequest. Binary messages sent by
+// the simulator after that are forwarded to the standard input of the command, and an
+// empty binary message closes standard input. Output is sent as binary messages
+// prefixed by the stream identifier. When the command has exited, the final message is
+// an ExecStreamResult. Closing the connection early terminates the command.
+func (api *simAPI) execStreamInClient(w http.ResponseWriter, r *http.Request) {
+	suiteID, testID, err := api.requestSuiteAndTest(r)
+	if err != nil {
+		serveError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	node := mux.Vars(r)["node"]
+	nodeInfo, err := api.tm.GetNodeInfo(suiteID, testID, node)
+	if err != nil {
+		log15.Error("API: can't find node", "node", node, "error", err)
+		serveError(w, err, http.StatusNotFound)
+		return
+	}
+
+	conn, err := execStreamUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log15.Error("API: exec stream upgrade failed", "node", node, "error", err)
+		return
+	}
+	defer conn.Close()
+	var (
+		writeMu     sync.Mutex
+		writeResult = func(result *simapi.ExecStreamResult) {
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			conn.WriteJSON(result)
+			closeMsg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+			conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
+		}
+	)
+
+	// Parse and validate the exec request.
+	_, msg, err := conn.ReadMessage()
+	if err != nil {
+		log15.Error("API: can't read exec request", "node", node, "error", err)
+		return
+	}
+	commandline, err := parseExecRequest(bytes.NewReader(msg))
+	if err != nil {
+		log15.Error("API: invalid exec request", "node", node, "error", err)
+		writeResult(&simapi.ExecStreamResult{Error: err.Error()})
+		return
+	}
+
+	// Forward input. Writing to stdin blocks until the command reads its input, so
+	// writes happen on a separate goroutine. This keeps the connection reader going,
+	// and the command is cancelled as soon as the connection goes down.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	stdinR, stdinW := io.Pipe()
+	defer stdinR.Close()
+	input := make(chan []byte, execStdinQueue)
+	go func() {
+		for data := range input {
+			if _, err := stdinW.Write(data); err != nil {
+				// The command has exited or closed its input.
+				log15.Debug("API: exec input dropped", "node", node, "error", err)
+				for range input {
+				}
+				return
+			}
+		}
+		stdinW.Close()
+	}()
+	go func() {
+		defer cancel()
+		inputClosed := false
+		closeInput := func() {
+			if !inputClosed {
+				close(input)
+				inputClosed = true
+			}
+		}
+		defer closeInput()
+		for {
+			typ, data, err := conn.ReadMessage()
+			if err != nil {
+				stdinW.CloseWithError(err)
+				return
+			}
+			switch {
+			case typ != websocket.BinaryMessage || inputClosed:
+				continue
+			case len(data) == 0:
+				closeInput()
+			default:
+				select {
+				case input <- data:
+				default:
+					log15.Error("API: exec input overflow, command is not reading its input", "node", node)
+					stdinW.CloseWithError(errExecInputOverflow)
+					closeInput()
+				}
+			}
+		}
+	}()
+
+	streams := ExecStreams{
+		Stdin:  stdinR,
+		Stdout: &execStreamWriter{conn: conn, mu: &writeMu, stream: simapi.ExecStreamStdout, cancel: cancel},
+		Stderr: &execStreamWriter{conn: conn, mu: &writeMu, stream: simapi.ExecStreamStderr, cancel: cancel},
+	}
+	start := time.Now()
+	exitCode, err := api.backend.RunProgramStream(ctx, nodeInfo.ID, commandline, streams)
+	api.recordExec(testID, node, start, commandline, exitCode, err)
+	if err != nil {
+		log15.Error("API: client script exec error", "node", node, "error", err)
+		writeResult(&simapi.ExecStreamResult{Error: err.Error()})
+		return
+	}
+	writeResult(&simapi.ExecStreamResult{ExitCode: exitCode})
+}
+
+// execStdinQueue is the number of input messages buffered for a command started by
+// execStreamInClient. The stream fails when the command doesn't keep up with its input.
+const execStdinQueue = 1024
+
+var errExecInputOverflow = errors.New("command is not reading its input")
+
+// execStreamWriter sends command output as websocket messages.
+type execStreamWriter struct {
+	conn   *websocket.Conn
+	mu     *sync.Mutex
+	stream byte
+	cancel context.CancelFunc
+}
+
+func (sw *execStreamWriter) Write(b []byte) (int, error) {
+	msg := make([]byte, len(b)+1)
+	msg[0] = sw.stream
+	copy(msg[1:], b)
+
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if err := sw.conn.WriteMessage(websocket.BinaryMessage, msg); err != nil {
+		// The simulator is gone, stop the command.
+		sw.cancel()
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// updateClientClock changes the fake clock of a client container.
+func (api *simAPI) updateClientClock(w http.ResponseWriter, r *http.Request) {
+	suiteID, testID, err := api.requestSuiteAndTest(r)
+	if err != nil {
+		serveError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	node := mux.Vars(r)["node"]
+	nodeInfo, err := api.tm.GetNodeInfo(suiteID, testID, node)
+	if err != nil {
+		log15.Error("API: can't find node", "node", node, "error", err)
+		serveError(w, err, http.StatusNotFound)
+		return
+	}
+	if nodeInfo.clock == nil {
+		err := errors.New("client was not started with a fake clock")
+		serveError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	var req simapi.ClockUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		serveError(w, fmt.Errorf("invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+	var setErr error
+	clock, err := nodeInfo.clock.update(&req, func(spec string) error {
+		setErr = api.backend.SetFakeClock(r.Context(), nodeInfo.ID, spec)
+		if setErr == nil {
+			log15.Info("API: client clock changed", "node", node, "clock", spec)
+		}
+		return setErr
+	})
+	switch {
+	case setErr != nil:
+		log15.Error("API: can't set client clock", "node", node, "error", setErr)
+		serveError(w, fmt.Errorf("can't set client clock: %v", setErr), http.StatusInternalServerError)
+		return
+	case err != nil:
+		serveError(w, err, http.StatusBadRequest)
+		return
+	}
+	serveJSON(w, &clock)
+}
+
+// copyFromClient streams a tar archive of a file or directory in a client container.
+func (api *simAPI) copyFromClient(w http.ResponseWriter, r *http.Request) {
+	suiteID, testID, err := api.requestSuiteAndTest(r)
+	if err != nil {
+		serveError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	node := mux.Vars(r)["node"]
+	nodeInfo, err := api.tm.GetNodeInfo(suiteID, testID, node)
+	if err != nil {
+		log15.Error("API: can't find node", "node", node, "error", err)
+		serveError(w, err, http.StatusNotFound)
+		return
+	}
+	filePath := r.URL.Query().Get("path")
+	if !path.IsAbs(filePath) {
+		serveError(w, errors.New("file path must be absolute"), http.StatusBadRequest)
+		return
+	}
+
+	// The response header is sent when the first chunk of the archive arrives.
+	// This allows serving errors that occur before the transfer starts.
+	out := &lazyHeaderWriter{w: w, contentType: "application/x-tar"}
+	err = api.backend.CopyFromContainer(r.Context(), nodeInfo.ID, filePath, out)
+	if err != nil {
+		log15.Error("API: can't copy from client", "node", node, "path", filePath, "error", err)
+		if !out.started {
+			serveError(w, fmt.Errorf("can't copy %s from client: %v", filePath, err), http.StatusInternalServerError)
+		}
+	}
+}
+
+// watchCrashes streams client crashes of a test case as newline-separated JSON objects.
+// Crashes which happened before the request are sent as well. The response ends when
+// the test ends.
+func (api *simAPI) watchCrashes(w http.ResponseWriter, r *http.Request) {
+	_, testID, err := api.requestSuiteAndTest(r)
+	if err != nil {
+		serveError(w, err, http.StatusBadRequest)
+		return
+	}
+	if _, running := api.tm.IsTestRunning(testID); !running {
+		serveError(w, ErrNoSuchTestCase, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("content-type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	var (
+		enc  = json.NewEncoder(w)
+		sent = make(map[string]bool)
+	)
+	for {
+		crashed, notify, running := api.tm.ClientCrashes(testID)
+		for id, info := range crashed {
+			if sent[id] {
+				continue
+			}
+			sent[id] = true
+			enc.Encode(&simapi.ClientCrash{
+				ID:        id,
+				Name:      info.Name,
+				Time:      info.Crash.Time,
+				ExitCode:  info.Crash.ExitCode,
+				OOMKilled: info.Crash.OOMKilled,
+				LogTail:   info.Crash.LogTail,
+			})
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if !running {
+			return
+		}
+		select {
+		case <-notify:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// clientLogPollInterval is the interval at which followed client logs are checked for new output.
+const clientLogPollInterval = 100 * time.Millisecond
+
+// clientLogs serves the log output of a client container. When the 'follow' parameter
+// is set, the response is streamed until the client has exited. The 'since' parameter
+// can be used to start at a byte offset in the log.
+func (api *simAPI) clientLogs(w http.ResponseWriter, r *http.Request) {
+	suiteID, testID, err := api.requestSuiteAndTest(r)
+	if err != nil {
+		serveError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	node := mux.Vars(r)["node"]
+	nodeInfo, err := api.tm.GetNodeInfo(suiteID, testID, node)
+	if err != nil {
+		log15.Error("API: can't find node", "node", node, "error", err)
+		serveError(w, err, http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query()
+	follow := q.Get("follow") == "1" || q.Get("follow") == "true"
+	var offset int64
+	if s := q.Get("since"); s != "" {
+		offset, err = strconv.ParseInt(s, 10, 64)
+		if err != nil || offset < 0 {
+			serveError(w, fmt.Errorf("invalid log offset %q", s), http.StatusBadRequest)
+			return
+		}
+	}
+
+	file, err := os.Open(filepath.Join(api.env.LogDir, filepath.FromSlash(nodeInfo.LogFile)))
+	if err != nil {
+		log15.Error("API: can't open client log", "node", node, "error", err)
+		serveError(w, errors.New("client log is not available"), http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		serveError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("content-type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	if !follow {
+		io.Copy(w, file)
+		return
+	}
+	flusher, _ := w.(http.Flusher)
+	for {
+		// Check for exit before copying, so output written
+		// just before the exit is not lost.
+		exited := false
+		select {
+		case <-nodeInfo.exited:
+			exited = true
+		default:
+		}
+		if _, err := io.Copy(w, file); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if exited {
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-nodeInfo.exited:
+		case <-time.After(clientLogPollInterval):
+		}
+	}
+}
+
+// lazyHeaderWriter writes the response header on the first call to Write.
+type lazyHeaderWriter struct {
+	w           http.ResponseWriter
+	contentType string
+	started     bool
+}
+
+func (lw *lazyHeaderWriter) Write(b []byte) (int, error) {
+	if !lw.started {
+		lw.w.Header().Set("content-type", lw.contentType)
+		lw.w.WriteHeader(http.StatusOK)
+		lw.started = true
+	}
+	return lw.w.Write(b)
+}
+
 // parseExecRequest decodes and validates a client script exec request.
 func parseExecRequest(r io.Reader) ([]string, error) {
 	var request simapi.ExecRequest
@@ -438,8 +1000,19 @@ func (api *simAPI) networkCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The network options are optional.
+	var opt simapi.NetworkOptions
+	if err := json.NewDecoder(r.Body).Decode(&opt); err != nil && err != io.EOF {
+		serveError(w, fmt.Errorf("invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := validateNetworkOptions(&opt); err != nil {
+		serveError(w, err, http.StatusBadRequest)
+		return
+	}
+
 	networkName := mux.Vars(r)["network"]
-	err = api.tm.CreateNetwork(suiteID, networkName)
+	err = api.tm.CreateNetwork(suiteID, networkName, opt)
 	if err != nil {
 		log15.Error("API: failed to create network", "network", networkName, "error", err)
 		serveError(w, err, http.StatusBadRequest)
@@ -449,6 +1022,40 @@ func (api *simAPI) networkCreate(w http.ResponseWriter, r *http.Request) {
 	serveOK(w)
 }
 
+// validateNetworkOptions checks the options of a network creation request.
+func validateNetworkOptions(opt *simapi.NetworkOptions) error {
+	if opt.Subnet != "" {
+		ip, subnet, err := net.ParseCIDR(opt.Subnet)
+		if err != nil || ip.To4() == nil {
+			return fmt.Errorf("invalid IPv4 subnet %q", opt.Subnet)
+		}
+		if opt.Gateway != "" {
+			gw := net.ParseIP(opt.Gateway)
+			if gw == nil || !subnet.Contains(gw) {
+				return fmt.Errorf("gateway %q is not in subnet %s", opt.Gateway, opt.Subnet)
+			}
+		}
+	} else if opt.Gateway != "" {
+		return errors.New("gateway requires subnet")
+	}
+	if opt.IPv6 && opt.IPv6Subnet == "" {
+		return errors.New("IPv6 requires an IPv6 subnet")
+	}
+	if opt.IPv6Subnet != "" {
+		if !opt.IPv6 {
+			return errors.New("IPv6 subnet requires IPv6 to be enabled")
+		}
+		ip, _, err := net.ParseCIDR(opt.IPv6Subnet)
+		if err != nil || ip.To4() != nil {
+			return fmt.Errorf("invalid IPv6 subnet %q", opt.IPv6Subnet)
+		}
+	}
+	if opt.MTU != 0 && (opt.MTU < 68 || opt.MTU > 65535) {
+		return fmt.Errorf("invalid MTU %d", opt.MTU)
+	}
+	return nil
+}
+
 // networkRemove removes a docker network.
 func (api *simAPI) networkRemove(w http.ResponseWriter, r *http.Request) {
 	suiteID, err := api.requestSuite(r)
@@ -469,6 +1076,7 @@ func (api *simAPI) networkRemove(w http.ResponseWriter, r *http.Request) {
 }
 
 // networkIPGet gets the IP address of a container on a network.
+// The IPv6 address is returned when the request has the parameter family=ipv6.
 func (api *simAPI) networkIPGet(w http.ResponseWriter, r *http.Request) {
 	suiteID, err := api.requestSuite(r)
 	if err != nil {
@@ -478,7 +1086,16 @@ func (api *simAPI) networkIPGet(w http.ResponseWriter, r *http.Request) {
 
 	node := mux.Vars(r)["node"]
 	network := mux.Vars(r)["network"]
-	ipAddr, err := api.tm.ContainerIP(suiteID, network, node)
+	var ipAddr string
+	switch family := r.URL.Query().Get("family"); family {
+	case "", "ipv4":
+		ipAddr, err = api.tm.ContainerIP(suiteID, network, node)
+	case "ipv6":
+		ipAddr, err = api.tm.ContainerIPv6(suiteID, network, node)
+	default:
+		serveError(w, fmt.Errorf("invalid address family %q", family), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		log15.Error("API: failed to get container IP", "container", node, "error", err)
 		serveError(w, err, http.StatusInternalServerError)
@@ -496,17 +1113,41 @@ func (api *simAPI) networkConnect(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The request body is optional.
+	var req simapi.NetworkConnectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		serveError(w, fmt.Errorf("invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+	for _, alias := range req.Aliases {
+		if !isValidHostname(alias) {
+			serveError(w, fmt.Errorf("invalid network alias %q", alias), http.StatusBadRequest)
+			return
+		}
+	}
+
 	name := mux.Vars(r)["network"]
 	containerID := mux.Vars(r)["node"]
-	if err := api.tm.ConnectContainer(suiteID, name, containerID); err != nil {
+	if err := api.tm.ConnectContainer(suiteID, name, containerID, req.Aliases...); err != nil {
 		log15.Error("API: failed to connect container", "network", name, "container", containerID, "error", err)
-		serveError(w, err, http.StatusInternalServerError)
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrDuplicateAlias) {
+			status = http.StatusConflict
+		}
+		serveError(w, err, status)
 		return
 	}
-	log15.Info("API: container connected to network", "network", name, "container", containerID)
+	log15.Info("API: container connected to network", "network", name, "container", containerID, "aliases", req.Aliases)
 	serveOK(w)
 }
 
+// hostnameRE matches valid host names, which consist of DNS labels separated by dots.
+var hostnameRE = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+
+func isValidHostname(name string) bool {
+	return len(name) <= 253 && hostnameRE.MatchString(name)
+}
+
 // networkDisconnect disconnects a container from a network.
 func (api *simAPI) networkDisconnect(w http.ResponseWriter, r *http.Request) {
 	suiteID, err := api.requestSuite(r)
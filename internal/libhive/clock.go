@@ -0,0 +1,93 @@
+package libhive
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ethereum/hive/internal/simapi"
+)
+
+// clientClock is the state of a fake client clock. The clock shows the fake time
+// at the real time, and runs at the given rate from there.
+type clientClock struct {
+	mu   sync.Mutex
+	real time.Time
+	fake time.Time
+	rate float64
+}
+
+// newClientClock validates a clock configuration.
+// It returns nil if the client should use the real clock.
+func newClientClock(cfg *simapi.ClockConfig) (*clientClock, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	now := time.Now()
+	c := &clientClock{real: now, fake: now, rate: 1}
+	if cfg.Offset != "" {
+		d, err := time.ParseDuration(cfg.Offset)
+		if err != nil {
+			return nil, fmt.Errorf("invalid clock offset %q", cfg.Offset)
+		}
+		c.fake = now.Add(d)
+	}
+	if cfg.Rate < 0 {
+		return nil, errors.New("negative clock rate")
+	}
+	if cfg.Rate != 0 {
+		c.rate = cfg.Rate
+	}
+	return c, nil
+}
+
+// at returns the time shown by the clock at the given real time.
+func (c *clientClock) at(real time.Time) time.Time {
+	elapsed := float64(real.Sub(c.real)) * c.rate
+	return c.fake.Add(time.Duration(elapsed))
+}
+
+// spec returns the clock setting in the format of the hive-clock clock file:
+// the real and fake time of the reference point in nanoseconds, and the rate.
+func (c *clientClock) spec() string {
+	rate := strconv.FormatFloat(c.rate, 'f', -1, 64)
+	return fmt.Sprintf("%d %d %s", c.real.UnixNano(), c.fake.UnixNano(), rate)
+}
+
+// config returns the clock setting. The offset is the current difference
+// to real time, which changes over time if the rate is not one.
+func (c *clientClock) config() simapi.ClockConfig {
+	now := time.Now()
+	offset := c.at(now).Sub(now).Round(time.Millisecond)
+	return simapi.ClockConfig{Offset: offset.String(), Rate: c.rate}
+}
+
+// update applies a clock change. The apply function is called with the new
+// clock setting, and the change is kept only if it succeeds.
+func (c *clientClock) update(req *simapi.ClockUpdate, apply func(spec string) error) (simapi.ClockConfig, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	next := clientClock{real: now, fake: c.at(now), rate: c.rate}
+	if req.Shift != "" {
+		d, err := time.ParseDuration(req.Shift)
+		if err != nil {
+			return simapi.ClockConfig{}, fmt.Errorf("invalid clock shift %q", req.Shift)
+		}
+		next.fake = next.fake.Add(d)
+	}
+	if req.Rate < 0 {
+		return simapi.ClockConfig{}, errors.New("negative clock rate")
+	}
+	if req.Rate != 0 {
+		next.rate = req.Rate
+	}
+	if err := apply(next.spec()); err != nil {
+		return simapi.ClockConfig{}, err
+	}
+	c.real, c.fake, c.rate = next.real, next.fake, next.rate
+	return c.config(), nil
+}
@@ -28,6 +28,8 @@ type TestSuite struct {
 	TestCases      map[TestID]*TestCase `json:"testCases"`
 	// the log-file pertaining to the simulator. (may encompass more than just one TestSuite)
 	SimulatorLog string `json:"simLog"`
+	// the manifest of the hive run, relative to the log directory.
+	RunManifest string `json:"runManifest,omitempty"`
 }
 
 // TestCase represents a single test case in a test suite.
@@ -38,6 +40,49 @@ type TestCase struct {
 	End           time.Time              `json:"end"`
 	SummaryResult TestResult             `json:"summaryResult"` // The result of the whole test case.
 	ClientInfo    map[string]*ClientInfo `json:"clientInfo"`    // Info about each client.
+
+	// Artifacts maps artifact names to file paths relative to the log directory.
+	Artifacts map[string]string `json:"artifacts,omitempty"`
+
+	// Events is the timeline of the test, ordered by time.
+	Events []TestEvent `json:"events,omitempty"`
+
+	// SimLogOffsets is the part of the simulator log which was written while the
+	// test was running. Docker writes the log with a delay, so output of the test
+	// can appear after the end offset. Simulator output of the test itself is tagged
+	// "[test <id>]", and ends with the line "[test <id>] --- end of test output".
+	SimLogOffsets *LogOffsets `json:"simLogOffsets,omitempty"`
+}
+
+// LogOffsets is a byte range in a log file.
+type LogOffsets struct {
+	Begin int64 `json:"begin"`
+	End   int64 `json:"end"`
+}
+
+// These are the types of test events.
+const (
+	EventClientQueued      = "clientQueued"      // client waited for the client limit
+	EventClientStart       = "clientStart"       // client container is starting
+	EventClientReady       = "clientReady"       // client passed the readiness check
+	EventClientStarted     = "clientStarted"     // client started without readiness check
+	EventClientStartFailed = "clientStartFailed" // client did not start
+	EventClientStop        = "clientStop"        // client was stopped by the simulator or at test end
+	EventClientCrash       = "clientCrash"       // client exited unexpectedly
+	EventNetworkConnect    = "networkConnect"    // container was connected to a network
+	EventNetworkDisconnect = "networkDisconnect" // container was disconnected from a network
+	EventExec              = "exec"              // command was run in a client
+	EventArtifact          = "artifact"          // artifact was attached
+	EventTestEnd           = "testEnd"           // test result was reported
+)
+
+// TestEvent is an entry in the timeline of a test case.
+type TestEvent struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Client  string    `json:"client,omitempty"`  // Container ID.
+	Network string    `json:"network,omitempty"` // Network name.
+	Details string    `json:"details,omitempty"`
 }
 
 // TestResult is the payload submitted to the EndTest endpoint.
@@ -54,7 +99,32 @@ type ClientInfo struct {
 	InstantiatedAt time.Time `json:"instantiatedAt"`
 	LogFile        string    `json:"logFile"` //Absolute path to the logfile.
 
-	wait func()
+	// Crash is set when the client exited unexpectedly during the test.
+	Crash *ClientCrash `json:"crash,omitempty"`
+
+	// LogOffsets is the part of the client log which was written during the test.
+	// Docker writes the log with a delay, so output of the test can appear after the
+	// end offset.
+	LogOffsets *LogOffsets `json:"logOffsets,omitempty"`
+
+	// LogExcerpt is set when the test failed. It contains the warnings and
+	// the last lines of the client output during the test.
+	LogExcerpt []string `json:"logExcerpt,omitempty"`
+
+	clock     *clientClock // nil if the client uses the real clock
+	wait      func()
+	release   func()        // frees the client limiter slot
+	stopping  bool          // set when hive stops the client
+	exited    chan struct{} // closed when the container has exited
+	watchDone chan struct{} // closed when the exit has been checked
+}
+
+// ClientCrash describes an unexpected exit of a client container.
+type ClientCrash struct {
+	Time      time.Time `json:"time"`
+	ExitCode  int       `json:"exitCode"`
+	OOMKilled bool      `json:"oomKilled"`
+	LogTail   []string  `json:"logTail"` // Last lines of client output.
 }
 
 // ClientDefinition is served by the /clients API endpoint to list the available clients
@@ -8,6 +8,8 @@ import (
 	"mime/multipart"
 	"net"
 	"net/http"
+
+	"github.com/ethereum/hive/internal/simapi"
 )
 
 // ContainerBackend captures the docker interactions of the simulation API.
@@ -24,16 +26,71 @@ type ContainerBackend interface {
 	StartContainer(ctx context.Context, containerID string, opt ContainerOptions) (*ContainerInfo, error)
 	DeleteContainer(containerID string) error
 
+	// InspectExit returns the exit status of a container that has stopped.
+	InspectExit(containerID string) (*ExitInfo, error)
+
 	// RunProgram runs a command in the given container and returns its outputs and exit code.
 	RunProgram(ctx context.Context, containerID string, cmdline []string) (*ExecInfo, error)
 
+	// RunProgramStream runs a command in the given container, connecting its standard
+	// streams to the given reader and writers. It returns the exit code of the command.
+	// Cancelling the context terminates the command. The docker backend requires
+	// /bin/sh in the container to be able to terminate the command.
+	RunProgramStream(ctx context.Context, containerID string, cmdline []string, streams ExecStreams) (int, error)
+
+	// SetFakeClock changes the clock of a container that was created with the
+	// FakeClock option. The spec has the same format as ContainerOptions.FakeClock.
+	SetFakeClock(ctx context.Context, containerID string, spec string) error
+
+	// CopyFromContainer writes a tar archive of the given file or directory
+	// in the container to w.
+	CopyFromContainer(ctx context.Context, containerID, path string, w io.Writer) error
+
 	// These methods configure docker networks.
 	NetworkNameToID(name string) (string, error)
-	CreateNetwork(name string) (string, error)
+	CreateNetwork(name string, opt simapi.NetworkOptions, labels map[string]string) (string, error)
 	RemoveNetwork(id string) error
 	ContainerIP(containerID, networkID string) (net.IP, error)
-	ConnectContainer(containerID, networkID string) error
+	ContainerIPv6(containerID, networkID string) (net.IP, error)
+	ConnectContainer(containerID, networkID string, aliases ...string) error
 	DisconnectContainer(containerID, networkID string) error
+
+	// ListResources returns the containers and networks created by the current
+	// hive run which have all of the given labels.
+	ListResources(labels map[string]string) ([]Resource, error)
+}
+
+// These labels are set on docker resources created by hive. The backend adds
+// the run ID and owner labels to all containers and networks it creates.
+const (
+	LabelRunID      = "hive.run"      // unique ID of the hive run
+	LabelOwnerHost  = "hive.host"     // host name of the machine or container running hive
+	LabelOwnerPID   = "hive.pid"      // process ID of the hive instance
+	LabelOwnerStart = "hive.pidstart" // start time of the hive process, guards against PID reuse
+	LabelSuite      = "hive.suite"    // test suite ID
+	LabelTest       = "hive.test"     // test case ID
+)
+
+// Resource types.
+const (
+	ResourceContainer = "container"
+	ResourceNetwork   = "network"
+)
+
+// Resource is a container or network created by hive.
+type Resource struct {
+	Type   string // ResourceContainer or ResourceNetwork
+	ID     string
+	Name   string
+	Labels map[string]string
+}
+
+// ExecStreams are the standard streams of a command started by RunProgramStream.
+// Stdin may be nil if the command doesn't need input.
+type ExecStreams struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
 }
 
 // APIServer is a handle for the HTTP API server.
@@ -50,8 +107,24 @@ type ContainerOptions struct {
 	Env   map[string]string
 	Files map[string]*multipart.FileHeader
 
-	// This requests checking for the given TCP port to be opened by the container.
-	CheckLive uint16
+	// Hostname sets the host name of the container.
+	Hostname string
+
+	// Labels are added to the container, in addition to the run labels.
+	Labels map[string]string
+
+	// This requests checking that the container is ready for use.
+	// The probe is run against the container IP.
+	Readiness *simapi.ReadinessProbe
+
+	// MemoryLimit is the memory limit of the container in bytes.
+	// Zero means unlimited.
+	MemoryLimit int64
+
+	// FakeClock runs the container with a fake wall clock. This is the initial clock
+	// setting: a real time and the corresponding fake time in Unix nanoseconds,
+	// followed by the clock rate, e.g. "1700000000000000000 1700003600000000000 2".
+	FakeClock string
 
 	// Output: if LogFile is set, container stdin and stderr is redirected to the
 	// given log file. If Output is set, stdout is redirected to the writer. These
@@ -76,6 +149,12 @@ type ContainerInfo struct {
 	Wait func()
 }
 
+// ExitInfo is returned by InspectExit.
+type ExitInfo struct {
+	ExitCode  int
+	OOMKilled bool // whether the container was killed because it ran out of memory
+}
+
 // Builder can build docker images of clients and simulators.
 type Builder interface {
 	ReadClientMetadata(name string) (*ClientMetadata, error)
@@ -85,9 +164,21 @@ type Builder interface {
 
 	// ReadFile returns the content of a file in the given image.
 	ReadFile(ctx context.Context, image, path string) ([]byte, error)
+
+	// InspectImage returns the identity of an image.
+	InspectImage(ctx context.Context, image string) (*ImageInfo, error)
+}
+
+// ImageInfo identifies a docker image.
+type ImageInfo struct {
+	ID          string   // Content hash of the image configuration.
+	RepoDigests []string // Registry digests. This is empty for locally built images.
 }
 
 // ClientMetadata is metadata to describe the client in more detail, configured with a YAML file in the client dir.
 type ClientMetadata struct {
 	Roles []string `yaml:"roles" json:"roles"`
+
+	// Readiness configures the check for client startup.
+	Readiness *simapi.ReadinessProbe `yaml:"readiness" json:"readiness,omitempty"`
 }
@@ -0,0 +1,111 @@
+package libhive
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clientLimiter enforces the limits on concurrently running client containers.
+// Clients which exceed the limits wait until a running client exits.
+type clientLimiter struct {
+	maxClients int   // max number of running clients, zero means unlimited
+	memBudget  int64 // max total memory limit of running clients, zero means unlimited
+
+	mu      sync.Mutex
+	running int
+	memUsed int64
+	changed chan struct{} // closed and replaced when a client slot is released
+}
+
+func newClientLimiter(maxClients int, memBudget int64) *clientLimiter {
+	return &clientLimiter{
+		maxClients: maxClients,
+		memBudget:  memBudget,
+		changed:    make(chan struct{}),
+	}
+}
+
+// acquire reserves a client slot using the given amount of memory. It blocks until the
+// slot is available, the timeout expires or the context is canceled, and returns the time
+// spent waiting. A zero timeout means there is no timeout. The returned duration is zero
+// if the slot was available immediately. A client which exceeds the memory budget on its
+// own is rejected immediately.
+func (l *clientLimiter) acquire(ctx context.Context, mem int64, timeout time.Duration) (time.Duration, error) {
+	if l.memBudget > 0 && mem > l.memBudget {
+		return 0, fmt.Errorf("client memory limit of %d MB exceeds the client memory budget of %d MB", mem>>20, l.memBudget>>20)
+	}
+	var (
+		start    = time.Now()
+		queued   = false
+		timeoutC <-chan time.Time
+	)
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutC = timer.C
+	}
+	for {
+		l.mu.Lock()
+		if l.fits(mem) {
+			l.running++
+			l.memUsed += mem
+			l.mu.Unlock()
+			if !queued {
+				return 0, nil
+			}
+			return time.Since(start), nil
+		}
+		queued = true
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-timeoutC:
+			return time.Since(start), fmt.Errorf("no client slot available after %v (%s)", timeout, l.usage())
+		case <-ctx.Done():
+			return time.Since(start), ctx.Err()
+		}
+	}
+}
+
+// fits reports whether a client using mem can start now.
+// This must be called with l.mu held.
+func (l *clientLimiter) fits(mem int64) bool {
+	if l.maxClients > 0 && l.running >= l.maxClients {
+		return false
+	}
+	if l.memBudget > 0 && l.memUsed+mem > l.memBudget {
+		return false
+	}
+	return true
+}
+
+// usage describes the current state of the limits.
+func (l *clientLimiter) usage() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var s []string
+	if l.maxClients > 0 {
+		s = append(s, fmt.Sprintf("%d of %d clients running", l.running, l.maxClients))
+	}
+	if l.memBudget > 0 {
+		s = append(s, fmt.Sprintf("%d of %d MB memory budget used", l.memUsed>>20, l.memBudget>>20))
+	}
+	return strings.Join(s, ", ")
+}
+
+// release frees a slot reserved by acquire.
+func (l *clientLimiter) release(mem int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.running--
+	l.memUsed -= mem
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
@@ -0,0 +1,156 @@
+package libhive
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"gopkg.in/inconshreveable/log15.v2"
+)
+
+// These are the types of live events. Events of the test timeline (see TestEvent)
+// are also sent to the live feed, with their original type.
+const (
+	LiveSimStart   = "simStart"
+	LiveSimEnd     = "simEnd"
+	LiveSuiteStart = "suiteStart"
+	LiveSuiteEnd   = "suiteEnd"
+	LiveTestStart  = "testStart"
+)
+
+// LiveEvent is an event sent to the live feed.
+//
+// Suite and test IDs are only unique within a simulator run. Consumers should
+// reset their state when a new simulator starts.
+type LiveEvent struct {
+	Time      time.Time   `json:"time"`
+	Type      string      `json:"type"`
+	Simulator string      `json:"simulator,omitempty"`
+	Suite     TestSuiteID `json:"suite"`
+	Test      TestID      `json:"test,omitempty"`
+	Name      string      `json:"name,omitempty"`   // name of the suite or test
+	Client    string      `json:"client,omitempty"` // container ID
+	Network   string      `json:"network,omitempty"`
+	Details   string      `json:"details,omitempty"`
+	Pass      *bool       `json:"pass,omitempty"` // set for test and suite ends
+}
+
+const (
+	liveHistoryLimit = 10000 // number of events replayed to new subscribers
+	liveSubBuffer    = 256   // subscriber channel capacity
+	liveKeepAlive    = 30 * time.Second
+)
+
+// LiveFeed distributes events of a hive run to subscribers. Recent events are
+// kept and replayed to new subscribers, so they can see the state of the run.
+// Send can be called on a nil feed, which does nothing.
+type LiveFeed struct {
+	mu      sync.Mutex
+	history []LiveEvent
+	subs    map[chan LiveEvent]struct{}
+}
+
+// NewLiveFeed creates a live event feed.
+func NewLiveFeed() *LiveFeed {
+	return &LiveFeed{subs: make(map[chan LiveEvent]struct{})}
+}
+
+// Send delivers an event to all subscribers. Subscribers which can't keep up
+// with the event rate are dropped.
+func (f *LiveFeed) Send(ev LiveEvent) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.history) >= liveHistoryLimit {
+		n := copy(f.history, f.history[len(f.history)-liveHistoryLimit+1:])
+		f.history = f.history[:n]
+	}
+	f.history = append(f.history, ev)
+	for ch := range f.subs {
+		select {
+		case ch <- ev:
+		default:
+			log15.Warn("dropping slow live feed subscriber")
+			delete(f.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns a channel that receives events, and the events sent before the
+// call. The channel is closed when the subscriber is dropped. The returned function
+// must be called to end the subscription.
+func (f *LiveFeed) Subscribe() (<-chan LiveEvent, []LiveEvent, func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ch := make(chan LiveEvent, liveSubBuffer)
+	f.subs[ch] = struct{}{}
+	history := make([]LiveEvent, len(f.history))
+	copy(history, f.history)
+	unsubscribe := func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if _, ok := f.subs[ch]; ok {
+			delete(f.subs, ch)
+			close(ch)
+		}
+	}
+	return ch, history, unsubscribe
+}
+
+// ServeHTTP streams the feed as server-sent events.
+func (f *LiveFeed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	events, history, unsubscribe := f.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	for _, ev := range history {
+		if err := writeLiveEvent(w, ev); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(liveKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := writeLiveEvent(w, ev); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func writeLiveEvent(w http.ResponseWriter, ev LiveEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+	return err
+}
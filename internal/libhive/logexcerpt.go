@@ -0,0 +1,120 @@
+package libhive
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	// logExcerptScanSize is the amount of client output scanned for the excerpt.
+	// Only the end of larger log files is scanned.
+	logExcerptScanSize = 32 * 1024 * 1024
+	// logExcerptMaxWarnings is the max number of warning lines in an excerpt.
+	logExcerptMaxWarnings = 200
+	// logExcerptLineLength is the max length of a line in an excerpt.
+	logExcerptLineLength = 1000
+	// logExcerptGap is inserted between non-adjacent lines of an excerpt.
+	logExcerptGap = "[...]"
+)
+
+// Log levels as printed by common loggers, e.g. "WARN [...]" (geth terminal format),
+// "lvl=eror" (logfmt) and "level":"error" (JSON).
+var warnLevelRE = regexp.MustCompile(`(?i)^\s*(warn|warning|eror|error|crit|fatal|panic)\b|\b(lvl|level)=("?)(warn|warning|eror|error|crit|fatal|panic)\b|"(lvl|level)"\s*:\s*"(warn|warning|eror|error|crit|fatal|panic)"`)
+
+// clientLogExcerpt returns the interesting part of a client log for a failed test:
+// all lines at WARN level and above, and the last tailLines lines. Only the part of
+// the log between the given offsets is considered. Non-adjacent lines are separated
+// by logExcerptGap.
+func clientLogExcerpt(file string, offsets LogOffsets, tailLines int) []string {
+	if offsets.End <= offsets.Begin {
+		return nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	begin := offsets.Begin
+	if offsets.End-begin > logExcerptScanSize {
+		begin = offsets.End - logExcerptScanSize
+	}
+	if _, err := f.Seek(begin, io.SeekStart); err != nil {
+		return nil
+	}
+	r := bufio.NewReader(io.LimitReader(f, offsets.End-begin))
+	if begin > offsets.Begin {
+		r.ReadString('\n') // skip partial line
+	}
+
+	type logLine struct {
+		n    int
+		text string
+	}
+	var (
+		warnings []logLine
+		tail     []logLine
+		n        int
+	)
+	for {
+		text, err := r.ReadString('\n')
+		if text == "" && err != nil {
+			break
+		}
+		n++
+		text = trimLine(text)
+		line := logLine{n, text}
+		if warnLevelRE.MatchString(text) {
+			warnings = append(warnings, line)
+			if len(warnings) > 2*logExcerptMaxWarnings {
+				warnings = append(warnings[:0], warnings[len(warnings)-logExcerptMaxWarnings:]...)
+			}
+		}
+		tail = append(tail, line)
+		if len(tail) > 2*tailLines {
+			tail = append(tail[:0], tail[len(tail)-tailLines:]...)
+		}
+	}
+	if len(warnings) > logExcerptMaxWarnings {
+		warnings = warnings[len(warnings)-logExcerptMaxWarnings:]
+	}
+	if len(tail) > tailLines {
+		tail = tail[len(tail)-tailLines:]
+	}
+
+	// Merge the warnings and the tail. Both are ordered by line number.
+	var (
+		excerpt []string
+		last    int
+	)
+	add := func(line logLine) {
+		if line.n <= last {
+			return
+		}
+		if last > 0 && line.n > last+1 {
+			excerpt = append(excerpt, logExcerptGap)
+		}
+		excerpt = append(excerpt, line.text)
+		last = line.n
+	}
+	for len(warnings) > 0 || len(tail) > 0 {
+		if len(tail) == 0 || (len(warnings) > 0 && warnings[0].n < tail[0].n) {
+			add(warnings[0])
+			warnings = warnings[1:]
+		} else {
+			add(tail[0])
+			tail = tail[1:]
+		}
+	}
+	return excerpt
+}
+
+func trimLine(text string) string {
+	text = strings.TrimRight(text, "\r\n")
+	if len(text) > logExcerptLineLength {
+		text = text[:logExcerptLineLength] + "..."
+	}
+	return text
+}
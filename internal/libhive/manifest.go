@@ -0,0 +1,153 @@
+package libhive
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gopkg.in/inconshreveable/log15.v2"
+)
+
+// RunManifest records the images and parameters of a hive run,
+// so that the run can be reproduced later.
+type RunManifest struct {
+	Time       time.Time `json:"time"`
+	HiveCommit string    `json:"hiveCommit,omitempty"`
+	HiveDirty  bool      `json:"hiveDirty,omitempty"` // hive was built with uncommitted changes
+
+	// Args are the command-line flags of the run.
+	Args []string `json:"args"`
+
+	Clients    []ManifestImage `json:"clients"`
+	Simulators []ManifestImage `json:"simulators"`
+}
+
+// ManifestImage describes a client or simulator image used in a run.
+type ManifestImage struct {
+	Name        string            `json:"name"`
+	Image       string            `json:"image"`   // Image tag.
+	ImageID     string            `json:"imageID"` // Content hash of the image.
+	RepoDigests []string          `json:"repoDigests,omitempty"`
+	BuildArgs   map[string]string `json:"buildArgs,omitempty"`
+
+	// These are set for clients only.
+	Version string          `json:"version,omitempty"`
+	Meta    *ClientMetadata `json:"meta,omitempty"`
+}
+
+// Manifest creates the manifest of the images built by the runner.
+// The caller should fill in the command-line arguments and hive version.
+func (r *Runner) Manifest(ctx context.Context) (*RunManifest, error) {
+	m := &RunManifest{Time: time.Now().UTC(), Clients: []ManifestImage{}, Simulators: []ManifestImage{}}
+	for name, def := range r.clientDefs {
+		img, err := r.manifestImage(ctx, name, def.Image)
+		if err != nil {
+			return nil, err
+		}
+		if _, branch := SplitClientName(name); branch != "" {
+			img.BuildArgs = map[string]string{"branch": branch}
+		}
+		meta := def.Meta
+		img.Version = def.Version
+		img.Meta = &meta
+		m.Clients = append(m.Clients, img)
+	}
+	for name, image := range r.simImages {
+		img, err := r.manifestImage(ctx, name, image)
+		if err != nil {
+			return nil, err
+		}
+		m.Simulators = append(m.Simulators, img)
+	}
+	sort.Slice(m.Clients, func(i, j int) bool { return m.Clients[i].Name < m.Clients[j].Name })
+	sort.Slice(m.Simulators, func(i, j int) bool { return m.Simulators[i].Name < m.Simulators[j].Name })
+	return m, nil
+}
+
+func (r *Runner) manifestImage(ctx context.Context, name, image string) (ManifestImage, error) {
+	info, err := r.builder.InspectImage(ctx, image)
+	if err != nil {
+		return ManifestImage{}, fmt.Errorf("can't inspect image %s: %v", image, err)
+	}
+	return ManifestImage{Name: name, Image: image, ImageID: info.ID, RepoDigests: info.RepoDigests}, nil
+}
+
+// UseManifest configures the runner to use the images recorded in a manifest, instead
+// of building them. The images must be available in the local docker image store.
+// Internal helper images are still built.
+func (r *Runner) UseManifest(ctx context.Context, m *RunManifest) error {
+	if err := r.container.Build(ctx, r.builder); err != nil {
+		return err
+	}
+
+	r.clientDefs = make(map[string]*ClientDefinition, len(m.Clients))
+	for _, img := range m.Clients {
+		if err := r.checkManifestImage(ctx, img); err != nil {
+			return err
+		}
+		def := &ClientDefinition{Name: img.Name, Version: img.Version, Image: img.ImageID}
+		if img.Meta != nil {
+			def.Meta = *img.Meta
+		}
+		r.clientDefs[img.Name] = def
+	}
+	r.simImages = make(map[string]string, len(m.Simulators))
+	for _, img := range m.Simulators {
+		if err := r.checkManifestImage(ctx, img); err != nil {
+			return err
+		}
+		r.simImages[img.Name] = img.ImageID
+	}
+	return nil
+}
+
+func (r *Runner) checkManifestImage(ctx context.Context, img ManifestImage) error {
+	info, err := r.builder.InspectImage(ctx, img.ImageID)
+	if err != nil {
+		return fmt.Errorf("image %s of %s is not available: %v", img.ImageID, img.Name, err)
+	}
+	if info.ID != img.ImageID {
+		return fmt.Errorf("image %s of %s has wrong ID %s", img.ImageID, img.Name, info.ID)
+	}
+	log15.Info("using image from manifest", "name", img.Name, "image", img.ImageID)
+	return nil
+}
+
+// WriteRunManifest stores a manifest in the 'manifests' subdirectory of the log
+// directory. It returns the path of the file relative to the log directory.
+func WriteRunManifest(logdir string, m *RunManifest) (string, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	jsonPath := path.Join("manifests", fmt.Sprintf("%d-%x.json", m.Time.Unix(), b))
+	file := filepath.Join(logdir, filepath.FromSlash(jsonPath))
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		return "", err
+	}
+	return jsonPath, nil
+}
+
+// LoadRunManifest reads a manifest file.
+func LoadRunManifest(file string) (*RunManifest, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var m RunManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %v", file, err)
+	}
+	return &m, nil
+}
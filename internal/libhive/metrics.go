@@ -0,0 +1,156 @@
+package libhive
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricsRegistry contains all hive metrics. It is served by MetricsHandler.
+var metricsRegistry = prometheus.NewRegistry()
+
+// Test metrics.
+var (
+	metricTestsStarted = newCounterVec("tests_started_total",
+		"Number of tests started.", "suite")
+	metricTestsFinished = newCounterVec("tests_finished_total",
+		"Number of tests finished, by result. Tests using multiple clients are counted for each client.",
+		"suite", "client", "result")
+	metricSimulations = newCounterVec("simulations_total",
+		"Number of simulator runs, by result.", "simulator", "result")
+	metricSimulationDuration = newHistogramVec("simulation_duration_seconds",
+		"Run time of simulators.", prometheus.ExponentialBuckets(10, 2, 12), "simulator")
+)
+
+// Client and container metrics.
+var (
+	metricClientStartDuration = newHistogramVec("client_start_duration_seconds",
+		"Time from container start until the client is ready.", prometheus.ExponentialBuckets(0.25, 2, 12), "client")
+	metricClientStartFailures = newCounterVec("client_start_failures_total",
+		"Number of clients which failed to start.", "client")
+	metricClientQueueDuration = newHistogramVec("client_queue_duration_seconds",
+		"Time client start requests waited for the client limit.", prometheus.ExponentialBuckets(0.1, 2, 14), "client")
+
+	// MetricContainersCreated and MetricContainersRunning are updated by the
+	// container backend.
+	MetricContainersCreated = newCounter("containers_created_total",
+		"Number of docker containers created.")
+	MetricContainersRunning = newGauge("containers_running",
+		"Number of docker containers currently running.")
+
+	// MetricImageBuildDuration is updated by the image builder.
+	MetricImageBuildDuration = newHistogramVec("image_build_duration_seconds",
+		"Time taken to build docker images.", prometheus.ExponentialBuckets(1, 2, 12), "image", "result")
+)
+
+// API metrics.
+var (
+	metricAPIRequestDuration = newHistogramVec("api_request_duration_seconds",
+		"Latency of simulation API requests.", prometheus.DefBuckets, "method", "route", "code")
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+func newCounter(name, help string) prometheus.Counter {
+	c := prometheus.NewCounter(prometheus.CounterOpts{Namespace: "hive", Name: name, Help: help})
+	metricsRegistry.MustRegister(c)
+	return c
+}
+
+func newGauge(name, help string) prometheus.Gauge {
+	g := prometheus.NewGauge(prometheus.GaugeOpts{Namespace: "hive", Name: name, Help: help})
+	metricsRegistry.MustRegister(g)
+	return g
+}
+
+func newCounterVec(name, help string, labels ...string) *prometheus.CounterVec {
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: "hive", Name: name, Help: help}, labels)
+	metricsRegistry.MustRegister(c)
+	return c
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *prometheus.HistogramVec {
+	opts := prometheus.HistogramOpts{Namespace: "hive", Name: name, Help: help, Buckets: buckets}
+	h := prometheus.NewHistogramVec(opts, labels)
+	metricsRegistry.MustRegister(h)
+	return h
+}
+
+// MetricsHandler serves hive metrics in Prometheus format.
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// recordTestEnd updates the test metrics when a test ends.
+func recordTestEnd(test *runningTest) {
+	result := "pass"
+	if !test.SummaryResult.Pass {
+		result = "fail"
+	}
+	clients := testClientNames(test.TestCase)
+	if len(clients) == 0 {
+		clients = []string{""}
+	}
+	for _, client := range clients {
+		metricTestsFinished.WithLabelValues(test.suiteName, client, result).Inc()
+	}
+}
+
+// instrumentAPI is a middleware which measures request latency. Requests are
+// labeled with the route template, so IDs in the URL don't create new series.
+func instrumentAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if tmpl, err := current.GetPathTemplate(); err == nil {
+				route = tmpl
+			}
+		}
+		rw := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(rw, r)
+		code := strconv.Itoa(rw.status)
+		metricAPIRequestDuration.WithLabelValues(r.Method, route, code).Observe(time.Since(start).Seconds())
+	})
+}
+
+// statusRecorder captures the status code of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush is needed for streaming responses.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack is needed for websocket connections.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection does not support hijacking")
+	}
+	r.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
@@ -0,0 +1,90 @@
+package libhive_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/hive/hivesim"
+	"github.com/ethereum/hive/internal/fakes"
+	"github.com/ethereum/hive/internal/libhive"
+)
+
+func TestMetrics(t *testing.T) {
+	inv := makeTestInventory()
+	b := fakes.NewBuilder(&fakes.BuilderHooks{})
+	cb := fakes.NewContainerBackend(&fakes.BackendHooks{
+		StartContainer: func(image, containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
+			if !strings.Contains(image, "/simulator/") {
+				return new(libhive.ContainerInfo), nil
+			}
+			sim := hivesim.NewAt(opt.Env["HIVE_SIMULATOR"])
+			suite, err := sim.StartSuite("metrics-suite", "", "")
+			if err != nil {
+				t.Fatal("StartSuite failed:", err)
+			}
+			test, err := sim.StartTest(suite, "test", "")
+			if err != nil {
+				t.Fatal("StartTest failed:", err)
+			}
+			if _, _, err := sim.StartClientWithOptions(suite, test, "client-1"); err != nil {
+				t.Fatal("StartClient failed:", err)
+			}
+			if err := sim.EndTest(suite, test, hivesim.TestResult{Pass: false}); err != nil {
+				t.Fatal("EndTest failed:", err)
+			}
+			if err := sim.EndSuite(suite); err != nil {
+				t.Fatal("EndSuite failed:", err)
+			}
+			return &libhive.ContainerInfo{Wait: func() {}}, nil
+		},
+	})
+
+	// Metrics are global, so the test checks how they change during the run.
+	before := scrapeMetrics(t)
+	runner := libhive.NewRunner(inv, b, cb)
+	ctx := context.Background()
+	if err := runner.Build(ctx, []string{"client-1"}, []string{"sim-1"}); err != nil {
+		t.Fatal("Build() failed:", err)
+	}
+	simOpt := libhive.SimEnv{LogDir: t.TempDir(), ClientList: []string{"client-1"}}
+	if _, err := runner.Run(ctx, "sim-1", simOpt); err != nil {
+		t.Fatal("Run() failed:", err)
+	}
+	after := scrapeMetrics(t)
+
+	for metric, want := range map[string]float64{
+		`hive_tests_started_total{suite="metrics-suite"}`:                                                   1,
+		`hive_tests_finished_total{client="client-1",result="fail",suite="metrics-suite"}`:                  1,
+		`hive_simulations_total{result="fail",simulator="sim-1"}`:                                           1,
+		`hive_client_start_duration_seconds_count{client="client-1"}`:                                       1,
+		`hive_api_request_duration_seconds_count{code="200",method="POST",route="/testsuite/{suite}/test"}`: 1,
+	} {
+		if _, ok := after[metric]; !ok {
+			t.Errorf("metric missing: %s", metric)
+		} else if delta := after[metric] - before[metric]; delta != want {
+			t.Errorf("metric %s changed by %v, want %v", metric, delta, want)
+		}
+	}
+}
+
+// scrapeMetrics returns the current values of all metrics, keyed by name and labels.
+func scrapeMetrics(t *testing.T) map[string]float64 {
+	rec := httptest.NewRecorder()
+	libhive.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	values := make(map[string]float64)
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		i := strings.LastIndexByte(line, ' ')
+		if line == "" || strings.HasPrefix(line, "#") || i < 0 {
+			continue
+		}
+		v, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			t.Fatalf("invalid metric line %q", line)
+		}
+		values[line[:i]] = v
+	}
+	return values
+}
@@ -0,0 +1,497 @@
+package libhive
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// These are the supported report formats.
+const (
+	ReportJUnit       = "junit"
+	ReportTAP         = "tap"
+	ReportMarkdown    = "markdown"
+	ReportJSONSummary = "json-summary"
+)
+
+var reportFiles = map[string]string{
+	ReportJUnit:       "junit.xml",
+	ReportTAP:         "results.tap",
+	ReportMarkdown:    "summary.md",
+	ReportJSONSummary: "summary.json",
+}
+
+const (
+	reportLogLimit      = 64 * 1024 // max bytes of client log included per client in JUnit
+	reportDetailsLimit  = 2000      // max length of failure details in Markdown
+	reportFailuresLimit = 50        // max number of failures listed in Markdown
+)
+
+// ParseReportFormats parses a comma-separated list of report formats.
+func ParseReportFormats(list string) ([]string, error) {
+	var formats []string
+	for _, f := range strings.Split(list, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if _, ok := reportFiles[f]; !ok {
+			return nil, fmt.Errorf("unknown report format %q", f)
+		}
+		formats = append(formats, f)
+	}
+	return formats, nil
+}
+
+// ReportDir returns the directory containing the reports of a hive run, given the
+// path of its run manifest. Both paths are relative to the log directory.
+func ReportDir(runManifest string) string {
+	return path.Join("reports", strings.TrimSuffix(path.Base(runManifest), ".json"))
+}
+
+// WriteReports writes reports about the given test suites in the requested formats.
+// The reports are placed in the report directory of the run. It returns the paths of
+// the report files, relative to the log directory.
+func WriteReports(logdir, runManifest string, suites []*TestSuite, formats []string) ([]string, error) {
+	dir := ReportDir(runManifest)
+	if err := os.MkdirAll(filepath.Join(logdir, filepath.FromSlash(dir)), 0755); err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, format := range formats {
+		var buf bytes.Buffer
+		var err error
+		switch format {
+		case ReportJUnit:
+			err = writeJUnitReport(&buf, logdir, suites)
+		case ReportTAP:
+			writeTAPReport(&buf, suites)
+		case ReportMarkdown:
+			writeMarkdownReport(&buf, suites)
+		case ReportJSONSummary:
+			err = writeJSONSummary(&buf, suites)
+		default:
+			err = fmt.Errorf("unknown report format %q", format)
+		}
+		if err != nil {
+			return files, err
+		}
+		file := path.Join(dir, reportFiles[format])
+		if err := os.WriteFile(filepath.Join(logdir, filepath.FromSlash(file)), buf.Bytes(), 0644); err != nil {
+			return files, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// sortedTests returns the test cases of a suite ordered by ID.
+func sortedTests(suite *TestSuite) []*TestCase {
+	ids := make([]TestID, 0, len(suite.TestCases))
+	for id := range suite.TestCases {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	tests := make([]*TestCase, len(ids))
+	for i, id := range ids {
+		tests[i] = suite.TestCases[id]
+	}
+	return tests
+}
+
+// testClientNames returns the sorted names of the clients used by a test.
+func testClientNames(test *TestCase) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, info := range test.ClientInfo {
+		if !seen[info.Name] {
+			seen[info.Name] = true
+			names = append(names, info.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func testDuration(test *TestCase) float64 {
+	if test.End.IsZero() {
+		return 0
+	}
+	return test.End.Sub(test.Start).Seconds()
+}
+
+func countPasses(tests []*TestCase) (passes int) {
+	for _, test := range tests {
+		if test.SummaryResult.Pass {
+			passes++
+		}
+	}
+	return passes
+}
+
+// JUnit XML report.
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr,omitempty"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	TestCases  []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnitReport writes a JUnit XML report. There is one <testsuite> element for
+// each hive test suite and client, containing the tests which used the client. Tests
+// without clients are in a separate <testsuite>.
+func writeJUnitReport(w io.Writer, logdir string, suites []*TestSuite) error {
+	report := junitTestSuites{Name: "hive"}
+	for _, suite := range suites {
+		byClient := make(map[string][]*TestCase)
+		for _, test := range sortedTests(suite) {
+			clients := testClientNames(test)
+			if len(clients) == 0 {
+				clients = []string{""}
+			}
+			for _, client := range clients {
+				byClient[client] = append(byClient[client], test)
+			}
+		}
+		clients := make([]string, 0, len(byClient))
+		for client := range byClient {
+			clients = append(clients, client)
+		}
+		sort.Strings(clients)
+
+		for _, client := range clients {
+			js := junitTestSuite{Name: suite.Name}
+			if client != "" {
+				js.Name += " (" + client + ")"
+				js.Properties = append(js.Properties, junitProperty{"client", client})
+				if version, ok := suite.ClientVersions[client]; ok {
+					js.Properties = append(js.Properties, junitProperty{"version", version})
+				}
+			}
+			var duration float64
+			for _, test := range byClient[client] {
+				tc := junitTestCase{
+					Name:      test.Name,
+					ClassName: suite.Name,
+					Time:      fmt.Sprintf("%.3f", testDuration(test)),
+					SystemOut: junitClientLogs(logdir, test, client),
+				}
+				if !test.SummaryResult.Pass {
+					msg := strings.SplitN(test.SummaryResult.Details, "\n", 2)[0]
+					text := test.SummaryResult.Details + junitLogExcerpts(test, client)
+					tc.Failure = &junitFailure{Message: msg, Text: text}
+					js.Failures++
+				}
+				if js.Timestamp == "" && !test.Start.IsZero() {
+					js.Timestamp = test.Start.UTC().Format("2006-01-02T15:04:05")
+				}
+				duration += testDuration(test)
+				js.Tests++
+				js.TestCases = append(js.TestCases, tc)
+			}
+			js.Time = fmt.Sprintf("%.3f", duration)
+			report.Tests += js.Tests
+			report.Failures += js.Failures
+			report.Suites = append(report.Suites, js)
+		}
+	}
+
+	io.WriteString(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(&report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// junitClientLogs returns the output of the test's instances of the given client.
+// Only the end of large logs is included.
+func junitClientLogs(logdir string, test *TestCase, client string) string {
+	ids := make([]string, 0, len(test.ClientInfo))
+	for id, info := range test.ClientInfo {
+		if info.Name == client && info.LogFile != "" {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	var out strings.Builder
+	for _, id := range ids {
+		info := test.ClientInfo[id]
+		fmt.Fprintf(&out, "--- %s (%s): %s\n", info.Name, id, info.LogFile)
+		out.WriteString(readFileTail(filepath.Join(logdir, filepath.FromSlash(info.LogFile)), reportLogLimit))
+	}
+	return out.String()
+}
+
+// junitLogExcerpts returns the log excerpts of the test's instances of the given client.
+func junitLogExcerpts(test *TestCase, client string) string {
+	ids := make([]string, 0, len(test.ClientInfo))
+	for id, info := range test.ClientInfo {
+		if info.Name == client && len(info.LogExcerpt) > 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	var out strings.Builder
+	for _, id := range ids {
+		info := test.ClientInfo[id]
+		fmt.Fprintf(&out, "\n\n--- log excerpt of %s (%s):\n", info.Name, id)
+		out.WriteString(strings.Join(info.LogExcerpt, "\n"))
+	}
+	return out.String()
+}
+
+// readFileTail reads up to limit bytes from the end of a file.
+func readFileTail(file string, limit int64) string {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Sprintf("(can't read log: %v)\n", err)
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return fmt.Sprintf("(can't read log: %v)\n", err)
+	}
+	var prefix string
+	if stat.Size() > limit {
+		f.Seek(stat.Size()-limit, io.SeekStart)
+		prefix = fmt.Sprintf("(%d bytes omitted)\n", stat.Size()-limit)
+	}
+	content, _ := io.ReadAll(f)
+	return prefix + strings.ToValidUTF8(string(content), "�")
+}
+
+// TAP report.
+
+// writeTAPReport writes a report in Test Anything Protocol version 13.
+func writeTAPReport(w io.Writer, suites []*TestSuite) {
+	var total int
+	for _, suite := range suites {
+		total += len(suite.TestCases)
+	}
+	fmt.Fprintf(w, "TAP version 13\n1..%d\n", total)
+	n := 0
+	for _, suite := range suites {
+		for _, test := range sortedTests(suite) {
+			n++
+			status := "ok"
+			if !test.SummaryResult.Pass {
+				status = "not ok"
+			}
+			desc := tapEscape(suite.Name + " / " + test.Name)
+			if clients := testClientNames(test); len(clients) > 0 {
+				desc += " [" + strings.Join(clients, ",") + "]"
+			}
+			fmt.Fprintf(w, "%s %d - %s\n", status, n, desc)
+			if !test.SummaryResult.Pass && test.SummaryResult.Details != "" {
+				fmt.Fprintf(w, "  ---\n  details: |\n")
+				for _, line := range strings.Split(strings.TrimRight(test.SummaryResult.Details, "\n"), "\n") {
+					fmt.Fprintf(w, "    %s\n", line)
+				}
+				fmt.Fprintf(w, "  ...\n")
+			}
+		}
+	}
+}
+
+// tapEscape escapes characters which have special meaning in TAP test descriptions.
+func tapEscape(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "#", "\\#")
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+// Markdown report.
+
+// writeMarkdownReport writes a summary of the results, for posting on pull requests.
+func writeMarkdownReport(w io.Writer, suites []*TestSuite) {
+	var total, passes int
+	for _, suite := range suites {
+		tests := sortedTests(suite)
+		total += len(tests)
+		passes += countPasses(tests)
+	}
+	fmt.Fprintf(w, "## Hive results\n\n")
+	fmt.Fprintf(w, "%d of %d tests passed", passes, total)
+	if total > passes {
+		fmt.Fprintf(w, ", **%d failed**", total-passes)
+	}
+	fmt.Fprintf(w, ".\n\n")
+
+	// Client versions.
+	versions := make(map[string]string)
+	for _, suite := range suites {
+		for client, version := range suite.ClientVersions {
+			versions[client] = version
+		}
+	}
+	if len(versions) > 0 {
+		clients := make([]string, 0, len(versions))
+		for client := range versions {
+			clients = append(clients, client)
+		}
+		sort.Strings(clients)
+		fmt.Fprintf(w, "| Client | Version |\n| --- | --- |\n")
+		for _, client := range clients {
+			fmt.Fprintf(w, "| %s | %s |\n", markdownEscape(client), markdownEscape(strings.TrimSpace(versions[client])))
+		}
+		fmt.Fprintf(w, "\n")
+	}
+
+	// Suites.
+	fmt.Fprintf(w, "| Suite | Tests | Passed | Failed |\n| --- | ---: | ---: | ---: |\n")
+	for _, suite := range suites {
+		tests := sortedTests(suite)
+		p := countPasses(tests)
+		fmt.Fprintf(w, "| %s | %d | %d | %d |\n", markdownEscape(suite.Name), len(tests), p, len(tests)-p)
+	}
+
+	// Failures.
+	if total == passes {
+		return
+	}
+	fmt.Fprintf(w, "\n### Failures\n\n")
+	listed := 0
+	for _, suite := range suites {
+		for _, test := range sortedTests(suite) {
+			if test.SummaryResult.Pass {
+				continue
+			}
+			if listed == reportFailuresLimit {
+				fmt.Fprintf(w, "... and %d more failures.\n", total-passes-listed)
+				return
+			}
+			listed++
+			title := suite.Name + " / " + test.Name
+			if clients := testClientNames(test); len(clients) > 0 {
+				title += " (" + strings.Join(clients, ", ") + ")"
+			}
+			details := test.SummaryResult.Details
+			if len(details) > reportDetailsLimit {
+				details = details[:reportDetailsLimit] + "\n..."
+			}
+			details = strings.ReplaceAll(details, "```", "'''")
+			fmt.Fprintf(w, "<details><summary>%s</summary>\n\n```\n%s\n```\n</details>\n\n", htmlEscape(title), strings.TrimRight(details, "\n"))
+		}
+	}
+}
+
+func markdownEscape(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+func htmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// JSON summary.
+
+type jsonSummary struct {
+	Tests          int                `json:"tests"`
+	Passes         int                `json:"passes"`
+	Fails          int                `json:"fails"`
+	ClientVersions map[string]string  `json:"clientVersions"`
+	Suites         []jsonSuiteSummary `json:"suites"`
+}
+
+type jsonSuiteSummary struct {
+	Name         string            `json:"name"`
+	SimulatorLog string            `json:"simLog"`
+	Tests        int               `json:"tests"`
+	Passes       int               `json:"passes"`
+	Fails        int               `json:"fails"`
+	Failures     []jsonTestFailure `json:"failures"`
+}
+
+type jsonTestFailure struct {
+	ID      TestID   `json:"id"`
+	Name    string   `json:"name"`
+	Clients []string `json:"clients"`
+	Details string   `json:"details"`
+}
+
+// writeJSONSummary writes the test counts and failures of all suites as JSON.
+func writeJSONSummary(w io.Writer, suites []*TestSuite) error {
+	summary := jsonSummary{ClientVersions: make(map[string]string), Suites: []jsonSuiteSummary{}}
+	for _, suite := range suites {
+		s := jsonSuiteSummary{Name: suite.Name, SimulatorLog: suite.SimulatorLog, Failures: []jsonTestFailure{}}
+		ids := make([]TestID, 0, len(suite.TestCases))
+		for id := range suite.TestCases {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		for _, id := range ids {
+			test := suite.TestCases[id]
+			s.Tests++
+			if test.SummaryResult.Pass {
+				s.Passes++
+				continue
+			}
+			s.Fails++
+			clients := testClientNames(test)
+			if clients == nil {
+				clients = []string{}
+			}
+			s.Failures = append(s.Failures, jsonTestFailure{
+				ID:      id,
+				Name:    test.Name,
+				Clients: clients,
+				Details: test.SummaryResult.Details,
+			})
+		}
+		for client, version := range suite.ClientVersions {
+			summary.ClientVersions[client] = version
+		}
+		summary.Tests += s.Tests
+		summary.Passes += s.Passes
+		summary.Fails += s.Fails
+		summary.Suites = append(summary.Suites, s)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(&summary)
+}
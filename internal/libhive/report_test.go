@@ -0,0 +1,169 @@
+package libhive_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/hive/internal/libhive"
+)
+
+func TestWriteReports(t *testing.T) {
+	logdir := t.TempDir()
+	os.MkdirAll(filepath.Join(logdir, "client-1"), 0755)
+	os.WriteFile(filepath.Join(logdir, "client-1", "c1.log"), []byte("client-1 output\n"), 0644)
+
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	suites := []*libhive.TestSuite{{
+		ID:             0,
+		Name:           "suite",
+		ClientVersions: map[string]string{"client-1": "v1", "client-2": "v2"},
+		SimulatorLog:   "sim.log",
+		TestCases: map[libhive.TestID]*libhive.TestCase{
+			1: {
+				Name:          "pass",
+				Start:         start,
+				End:           start.Add(time.Second),
+				SummaryResult: libhive.TestResult{Pass: true},
+				ClientInfo: map[string]*libhive.ClientInfo{
+					"c1": {ID: "c1", Name: "client-1", LogFile: "client-1/c1.log"},
+					"c2": {ID: "c2", Name: "client-2"},
+				},
+			},
+			2: {
+				Name:          "fail",
+				Start:         start,
+				End:           start.Add(2 * time.Second),
+				SummaryResult: libhive.TestResult{Pass: false, Details: "it broke\nbadly"},
+				ClientInfo: map[string]*libhive.ClientInfo{
+					"c3": {ID: "c3", Name: "client-2", LogExcerpt: []string{"ERROR something bad"}},
+				},
+			},
+			3: {
+				Name:          "no clients",
+				SummaryResult: libhive.TestResult{Pass: true},
+			},
+		},
+	}}
+
+	formats, err := libhive.ParseReportFormats("junit, tap,markdown,json-summary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := libhive.WriteReports(logdir, "manifests/1-abc.json", suites, formats)
+	if err != nil {
+		t.Fatal("WriteReports failed:", err)
+	}
+	wantFiles := []string{
+		"reports/1-abc/junit.xml",
+		"reports/1-abc/results.tap",
+		"reports/1-abc/summary.md",
+		"reports/1-abc/summary.json",
+	}
+	if strings.Join(files, " ") != strings.Join(wantFiles, " ") {
+		t.Fatalf("wrong report files %v", files)
+	}
+	read := func(file string) []byte {
+		content, err := os.ReadFile(filepath.Join(logdir, filepath.FromSlash(file)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return content
+	}
+
+	// Check JUnit.
+	var junit struct {
+		Tests    int `xml:"tests,attr"`
+		Failures int `xml:"failures,attr"`
+		Suites   []struct {
+			Name       string `xml:"name,attr"`
+			Properties []struct {
+				Name  string `xml:"name,attr"`
+				Value string `xml:"value,attr"`
+			} `xml:"properties>property"`
+			TestCases []struct {
+				Name      string `xml:"name,attr"`
+				SystemOut string `xml:"system-out"`
+				Failure   string `xml:"failure"`
+			} `xml:"testcase"`
+		} `xml:"testsuite"`
+	}
+	if err := xml.Unmarshal(read(files[0]), &junit); err != nil {
+		t.Fatal("invalid JUnit XML:", err)
+	}
+	if junit.Tests != 4 || junit.Failures != 1 {
+		t.Errorf("wrong JUnit counts: tests %d, failures %d", junit.Tests, junit.Failures)
+	}
+	var suiteNames []string
+	for _, s := range junit.Suites {
+		suiteNames = append(suiteNames, s.Name)
+	}
+	if strings.Join(suiteNames, ",") != "suite,suite (client-1),suite (client-2)" {
+		t.Errorf("wrong JUnit suites: %q", suiteNames)
+	}
+	if props := junit.Suites[1].Properties; len(props) != 2 || props[1].Value != "v1" {
+		t.Errorf("wrong properties in %q: %v", junit.Suites[1].Name, props)
+	}
+	if out := junit.Suites[1].TestCases[0].SystemOut; !strings.Contains(out, "client-1 output") {
+		t.Errorf("client log missing in system-out: %q", out)
+	}
+
+	if failure := junit.Suites[2].TestCases[1].Failure; !strings.Contains(failure, "ERROR something bad") {
+		t.Errorf("log excerpt missing in failure: %q", failure)
+	}
+
+	// Check TAP.
+	wantTAP := `TAP version 13
+1..3
+ok 1 - suite / pass [client-1,client-2]
+not ok 2 - suite / fail [client-2]
+  ---
+  details: |
+    it broke
+    badly
+  ...
+ok 3 - suite / no clients
+`
+	if tap := string(read(files[1])); tap != wantTAP {
+		t.Errorf("wrong TAP output:\n%s", tap)
+	}
+
+	// Check Markdown.
+	md := string(read(files[2]))
+	for _, want := range []string{"2 of 3 tests passed", "| client-1 | v1 |", "| suite | 3 | 2 | 1 |", "suite / fail (client-2)"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Markdown summary does not contain %q:\n%s", want, md)
+		}
+	}
+
+	// Check JSON summary.
+	var summary struct {
+		Tests, Passes, Fails int
+		Suites               []struct {
+			Failures []struct{ Name string }
+		}
+	}
+	if err := json.Unmarshal(read(files[3]), &summary); err != nil {
+		t.Fatal("invalid JSON summary:", err)
+	}
+	if summary.Tests != 3 || summary.Passes != 2 || summary.Fails != 1 {
+		t.Errorf("wrong JSON summary counts: %+v", summary)
+	}
+	if len(summary.Suites) != 1 || len(summary.Suites[0].Failures) != 1 || summary.Suites[0].Failures[0].Name != "fail" {
+		t.Errorf("wrong failures in JSON summary: %+v", summary.Suites)
+	}
+}
+
+func TestParseReportFormats(t *testing.T) {
+	if _, err := libhive.ParseReportFormats("junit,html"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+	formats, err := libhive.ParseReportFormats("")
+	if err != nil || len(formats) != 0 {
+		t.Errorf("wrong result for empty list: %v, %v", formats, err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -17,7 +18,6 @@ import (
 
 var (
 	errSimInterrupt = errors.New("simulation interrupted")
-	errSimTimeout   = errors.New("simulation timed out")
 )
 
 // Runner executes a simulation runs.
@@ -162,6 +162,7 @@ HIVE_SIMULATOR=http://%v
 // run runs one simulation.
 func (r *Runner) run(ctx context.Context, sim string, env SimEnv) (SimResult, error) {
 	log15.Info(fmt.Sprintf("running simulation: %s", sim))
+	env.LiveFeed.Send(LiveEvent{Time: time.Now(), Type: LiveSimStart, Simulator: sim})
 
 	clientDefs := make(map[string]*ClientDefinition)
 	if env.ClientList == nil {
@@ -219,12 +220,18 @@ func (r *Runner) run(ctx context.Context, sim string, env SimEnv) (SimResult, er
 	if err != nil {
 		return SimResult{}, err
 	}
+	simStart := time.Now()
 	slogger := log15.New("sim", sim, "container", sc.ID[:8])
 	slogger.Debug("started simulator container")
-	defer func() {
-		slogger.Debug("deleting simulator container")
-		r.container.DeleteContainer(sc.ID)
-	}()
+	simDeleted := false
+	deleteSim := func() {
+		if !simDeleted {
+			slogger.Debug("deleting simulator container")
+			r.container.DeleteContainer(sc.ID)
+			simDeleted = true
+		}
+	}
+	defer deleteSim()
 
 	// Wait for simulator exit.
 	done := make(chan struct{})
@@ -242,19 +249,60 @@ func (r *Runner) run(ctx context.Context, sim string, env SimEnv) (SimResult, er
 	}
 
 	// Wait for simulation to end.
+	var failure string
 	select {
 	case <-done:
+		if exit, err := r.container.InspectExit(sc.ID); err != nil {
+			slogger.Error("can't get simulator exit status", "err", err)
+		} else if exit.ExitCode != 0 {
+			failure = fmt.Sprintf("simulator exited with exit code %d", exit.ExitCode)
+			if exit.OOMKilled {
+				failure += " (killed: out of memory)"
+			}
+		}
 	case <-timeout:
 		slogger.Info("simulation timed out")
-		err = errSimTimeout
+		failure = fmt.Sprintf("simulation timed out after %v", env.SimDurationLimit)
+		// Stop the simulator, so it can't end suites while they are being finished.
+		deleteSim()
 	case <-ctx.Done():
 		slogger.Info("interrupted, shutting down")
 		err = errSimInterrupt
 	}
+	if failure != "" {
+		slogger.Warn("simulation failed", "reason", failure)
+	}
+
+	// Report failures and unended suites. When the run was interrupted, running
+	// tests are ended as terminated, and no failure is added to the suites.
+	if err == errSimInterrupt {
+		if terr := tm.Terminate(); terr != nil {
+			slogger.Error("could not terminate test suites", "err", terr)
+		}
+	} else if ferr := tm.FinishSimulation(sim, failure); ferr != nil {
+		slogger.Error("could not finish test suites", "err", ferr)
+	}
+	pass := failure == ""
+	simResult := "pass"
+	switch {
+	case err == errSimInterrupt:
+		simResult = "interrupted"
+	case !pass:
+		simResult = "fail"
+	}
+	metricSimulations.WithLabelValues(sim, simResult).Inc()
+	metricSimulationDuration.WithLabelValues(sim).Observe(time.Since(simStart).Seconds())
+	env.LiveFeed.Send(LiveEvent{Time: time.Now(), Type: LiveSimEnd, Simulator: sim, Details: failure, Pass: &pass})
 
 	// Count the results.
 	var result SimResult
 	for _, suite := range tm.Results() {
+		result.TestSuites = append(result.TestSuites, suite)
+	}
+	sort.Slice(result.TestSuites, func(i, j int) bool {
+		return result.TestSuites[i].ID < result.TestSuites[j].ID
+	})
+	for _, suite := range result.TestSuites {
 		var suiteFailCounted bool
 		result.Suites++
 		for _, test := range suite.TestCases {
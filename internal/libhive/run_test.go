@@ -2,10 +2,14 @@ package libhive_test
 
 import (
 	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ethereum/hive/hivesim"
 	"github.com/ethereum/hive/internal/fakes"
@@ -35,6 +39,8 @@ func TestRunner(t *testing.T) {
 				if names := clientNames(defs); !reflect.DeepEqual(names, simClients) {
 					t.Fatal("wrong client names:", names)
 				}
+				// The simulator is done.
+				return &libhive.ContainerInfo{Wait: func() {}}, nil
 			}
 			return new(libhive.ContainerInfo), nil
 		},
@@ -71,3 +77,270 @@ func clientNames(defs []*hivesim.ClientDefinition) []string {
 	sort.Strings(names)
 	return names
 }
+
+func TestRunnerManifest(t *testing.T) {
+	var (
+		allClients = []string{"client-1", "client-2"}
+		simList    = []string{"sim-1"}
+		ctx        = context.Background()
+		logdir     = t.TempDir()
+	)
+
+	inv := makeTestInventory()
+	b := fakes.NewBuilder(&fakes.BuilderHooks{})
+	runner := libhive.NewRunner(inv, b, fakes.NewContainerBackend(nil))
+	if err := runner.Build(ctx, allClients, simList); err != nil {
+		t.Fatal("Build() failed:", err)
+	}
+	m, err := runner.Manifest(ctx)
+	if err != nil {
+		t.Fatal("Manifest() failed:", err)
+	}
+	m.Args = []string{"--sim=sim-1"}
+	if len(m.Clients) != 2 || len(m.Simulators) != 1 {
+		t.Fatalf("wrong manifest images: %+v", m)
+	}
+
+	// Store and reload the manifest.
+	file, err := libhive.WriteRunManifest(logdir, m)
+	if err != nil {
+		t.Fatal("WriteRunManifest() failed:", err)
+	}
+	loaded, err := libhive.LoadRunManifest(filepath.Join(logdir, file))
+	if err != nil {
+		t.Fatal("LoadRunManifest() failed:", err)
+	}
+	if !reflect.DeepEqual(loaded.Clients, m.Clients) || !reflect.DeepEqual(loaded.Args, m.Args) {
+		t.Fatalf("loaded manifest differs:\nhave %+v\nwant %+v", loaded, m)
+	}
+
+	// Run the simulation from the manifest. It should use the recorded image IDs.
+	var simImage string
+	cb := fakes.NewContainerBackend(&fakes.BackendHooks{
+		StartContainer: func(image, containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
+			simImage = image
+			return &libhive.ContainerInfo{Wait: func() {}}, nil
+		},
+	})
+	runner2 := libhive.NewRunner(inv, b, cb)
+	if err := runner2.UseManifest(ctx, loaded); err != nil {
+		t.Fatal("UseManifest() failed:", err)
+	}
+	env := libhive.SimEnv{LogDir: logdir, ClientList: allClients, RunManifest: file}
+	if _, err := runner2.Run(ctx, "sim-1", env); err != nil {
+		t.Fatal("Run() failed:", err)
+	}
+	if simImage != m.Simulators[0].ImageID {
+		t.Fatalf("simulator started with image %q, want %q", simImage, m.Simulators[0].ImageID)
+	}
+}
+
+func TestRunnerSimulatorFailure(t *testing.T) {
+	tests := []struct {
+		name        string
+		exitCode    int
+		startSuite  bool
+		wantSuite   string
+		wantTests   int
+		wantFailed  int
+		wantDetails string
+	}{
+		{
+			name:        "crash",
+			exitCode:    2,
+			wantSuite:   "sim-1",
+			wantTests:   1,
+			wantFailed:  1,
+			wantDetails: "The simulator failed: simulator exited with exit code 2.\nlast 2 lines of simulator output:\npanic: oops\ngoroutine 1 [running]:",
+		},
+		{
+			name:        "unended-suite",
+			exitCode:    0,
+			startSuite:  true,
+			wantSuite:   "suite",
+			wantTests:   2,
+			wantFailed:  2,
+			wantDetails: "The simulator exited without ending the test suite.\nlast 2 lines of simulator output:\npanic: oops\ngoroutine 1 [running]:",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var simID string
+			cb := fakes.NewContainerBackend(&fakes.BackendHooks{
+				StartContainer: func(image, containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
+					if strings.Contains(image, "/simulator/") {
+						simID = containerID
+						if test.startSuite {
+							sim := hivesim.NewAt(opt.Env["HIVE_SIMULATOR"])
+							suite, err := sim.StartSuite("suite", "", "")
+							if err != nil {
+								t.Fatal("can't start suite:", err)
+							}
+							if _, err := sim.StartTest(suite, "test", ""); err != nil {
+								t.Fatal("can't start test:", err)
+							}
+						}
+						os.WriteFile(opt.LogFile, []byte("panic: oops\ngoroutine 1 [running]:\n"), 0644)
+						return &libhive.ContainerInfo{Wait: func() {}}, nil
+					}
+					return new(libhive.ContainerInfo), nil
+				},
+				InspectExit: func(containerID string) (*libhive.ExitInfo, error) {
+					if containerID != simID {
+						t.Errorf("InspectExit called for container %s", containerID)
+					}
+					return &libhive.ExitInfo{ExitCode: test.exitCode}, nil
+				},
+			})
+
+			var (
+				inv    = makeTestInventory()
+				runner = libhive.NewRunner(inv, fakes.NewBuilder(nil), cb)
+				logdir = t.TempDir()
+				ctx    = context.Background()
+			)
+			if err := runner.Build(ctx, []string{"client-1"}, []string{"sim-1"}); err != nil {
+				t.Fatal("Build() failed:", err)
+			}
+			result, err := runner.Run(ctx, "sim-1", libhive.SimEnv{LogDir: logdir})
+			if err != nil {
+				t.Fatal("Run() failed:", err)
+			}
+			if result.Suites != 1 || result.Tests != test.wantTests || result.TestsFailed != test.wantFailed {
+				t.Fatalf("wrong result %+v", result)
+			}
+
+			// Check the suite file.
+			files, _ := filepath.Glob(filepath.Join(logdir, "*.json"))
+			if len(files) != 1 {
+				t.Fatalf("expected one suite file, found %v", files)
+			}
+			data, _ := os.ReadFile(files[0])
+			var suite libhive.TestSuite
+			if err := json.Unmarshal(data, &suite); err != nil {
+				t.Fatal("invalid suite file:", err)
+			}
+			if suite.Name != test.wantSuite {
+				t.Errorf("wrong suite name %q", suite.Name)
+			}
+			var found bool
+			for _, tc := range suite.TestCases {
+				if tc.SummaryResult.Details == test.wantDetails {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("no test case with failure details %q", test.wantDetails)
+			}
+		})
+	}
+}
+
+// This test checks that interrupted runs don't report simulator failures.
+func TestRunnerInterrupt(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cb := fakes.NewContainerBackend(&fakes.BackendHooks{
+		StartContainer: func(image, containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
+			if strings.Contains(image, "/simulator/") {
+				startSuiteAndTest(t, opt.Env["HIVE_SIMULATOR"])
+				cancel()
+			}
+			// The containers run until they are deleted.
+			return new(libhive.ContainerInfo), nil
+		},
+	})
+	runner := libhive.NewRunner(makeTestInventory(), fakes.NewBuilder(nil), cb)
+	if err := runner.Build(context.Background(), []string{"client-1"}, []string{"sim-1"}); err != nil {
+		t.Fatal("Build() failed:", err)
+	}
+	logdir := t.TempDir()
+	result, err := runner.Run(ctx, "sim-1", libhive.SimEnv{LogDir: logdir})
+	if err == nil {
+		t.Fatal("Run() succeeded for interrupted run")
+	}
+	if result.Suites != 1 || result.Tests != 1 {
+		t.Fatalf("wrong result %+v", result)
+	}
+	suite := readSuiteFile(t, logdir)
+	for _, tc := range suite.TestCases {
+		if tc.Name != "test" {
+			t.Errorf("unexpected test case %q in interrupted suite", tc.Name)
+		}
+	}
+}
+
+// This test checks that the simulator is stopped before the suites are finished
+// when the simulation times out.
+func TestRunnerTimeout(t *testing.T) {
+	var (
+		logdir     = t.TempDir()
+		simID      string
+		suiteFiles []string
+	)
+	cb := fakes.NewContainerBackend(&fakes.BackendHooks{
+		StartContainer: func(image, containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
+			if strings.Contains(image, "/simulator/") {
+				simID = containerID
+				startSuiteAndTest(t, opt.Env["HIVE_SIMULATOR"])
+			}
+			return new(libhive.ContainerInfo), nil
+		},
+		DeleteContainer: func(containerID string) error {
+			if containerID == simID {
+				suiteFiles, _ = filepath.Glob(filepath.Join(logdir, "*.json"))
+			}
+			return nil
+		},
+	})
+	runner := libhive.NewRunner(makeTestInventory(), fakes.NewBuilder(nil), cb)
+	ctx := context.Background()
+	if err := runner.Build(ctx, []string{"client-1"}, []string{"sim-1"}); err != nil {
+		t.Fatal("Build() failed:", err)
+	}
+	env := libhive.SimEnv{LogDir: logdir, SimDurationLimit: 100 * time.Millisecond}
+	result, err := runner.Run(ctx, "sim-1", env)
+	if err != nil {
+		t.Fatal("Run() failed:", err)
+	}
+	if len(suiteFiles) != 0 {
+		t.Fatal("suite was written before the simulator was stopped")
+	}
+	if result.Suites != 1 || result.Tests != 2 || result.TestsFailed != 2 {
+		t.Fatalf("wrong result %+v", result)
+	}
+	suite := readSuiteFile(t, logdir)
+	var found bool
+	for _, tc := range suite.TestCases {
+		if tc.Name == "simulator failure" && strings.HasPrefix(tc.SummaryResult.Details, "The simulator failed: simulation timed out after 100ms.") {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("no simulator failure reported")
+	}
+}
+
+func startSuiteAndTest(t *testing.T, url string) {
+	sim := hivesim.NewAt(url)
+	suite, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	if _, err := sim.StartTest(suite, "test", ""); err != nil {
+		t.Fatal("can't start test:", err)
+	}
+}
+
+func readSuiteFile(t *testing.T, logdir string) *libhive.TestSuite {
+	files, _ := filepath.Glob(filepath.Join(logdir, "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("expected one suite file, found %v", files)
+	}
+	data, _ := os.ReadFile(files[0])
+	var suite libhive.TestSuite
+	if err := json.Unmarshal(data, &suite); err != nil {
+		t.Fatal("invalid suite file:", err)
+	}
+	return &suite
+}
@@ -5,13 +5,19 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/ethereum/hive/internal/simapi"
 	"gopkg.in/inconshreveable/log15.v2"
 )
 
@@ -26,6 +32,9 @@ var (
 	ErrNoSummaryResult          = errors.New("test case must be ended with a summary result")
 	ErrDBUpdateFailed           = errors.New("could not update results set")
 	ErrTestSuiteLimited         = errors.New("testsuite test count is limited")
+	ErrNoArtifactStorage        = errors.New("artifact storage is not available without log directory")
+	ErrInvalidArtifactName      = errors.New("invalid artifact name")
+	ErrDuplicateAlias           = errors.New("network alias is already in use")
 )
 
 // SimEnv contains the simulation parameters.
@@ -48,6 +57,29 @@ type SimEnv struct {
 	// This configures the amount of time the simulation waits
 	// for the client to open port 8545 after launching the container.
 	ClientStartTimeout time.Duration
+
+	// This is the path of the run manifest, relative to LogDir.
+	RunManifest string
+
+	// These limit the client containers running at the same time. Client start
+	// requests beyond the limits are queued until a running client exits.
+	// ClientMemoryLimit is the memory limit of each client container in bytes.
+	// ClientMemoryBudget is the total memory limit of all running clients, and
+	// can only be enforced when ClientMemoryLimit is set. Zero means unlimited.
+	ClientLimit        int
+	ClientMemoryLimit  int64
+	ClientMemoryBudget int64
+
+	// This is the max time a client start request waits for the client limits.
+	// Zero means there is no timeout.
+	ClientQueueTimeout time.Duration
+
+	// This is the number of trailing client log lines included in the log excerpts
+	// of failed tests. Zero disables log excerpts.
+	ClientLogExcerptLines int
+
+	// LiveFeed receives events of the simulation as they happen. This can be nil.
+	LiveFeed *LiveFeed
 }
 
 // SimResult summarizes the results of a simulation run.
@@ -56,6 +88,8 @@ type SimResult struct {
 	SuitesFailed int
 	Tests        int
 	TestsFailed  int
+
+	TestSuites []*TestSuite // results of all suites, ordered by ID
 }
 
 // TestManager collects test results during a simulation run.
@@ -72,13 +106,31 @@ type TestManager struct {
 	networks     map[TestSuiteID]map[string]string
 	networkMutex sync.RWMutex
 
+	// DNS aliases of containers in networks, mapped to the container ID.
+	// Aliases must be unique per network, since docker resolves a name
+	// used by multiple containers to any of them.
+	aliases    map[networkAlias]string
+	aliasMutex sync.Mutex
+
 	testCaseMutex     sync.RWMutex
 	testSuiteMutex    sync.RWMutex
 	runningTestSuites map[TestSuiteID]*TestSuite
-	runningTestCases  map[TestID]*TestCase
+	runningTestCases  map[TestID]*runningTest
+	endingTestCases   map[TestID]*runningTest
 	testSuiteCounter  uint32
 	testCaseCounter   uint32
 	results           map[TestSuiteID]*TestSuite
+
+	// crashMutex protects client exit state, i.e. ClientInfo.stopping and ClientInfo.Crash.
+	// crashNotify is closed and replaced when a client crashes or a test ends.
+	crashMutex  sync.Mutex
+	crashNotify chan struct{}
+
+	// eventMutex protects TestCase.Events.
+	eventMutex sync.Mutex
+
+	// clientLimiter enforces the limits on running client containers.
+	clientLimiter *clientLimiter
 }
 
 func NewTestManager(config SimEnv, b ContainerBackend, clients map[string]*ClientDefinition) *TestManager {
@@ -87,12 +139,25 @@ func NewTestManager(config SimEnv, b ContainerBackend, clients map[string]*Clien
 		config:            config,
 		backend:           b,
 		runningTestSuites: make(map[TestSuiteID]*TestSuite),
-		runningTestCases:  make(map[TestID]*TestCase),
+		runningTestCases:  make(map[TestID]*runningTest),
+		endingTestCases:   make(map[TestID]*runningTest),
 		results:           make(map[TestSuiteID]*TestSuite),
 		networks:          make(map[TestSuiteID]map[string]string),
+		aliases:           make(map[networkAlias]string),
+		crashNotify:       make(chan struct{}),
+		clientLimiter:     newClientLimiter(config.ClientLimit, config.ClientMemoryBudget),
 	}
 }
 
+// runningTest is a test case which has not ended yet. It holds the IDs of the test,
+// which are needed for live events and metrics.
+type runningTest struct {
+	*TestCase
+	suite     TestSuiteID
+	suiteName string
+	id        TestID
+}
+
 // SetSimContainerInfo makes the manager aware of the simulation container.
 // This must be called after creating the simulation container, but before starting it.
 func (manager *TestManager) SetSimContainerInfo(id, logFile string) {
@@ -100,6 +165,18 @@ func (manager *TestManager) SetSimContainerInfo(id, logFile string) {
 	manager.simLogFile = logFile
 }
 
+// simLogSize returns the current size of the simulator log file.
+func (manager *TestManager) simLogSize() (int64, bool) {
+	if manager.simLogFile == "" || manager.config.LogDir == "" {
+		return 0, false
+	}
+	stat, err := os.Stat(filepath.Join(manager.config.LogDir, filepath.FromSlash(manager.simLogFile)))
+	if err != nil {
+		return 0, false
+	}
+	return stat.Size(), true
+}
+
 // Results returns the results for all suites that have already ended.
 func (manager *TestManager) Results() map[TestSuiteID]*TestSuite {
 	manager.testSuiteMutex.RLock()
@@ -131,17 +208,29 @@ func (manager *TestManager) IsTestRunning(test TestID) (*TestCase, bool) {
 	manager.testCaseMutex.RLock()
 	defer manager.testCaseMutex.RUnlock()
 	testCase, ok := manager.runningTestCases[test]
-	return testCase, ok
+	if !ok {
+		return nil, false
+	}
+	return testCase.TestCase, true
 }
 
 // Terminate forces the termination of any running tests with
 // an error message. This can be called as a cleanup method.
 // If there are no running tests, there is no effect.
 func (manager *TestManager) Terminate() error {
+	return manager.terminate("")
+}
+
+// terminate ends all running tests and suites. The reason is added to
+// the details of terminated tests.
+func (manager *TestManager) terminate(reason string) error {
 	terminationSummary := &TestResult{
 		Pass:    false,
 		Details: "Test was terminated by host",
 	}
+	if reason != "" {
+		terminationSummary.Details += ": " + reason
+	}
 	manager.testSuiteMutex.Lock()
 	defer manager.testSuiteMutex.Unlock()
 
@@ -180,7 +269,7 @@ func (manager *TestManager) GetNodeInfo(testSuite TestSuiteID, test TestID, node
 }
 
 // CreateNetwork creates a docker network with the given network name.
-func (manager *TestManager) CreateNetwork(testSuite TestSuiteID, name string) error {
+func (manager *TestManager) CreateNetwork(testSuite TestSuiteID, name string, opt simapi.NetworkOptions) error {
 	_, ok := manager.IsTestSuiteRunning(testSuite)
 	if !ok {
 		return ErrNoSuchTestSuite
@@ -190,7 +279,7 @@ func (manager *TestManager) CreateNetwork(testSuite TestSuiteID, name string) er
 	manager.networkMutex.Lock()
 	defer manager.networkMutex.Unlock()
 
-	id, err := manager.backend.CreateNetwork(getUniqueName(testSuite, name))
+	id, err := manager.backend.CreateNetwork(getUniqueName(testSuite, name), opt, suiteLabels(testSuite))
 	if err != nil {
 		return err
 	}
@@ -207,6 +296,11 @@ func getUniqueName(testSuite TestSuiteID, name string) string {
 	return fmt.Sprintf("hive_%d_%d_%s", os.Getpid(), testSuite, name)
 }
 
+// suiteLabels returns the labels of docker resources belonging to a test suite.
+func suiteLabels(testSuite TestSuiteID) map[string]string {
+	return map[string]string{LabelSuite: testSuite.String()}
+}
+
 // RemoveNetwork removes a docker network by the given network name.
 func (manager *TestManager) RemoveNetwork(testSuite TestSuiteID, network string) error {
 	manager.networkMutex.Lock()
@@ -221,6 +315,7 @@ func (manager *TestManager) RemoveNetwork(testSuite TestSuiteID, network string)
 		return err
 	}
 	delete(manager.networks[testSuite], network)
+	manager.releaseAliases("", id)
 	return nil
 }
 
@@ -242,6 +337,16 @@ func (manager *TestManager) PruneNetworks(testSuite TestSuiteID) []error {
 
 // ContainerIP gets the IP address of the given container on the given network.
 func (manager *TestManager) ContainerIP(testSuite TestSuiteID, networkName, containerID string) (string, error) {
+	return manager.containerAddr(testSuite, networkName, containerID, manager.backend.ContainerIP)
+}
+
+// ContainerIPv6 gets the global IPv6 address of the given container on the given
+// network. This fails if the network was not created with IPv6 enabled.
+func (manager *TestManager) ContainerIPv6(testSuite TestSuiteID, networkName, containerID string) (string, error) {
+	return manager.containerAddr(testSuite, networkName, containerID, manager.backend.ContainerIPv6)
+}
+
+func (manager *TestManager) containerAddr(testSuite TestSuiteID, networkName, containerID string, get func(containerID, networkID string) (net.IP, error)) (string, error) {
 	manager.networkMutex.RLock()
 	defer manager.networkMutex.RUnlock()
 
@@ -270,7 +375,7 @@ func (manager *TestManager) ContainerIP(testSuite TestSuiteID, networkName, cont
 		}
 	}
 
-	ipAddr, err := manager.backend.ContainerIP(containerID, networkID)
+	ipAddr, err := get(containerID, networkID)
 	if err != nil {
 		return "", err
 	}
@@ -278,7 +383,7 @@ func (manager *TestManager) ContainerIP(testSuite TestSuiteID, networkName, cont
 }
 
 // ConnectContainer connects the given container to the given network.
-func (manager *TestManager) ConnectContainer(testSuite TestSuiteID, networkName, containerID string) error {
+func (manager *TestManager) ConnectContainer(testSuite TestSuiteID, networkName, containerID string, aliases ...string) error {
 	manager.networkMutex.RLock()
 	defer manager.networkMutex.RUnlock()
 
@@ -286,15 +391,76 @@ func (manager *TestManager) ConnectContainer(testSuite TestSuiteID, networkName,
 	if !ok {
 		return ErrNoSuchTestSuite
 	}
-	if containerID == "simulation" {
-		containerID = manager.simContainerID
+	id := containerID
+	if id == "simulation" {
+		id = manager.simContainerID
 	}
 
 	networkID, exists := manager.networks[testSuite][networkName]
 	if !exists {
 		return ErrNetworkNotFound
 	}
-	return manager.backend.ConnectContainer(containerID, networkID)
+	if err := manager.reserveAliases(id, networkID, networkName, aliases); err != nil {
+		return err
+	}
+	if err := manager.backend.ConnectContainer(id, networkID, aliases...); err != nil {
+		manager.releaseAliases(id, networkID)
+		return err
+	}
+	ev := TestEvent{Time: time.Now(), Type: EventNetworkConnect, Client: containerID, Network: networkName}
+	if len(aliases) > 0 {
+		ev.Details = "aliases: " + strings.Join(aliases, ", ")
+	}
+	manager.recordContainerEvent(testSuite, containerID, ev)
+	return nil
+}
+
+// networkAlias is a DNS name in a network.
+type networkAlias struct {
+	networkID string
+	name      string
+}
+
+// reserveAliases registers the aliases of a container in a network. It fails if another
+// container uses one of the aliases in the network.
+func (manager *TestManager) reserveAliases(containerID, networkID, networkName string, aliases []string) error {
+	manager.aliasMutex.Lock()
+	defer manager.aliasMutex.Unlock()
+
+	containerID = shortContainerID(containerID)
+	for _, name := range aliases {
+		owner, ok := manager.aliases[networkAlias{networkID, name}]
+		if ok && owner != containerID {
+			return fmt.Errorf("%w: %q is used by container %s in network %s", ErrDuplicateAlias, name, owner, networkName)
+		}
+	}
+	for _, name := range aliases {
+		manager.aliases[networkAlias{networkID, name}] = containerID
+	}
+	return nil
+}
+
+// releaseAliases removes the aliases of a container. If networkID is empty, the
+// container's aliases in all networks are removed. If containerID is empty, all aliases
+// in the network are removed.
+func (manager *TestManager) releaseAliases(containerID, networkID string) {
+	manager.aliasMutex.Lock()
+	defer manager.aliasMutex.Unlock()
+
+	containerID = shortContainerID(containerID)
+	for alias, owner := range manager.aliases {
+		if (containerID == "" || owner == containerID) && (networkID == "" || alias.networkID == networkID) {
+			delete(manager.aliases, alias)
+		}
+	}
+}
+
+// shortContainerID returns the ID prefix which is used as the client ID.
+func shortContainerID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
 }
 
 // NetworkExists reports whether a network exists in the current test context.
@@ -315,15 +481,22 @@ func (manager *TestManager) DisconnectContainer(testSuite TestSuiteID, networkNa
 	if !ok {
 		return ErrNoSuchTestSuite
 	}
-	if containerID == "simulation" {
-		containerID = manager.simContainerID
+	id := containerID
+	if id == "simulation" {
+		id = manager.simContainerID
 	}
 
 	networkID, exists := manager.networks[testSuite][networkName]
 	if !exists {
 		return ErrNetworkNotFound
 	}
-	return manager.backend.DisconnectContainer(containerID, networkID)
+	if err := manager.backend.DisconnectContainer(id, networkID); err != nil {
+		return err
+	}
+	manager.releaseAliases(id, networkID)
+	ev := TestEvent{Time: time.Now(), Type: EventNetworkDisconnect, Client: containerID, Network: networkName}
+	manager.recordContainerEvent(testSuite, containerID, ev)
+	return nil
 }
 
 // EndTestSuite ends the test suite by writing the test suite results to the supplied
@@ -340,12 +513,16 @@ func (manager *TestManager) doEndSuite(testSuite TestSuiteID) error {
 		return ErrNoSuchTestSuite
 	}
 	// Check the suite has no running test cases.
+	manager.testCaseMutex.RLock()
 	for k := range suite.TestCases {
-		_, ok := manager.runningTestCases[k]
-		if ok {
+		_, running := manager.runningTestCases[k]
+		_, ending := manager.endingTestCases[k]
+		if running || ending {
+			manager.testCaseMutex.RUnlock()
 			return ErrTestSuiteRunning
 		}
 	}
+	manager.testCaseMutex.RUnlock()
 	// Write the result.
 	if manager.config.LogDir != "" {
 		err := writeSuiteFile(suite, manager.config.LogDir)
@@ -359,12 +536,47 @@ func (manager *TestManager) doEndSuite(testSuite TestSuiteID) error {
 			log15.Error("could not remove network", "err", err)
 		}
 	}
+	manager.removeLeftovers(testSuite)
 	// Move the suite to results.
 	delete(manager.runningTestSuites, testSuite)
 	manager.results[testSuite] = suite
+
+	pass := true
+	for _, test := range suite.TestCases {
+		pass = pass && test.SummaryResult.Pass
+	}
+	manager.config.LiveFeed.Send(LiveEvent{
+		Time:  time.Now(),
+		Type:  LiveSuiteEnd,
+		Suite: testSuite,
+		Name:  suite.Name,
+		Pass:  &pass,
+	})
 	return nil
 }
 
+// removeLeftovers checks that no containers or networks of an ended test suite
+// remain, and removes any that do.
+func (manager *TestManager) removeLeftovers(testSuite TestSuiteID) {
+	resources, err := manager.backend.ListResources(suiteLabels(testSuite))
+	if err != nil {
+		log15.Error("could not list test suite resources", "suite", testSuite, "err", err)
+		return
+	}
+	for _, r := range resources {
+		log15.Warn("removing left over "+r.Type, "suite", testSuite, "id", r.ID, "name", r.Name)
+		switch r.Type {
+		case ResourceContainer:
+			err = manager.backend.DeleteContainer(r.ID)
+		case ResourceNetwork:
+			err = manager.backend.RemoveNetwork(r.ID)
+		}
+		if err != nil {
+			log15.Error("could not remove left over "+r.Type, "id", r.ID, "err", err)
+		}
+	}
+}
+
 // StartTestSuite starts a test suite and returns the context id
 func (manager *TestManager) StartTestSuite(name string, description string) (TestSuiteID, error) {
 	manager.testSuiteMutex.Lock()
@@ -378,7 +590,14 @@ func (manager *TestManager) StartTestSuite(name string, description string) (Tes
 		ClientVersions: make(map[string]string),
 		TestCases:      make(map[TestID]*TestCase),
 		SimulatorLog:   manager.simLogFile,
+		RunManifest:    manager.config.RunManifest,
 	}
+	manager.config.LiveFeed.Send(LiveEvent{
+		Time:  time.Now(),
+		Type:  LiveSuiteStart,
+		Suite: newSuiteID,
+		Name:  name,
+	})
 	manager.testSuiteCounter++
 	return newSuiteID, nil
 }
@@ -402,47 +621,272 @@ func (manager *TestManager) StartTest(testSuiteID TestSuiteID, name string, desc
 		Description: description,
 		Start:       time.Now(),
 	}
+	if offset, ok := manager.simLogSize(); ok {
+		newTestCase.SimLogOffsets = &LogOffsets{Begin: offset, End: offset}
+	}
 	// add the test case to the test suite
 	testSuite.TestCases[newCaseID] = newTestCase
 	// and to the general map of id:testcases
-	manager.runningTestCases[newCaseID] = newTestCase
+	manager.runningTestCases[newCaseID] = &runningTest{
+		TestCase:  newTestCase,
+		suite:     testSuiteID,
+		suiteName: testSuite.Name,
+		id:        newCaseID,
+	}
+	metricTestsStarted.WithLabelValues(testSuite.Name).Inc()
 
+	manager.config.LiveFeed.Send(LiveEvent{
+		Time:  newTestCase.Start,
+		Type:  LiveTestStart,
+		Suite: testSuiteID,
+		Test:  newCaseID,
+		Name:  name,
+	})
 	return newCaseID, nil
 }
 
 // EndTest finishes the test case
 func (manager *TestManager) EndTest(testSuiteRun TestSuiteID, testID TestID, summaryResult *TestResult) error {
+	testCase, err := manager.finishTest(testID, summaryResult)
+	if err != nil {
+		return err
+	}
+	if testCase.SummaryResult.Pass {
+		return nil
+	}
+
+	// Reading the client logs can take a while, so the excerpts are created
+	// without holding the lock. The test stays in endingTestCases until they
+	// are stored, so the suite file is not written without them.
+	excerpts := manager.logExcerpts(testCase)
+	manager.testCaseMutex.Lock()
+	defer manager.testCaseMutex.Unlock()
+	for info, excerpt := range excerpts {
+		info.LogExcerpt = excerpt
+	}
+	delete(manager.endingTestCases, testID)
+	return nil
+}
+
+// finishTest records the result of a test case and stops its clients.
+// Failed tests are moved to endingTestCases.
+func (manager *TestManager) finishTest(testID TestID, summaryResult *TestResult) (*runningTest, error) {
 	manager.testCaseMutex.Lock()
 	defer manager.testCaseMutex.Unlock()
 
 	// Check if the test case is running
 	testCase, ok := manager.runningTestCases[testID]
 	if !ok {
-		return ErrNoSuchTestCase
+		return nil, ErrNoSuchTestCase
 	}
 	// Make sure there is at least a result summary
 	if summaryResult == nil {
-		return ErrNoSummaryResult
+		return nil, ErrNoSummaryResult
 	}
 
 	// Add the results to the test case
 	testCase.End = time.Now()
 	testCase.SummaryResult = *summaryResult
+	if offset, ok := manager.simLogSize(); ok && testCase.SimLogOffsets != nil {
+		testCase.SimLogOffsets.End = offset
+	}
+	for _, v := range testCase.ClientInfo {
+		if v.LogOffsets != nil {
+			v.LogOffsets.End = manager.clientLogSize(v)
+		}
+	}
 
 	// Stop running clients.
 	for _, v := range testCase.ClientInfo {
 		if v.wait != nil {
-			manager.backend.DeleteContainer(v.ID)
-			v.wait()
-			v.wait = nil
+			manager.stopClient(testCase, v, "test ended")
+		}
+	}
+
+	// Fail the test if any client crashed.
+	if crashes := describeCrashes(testCase.TestCase); crashes != "" {
+		testCase.SummaryResult.Pass = false
+		if testCase.SummaryResult.Details != "" {
+			testCase.SummaryResult.Details += "\n\n"
 		}
+		testCase.SummaryResult.Details += crashes
 	}
+	result := "pass"
+	if !testCase.SummaryResult.Pass {
+		result = "fail"
+	}
+	manager.recordEvent(testCase, TestEvent{Time: testCase.End, Type: EventTestEnd, Details: result})
+	recordTestEnd(testCase)
 
 	// Delete from running, if it's still there.
 	delete(manager.runningTestCases, testID)
+	if !testCase.SummaryResult.Pass {
+		manager.endingTestCases[testID] = testCase
+	}
+
+	// Wake up crash watchers of the test.
+	manager.crashMutex.Lock()
+	manager.notifyCrashWatchers()
+	manager.crashMutex.Unlock()
+	return testCase, nil
+}
+
+// logExcerpts returns the interesting part of the client logs in a failed test.
+// The test must not be running anymore.
+func (manager *TestManager) logExcerpts(testCase *runningTest) map[*ClientInfo][]string {
+	if manager.config.ClientLogExcerptLines <= 0 || manager.config.LogDir == "" {
+		return nil
+	}
+	excerpts := make(map[*ClientInfo][]string)
+	for _, info := range testCase.ClientInfo {
+		if info.LogFile == "" || info.LogOffsets == nil {
+			continue
+		}
+		file := filepath.Join(manager.config.LogDir, filepath.FromSlash(info.LogFile))
+		excerpts[info] = clientLogExcerpt(file, *info.LogOffsets, manager.config.ClientLogExcerptLines)
+	}
+	return excerpts
+}
+
+// clientLogSize returns the current size of a client log file.
+func (manager *TestManager) clientLogSize(info *ClientInfo) int64 {
+	if info.LogFile == "" || manager.config.LogDir == "" {
+		return 0
+	}
+	stat, err := os.Stat(filepath.Join(manager.config.LogDir, filepath.FromSlash(info.LogFile)))
+	if err != nil {
+		return 0
+	}
+	return stat.Size()
+}
+
+// AddArtifact stores a file produced by a test case in the log directory.
+// The file is recorded in the test case, so it appears in the suite output.
+func (manager *TestManager) AddArtifact(testID TestID, name string, content io.Reader) error {
+	if manager.config.LogDir == "" {
+		return ErrNoArtifactStorage
+	}
+	if !validArtifactName(name) {
+		return ErrInvalidArtifactName
+	}
+	testCase, ok := manager.IsTestRunning(testID)
+	if !ok {
+		return ErrNoSuchTestCase
+	}
+
+	// Write the file. This happens without holding the lock
+	// because artifacts can be large.
+	jsonPath := path.Join("artifacts", fmt.Sprintf("%d-%d-%d", testCase.Start.Unix(), os.Getpid(), testID), name)
+	file := filepath.Join(manager.config.LogDir, filepath.FromSlash(jsonPath))
+	if err := writeArtifactFile(file, content); err != nil {
+		return err
+	}
+
+	// Register it.
+	manager.testCaseMutex.Lock()
+	defer manager.testCaseMutex.Unlock()
+	running, ok := manager.runningTestCases[testID]
+	if !ok {
+		os.Remove(file)
+		return ErrNoSuchTestCase
+	}
+	if testCase.Artifacts == nil {
+		testCase.Artifacts = make(map[string]string)
+	}
+	testCase.Artifacts[name] = jsonPath
+	manager.recordEvent(running, TestEvent{Time: time.Now(), Type: EventArtifact, Details: name})
+	return nil
+}
+
+// AddTestEvent adds an event to the timeline of a running test.
+func (manager *TestManager) AddTestEvent(testID TestID, ev TestEvent) error {
+	manager.testCaseMutex.RLock()
+	defer manager.testCaseMutex.RUnlock()
+
+	testCase, ok := manager.runningTestCases[testID]
+	if !ok {
+		return ErrNoSuchTestCase
+	}
+	manager.recordEvent(testCase, ev)
 	return nil
 }
 
+// recordEvent inserts an event into the timeline of a test case.
+// Events can be recorded out of order, so the timeline is kept sorted.
+func (manager *TestManager) recordEvent(testCase *runningTest, ev TestEvent) {
+	manager.eventMutex.Lock()
+	defer manager.eventMutex.Unlock()
+
+	i := sort.Search(len(testCase.Events), func(i int) bool {
+		return testCase.Events[i].Time.After(ev.Time)
+	})
+	testCase.Events = append(testCase.Events, TestEvent{})
+	copy(testCase.Events[i+1:], testCase.Events[i:])
+	testCase.Events[i] = ev
+
+	live := LiveEvent{
+		Time:    ev.Time,
+		Type:    ev.Type,
+		Suite:   testCase.suite,
+		Test:    testCase.id,
+		Client:  ev.Client,
+		Network: ev.Network,
+		Details: ev.Details,
+	}
+	if ev.Type == EventTestEnd {
+		pass := ev.Details == "pass"
+		live.Pass = &pass
+	}
+	manager.config.LiveFeed.Send(live)
+}
+
+// recordContainerEvent adds an event about a container to the tests using the container.
+// For the simulation container, the event is added to all running tests of the suite.
+func (manager *TestManager) recordContainerEvent(testSuite TestSuiteID, containerID string, ev TestEvent) {
+	manager.testCaseMutex.RLock()
+	defer manager.testCaseMutex.RUnlock()
+
+	suite, ok := manager.runningTestSuites[testSuite]
+	if !ok {
+		return
+	}
+	for testID := range suite.TestCases {
+		testCase, running := manager.runningTestCases[testID]
+		if !running {
+			continue
+		}
+		if _, ok := testCase.ClientInfo[containerID]; ok || containerID == "simulation" {
+			manager.recordEvent(testCase, ev)
+		}
+	}
+}
+
+// validArtifactName reports whether name can be used as an artifact file name.
+func validArtifactName(name string) bool {
+	if name == "" || name == "." || name == ".." {
+		return false
+	}
+	return !strings.ContainsAny(name, `/\`)
+}
+
+func writeArtifactFile(file string, content io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file)
+	}
+	return err
+}
+
 // RegisterNode is used by test suite hosts to register the creation of a node in the context of a test
 func (manager *TestManager) RegisterNode(testID TestID, nodeID string, nodeInfo *ClientInfo) error {
 	manager.testCaseMutex.Lock()
@@ -457,6 +901,10 @@ func (manager *TestManager) RegisterNode(testID TestID, nodeID string, nodeInfo
 		testCase.ClientInfo = make(map[string]*ClientInfo)
 	}
 	testCase.ClientInfo[nodeID] = nodeInfo
+
+	nodeInfo.exited = make(chan struct{})
+	nodeInfo.watchDone = make(chan struct{})
+	go manager.watchClient(testCase, nodeInfo, nodeInfo.wait)
 	return nil
 }
 
@@ -475,15 +923,223 @@ func (manager *TestManager) StopNode(testID TestID, nodeID string) error {
 	}
 	// Stop the container.
 	if nodeInfo.wait != nil {
-		if err := manager.backend.DeleteContainer(nodeInfo.ID); err != nil {
+		if err := manager.stopClient(testCase, nodeInfo, ""); err != nil {
 			return fmt.Errorf("unable to stop client: %v", err)
 		}
-		nodeInfo.wait()
-		nodeInfo.wait = nil
 	}
 	return nil
 }
 
+// stopClient removes a client container and waits for it to exit. The stop is
+// recorded in the timeline of the test with the given details.
+// This must be called with testCaseMutex held.
+func (manager *TestManager) stopClient(testCase *runningTest, nodeInfo *ClientInfo, details string) error {
+	manager.setStopping(nodeInfo, true)
+	stopTime := time.Now()
+	if err := manager.backend.DeleteContainer(nodeInfo.ID); err != nil {
+		manager.setStopping(nodeInfo, false)
+		return err
+	}
+	manager.recordEvent(testCase, TestEvent{Time: stopTime, Type: EventClientStop, Client: nodeInfo.ID, Details: details})
+	manager.releaseAliases(nodeInfo.ID, "")
+	nodeInfo.wait()
+	nodeInfo.wait = nil
+	if nodeInfo.watchDone != nil {
+		<-nodeInfo.watchDone
+	}
+	return nil
+}
+
+func (manager *TestManager) setStopping(nodeInfo *ClientInfo, stopping bool) {
+	manager.crashMutex.Lock()
+	defer manager.crashMutex.Unlock()
+	nodeInfo.stopping = stopping
+}
+
+// watchClient waits for a client container to exit. If the client exits before
+// hive stops it, the exit is recorded as a crash.
+func (manager *TestManager) watchClient(testCase *runningTest, nodeInfo *ClientInfo, wait func()) {
+	defer close(nodeInfo.watchDone)
+	if wait != nil {
+		wait()
+	}
+	close(nodeInfo.exited)
+	if nodeInfo.release != nil {
+		nodeInfo.release()
+	}
+
+	manager.crashMutex.Lock()
+	stopping := nodeInfo.stopping
+	manager.crashMutex.Unlock()
+	if stopping || wait == nil {
+		return
+	}
+
+	crash := &ClientCrash{Time: time.Now(), ExitCode: -1}
+	if exit, err := manager.backend.InspectExit(nodeInfo.ID); err != nil {
+		log15.Error("can't get client exit status", "container", nodeInfo.ID, "err", err)
+	} else {
+		crash.ExitCode = exit.ExitCode
+		crash.OOMKilled = exit.OOMKilled
+	}
+	if nodeInfo.LogFile != "" {
+		logFile := filepath.Join(manager.config.LogDir, filepath.FromSlash(nodeInfo.LogFile))
+		crash.LogTail = readLogTail(logFile, crashLogLines)
+	}
+	log15.Warn("client exited unexpectedly", "client", nodeInfo.Name, "container", nodeInfo.ID, "exitCode", crash.ExitCode, "oomKilled", crash.OOMKilled)
+
+	manager.recordEvent(testCase, TestEvent{
+		Time:    crash.Time,
+		Type:    EventClientCrash,
+		Client:  nodeInfo.ID,
+		Details: fmt.Sprintf("exit code %d", crash.ExitCode),
+	})
+
+	manager.crashMutex.Lock()
+	nodeInfo.Crash = crash
+	manager.notifyCrashWatchers()
+	manager.crashMutex.Unlock()
+}
+
+// notifyCrashWatchers wakes up all ClientCrashes callers.
+// This must be called with crashMutex held.
+func (manager *TestManager) notifyCrashWatchers() {
+	close(manager.crashNotify)
+	manager.crashNotify = make(chan struct{})
+}
+
+// ClientCrashes returns the clients of a test case which have crashed so far. The returned
+// channel is closed when another crash happens or a test ends. The boolean result reports
+// whether the test is still running.
+func (manager *TestManager) ClientCrashes(testID TestID) (map[string]*ClientInfo, <-chan struct{}, bool) {
+	manager.testCaseMutex.RLock()
+	defer manager.testCaseMutex.RUnlock()
+	manager.crashMutex.Lock()
+	defer manager.crashMutex.Unlock()
+
+	testCase, running := manager.runningTestCases[testID]
+	if !running {
+		return nil, manager.crashNotify, false
+	}
+	crashed := make(map[string]*ClientInfo)
+	for id, info := range testCase.ClientInfo {
+		if info.Crash != nil {
+			crashed[id] = info
+		}
+	}
+	return crashed, manager.crashNotify, true
+}
+
+// crashLogLines is the number of client log lines stored for a crash.
+const crashLogLines = 50
+
+// simLogLines is the number of simulator log lines included in simulator failure reports.
+const simLogLines = 50
+
+// FinishSimulation ends all tests and suites which are still running after the simulator
+// has exited. The failure describes why the simulator failed, and is empty if it exited
+// normally. Simulator failures and suites which were not ended by the simulator are
+// reported as failed test cases, with the end of the simulator log attached. If no suite
+// is running when the simulator fails, a new suite is created for the report.
+func (manager *TestManager) FinishSimulation(simName, failure string) error {
+	manager.testSuiteMutex.RLock()
+	var suites []TestSuiteID
+	for id := range manager.runningTestSuites {
+		suites = append(suites, id)
+	}
+	manager.testSuiteMutex.RUnlock()
+	sort.Slice(suites, func(i, j int) bool { return suites[i] < suites[j] })
+
+	if len(suites) == 0 && failure == "" {
+		return nil
+	}
+	if len(suites) == 0 {
+		id, err := manager.StartTestSuite(simName, "This suite reports the failure of simulator "+simName+".")
+		if err != nil {
+			return err
+		}
+		suites = append(suites, id)
+	}
+
+	// Add the failed test to all running suites.
+	testName, details := "test suite not ended", "The simulator exited without ending the test suite."
+	if failure != "" {
+		testName, details = "simulator failure", "The simulator failed: "+failure+"."
+	}
+	if manager.simLogFile != "" {
+		logFile := filepath.Join(manager.config.LogDir, filepath.FromSlash(manager.simLogFile))
+		if lines := readLogTail(logFile, simLogLines); len(lines) > 0 {
+			details += fmt.Sprintf("\nlast %d lines of simulator output:\n", len(lines))
+			details += strings.Join(lines, "\n")
+		}
+	}
+	for _, suite := range suites {
+		testID, err := manager.StartTest(suite, testName, "Added by hive to report a simulator problem.")
+		if err != nil {
+			log15.Error("can't report simulator failure", "suite", suite, "err", err)
+			continue
+		}
+		if err := manager.EndTest(suite, testID, &TestResult{Pass: false, Details: details}); err != nil {
+			log15.Error("can't report simulator failure", "suite", suite, "err", err)
+		}
+	}
+	return manager.terminate(failure)
+}
+
+// describeCrashes creates the test failure message for crashed clients.
+func describeCrashes(testCase *TestCase) string {
+	var ids []string
+	for id, info := range testCase.ClientInfo {
+		if info.Crash != nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	var b strings.Builder
+	for i, id := range ids {
+		info := testCase.ClientInfo[id]
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		fmt.Fprintf(&b, "client %s (%s) exited unexpectedly with exit code %d", info.Name, info.ID, info.Crash.ExitCode)
+		if info.Crash.OOMKilled {
+			b.WriteString(" (killed: out of memory)")
+		}
+		if len(info.Crash.LogTail) > 0 {
+			fmt.Fprintf(&b, "\nlast %d lines of client output:\n", len(info.Crash.LogTail))
+			b.WriteString(strings.Join(info.Crash.LogTail, "\n"))
+		}
+	}
+	return b.String()
+}
+
+// readLogTail returns the last n lines of a log file.
+func readLogTail(file string, n int) []string {
+	const maxRead = 64 * 1024
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	if stat, err := f.Stat(); err == nil && stat.Size() > maxRead {
+		f.Seek(-maxRead, io.SeekEnd)
+	}
+	content, err := io.ReadAll(f)
+	if err != nil {
+		return nil
+	}
+	lines := strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	if len(lines) == 1 && lines[0] == "" {
+		return nil
+	}
+	return lines
+}
+
 // writeSuiteFile writes the simulation result to the log directory.
 func writeSuiteFile(s *TestSuite, logdir string) error {
 	suiteData, err := json.Marshal(s)
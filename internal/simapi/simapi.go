@@ -1,6 +1,8 @@
 // Package simapi contains definitions of JSON objects used in the simulation API.
 package simapi
 
+import "time"
+
 type TestRequest struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
@@ -10,7 +12,43 @@ type TestRequest struct {
 type NodeConfig struct {
 	Client      string            `json:"client"`
 	Networks    []string          `json:"networks"`
+	Hostname    string            `json:"hostname,omitempty"`
 	Environment map[string]string `json:"environment"`
+	Readiness   *ReadinessProbe   `json:"readiness,omitempty"`
+	Clock       *ClockConfig      `json:"clock,omitempty"`
+}
+
+// ClockConfig is the setting of a fake client clock.
+type ClockConfig struct {
+	// Offset is added to the real time, e.g. "-1h".
+	Offset string `json:"offset,omitempty"`
+	// Rate is the speed of the clock relative to real time.
+	// Zero means the clock runs at normal speed.
+	Rate float64 `json:"rate,omitempty"`
+}
+
+// ClockUpdate changes the fake clock of a running client.
+type ClockUpdate struct {
+	// Shift is added to the current clock offset, e.g. "30s".
+	Shift string `json:"shift,omitempty"`
+	// Rate sets the clock speed. Zero means the rate is unchanged.
+	Rate float64 `json:"rate,omitempty"`
+}
+
+// ReadinessProbe configures how hive checks that a client container has started.
+// Probes can be declared in the client's hive.yaml and by the simulator.
+type ReadinessProbe struct {
+	// Type is "tcp", "http", "jsonrpc" or "none".
+	Type string `json:"type" yaml:"type"`
+	// Port is the TCP port of the probed endpoint.
+	Port uint16 `json:"port,omitempty" yaml:"port"`
+	// Path is the URL path of "http" and "jsonrpc" probes.
+	Path string `json:"path,omitempty" yaml:"path"`
+	// Method is the method called by "jsonrpc" probes.
+	Method string `json:"method,omitempty" yaml:"method"`
+	// Timeout is the time limit for the client to become ready, e.g. "2m".
+	// If empty, the client start timeout of hive applies.
+	Timeout string `json:"timeout,omitempty" yaml:"timeout"`
 }
 
 // StartNodeReponse is returned by the client startup endpoint.
@@ -29,6 +67,46 @@ type ExecRequest struct {
 	Command []string `json:"command"`
 }
 
+// These are the stream identifiers of the streaming exec protocol. Output of the command
+// is sent as binary websocket messages, with the first byte identifying the stream.
+const (
+	ExecStreamStdout byte = 1
+	ExecStreamStderr byte = 2
+)
+
+// ExecStreamResult is the final message of a streaming exec session.
+type ExecStreamResult struct {
+	ExitCode int    `json:"exitCode"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ClientCrash is sent by the crash subscription endpoint when a client
+// exits unexpectedly.
+type ClientCrash struct {
+	ID        string    `json:"id"`   // Container ID.
+	Name      string    `json:"name"` // Client name.
+	Time      time.Time `json:"time"`
+	ExitCode  int       `json:"exitCode"`
+	OOMKilled bool      `json:"oomKilled"`
+	LogTail   []string  `json:"logTail"`
+}
+
+// NetworkOptions configures a network. All fields are optional.
+// This is the body of the network creation endpoint.
+type NetworkOptions struct {
+	Subnet     string `json:"subnet,omitempty"`     // IPv4 subnet in CIDR notation
+	Gateway    string `json:"gateway,omitempty"`    // IPv4 gateway address, must be in Subnet
+	Internal   bool   `json:"internal,omitempty"`   // disables access to outside networks
+	IPv6       bool   `json:"ipv6,omitempty"`       // enables IPv6 in addition to IPv4
+	IPv6Subnet string `json:"ipv6Subnet,omitempty"` // IPv6 subnet in CIDR notation
+	MTU        int    `json:"mtu,omitempty"`        // MTU of network interfaces
+}
+
+// NetworkConnectRequest is the optional body of the network connect endpoint.
+type NetworkConnectRequest struct {
+	Aliases []string `json:"aliases,omitempty"` // DNS names of the container in the network
+}
+
 type Error struct {
 	Error string `json:"error"`
 }
@@ -1,6 +1,7 @@
 package optimism
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
 	"encoding/json"
@@ -77,7 +78,7 @@ func NewDevnet(t *hivesim.T) *Devnet {
 	}
 	roles := Roles(clientTypes)
 	t.Logf("creating devnet with client roles: %s", roles)
-	return &Devnet{
+	d := &Devnet{
 		T:           t,
 		Clients:     roles,
 		MnemonicCfg: DefaultMnemonicConfig,
@@ -86,6 +87,39 @@ func NewDevnet(t *hivesim.T) *Devnet {
 		L2Vault:     NewVault(t, L2ChainIDBig),
 		Addresses:   secrets.Addresses(),
 	}
+	t.Cleanup(d.attachConfigsOnFailure)
+	return d
+}
+
+// attachConfigsOnFailure attaches the chain configurations to the test report
+// when the test has failed.
+func (d *Devnet) attachConfigsOnFailure() {
+	if !d.T.Failed() {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.L1Cfg != nil {
+		d.attachJSON("l1_genesis.json", d.L1Cfg)
+	}
+	if d.L2Cfg != nil {
+		d.attachJSON("l2_genesis.json", d.L2Cfg)
+	}
+	if d.RollupCfg != nil {
+		d.attachJSON("rollup_config.json", d.RollupCfg)
+	}
+}
+
+func (d *Devnet) attachJSON(name string, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		d.T.Logf("failed to encode %s: %v", name, err)
+		return
+	}
+	if err := d.T.AttachArtifact(name, bytes.NewReader(data)); err != nil {
+		d.T.Logf("failed to attach %s: %v", name, err)
+	}
 }
 
 // AddEth1 creates a new L1 eth1 client. This requires a L1 chain config to be created previously.